@@ -0,0 +1,184 @@
+// Command linkctl manages links directly in the database from the command line.
+//
+// Usage:
+//
+//	linkctl import [-dry-run] <file.csv|->
+//	linkctl export [-format csv|ndjson] [-domain domain] [-tag tag] [-host host] [-created-after date] [-created-before date] [-health ok|broken] [-o file]
+//	linkctl backfill-summary
+//	linkctl check-reserved
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/joho/godotenv"
+)
+
+// usage prints the available subcommands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  linkctl import [-dry-run] <file.csv|->")
+	fmt.Fprintln(os.Stderr, "  linkctl export [-format csv|ndjson] [-domain domain] [-tag tag] [-host host] [-created-after date] [-created-before date] [-health ok|broken] [-o file]")
+	fmt.Fprintln(os.Stderr, "  linkctl backfill-summary")
+	fmt.Fprintln(os.Stderr, "  linkctl check-reserved")
+}
+
+// runImport imports links from a CSV file and prints the report as JSON.
+// Unlike the API, imports from the command line are not subject to rate limiting.
+func runImport(urlService *services.URLService, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without creating links")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	var input io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	rows, err := services.ParseImportCSV(input)
+	if err != nil {
+		return err
+	}
+
+	report, err := urlService.ImportLinks(rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	if report.Invalid > 0 {
+		return fmt.Errorf("%d of %d rows are invalid", report.Invalid, report.Total)
+	}
+	return nil
+}
+
+// runExport streams links matching the filter flags to stdout or a file.
+func runExport(urlService *services.URLService, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", constants.ExportFormatCSV, "output format: csv or ndjson")
+	domain := flags.String("domain", "", "only export links on this short domain")
+	tag := flags.String("tag", "", "only export links with this tag")
+	host := flags.String("host", "", "only export links whose destination is on this host")
+	createdAfter := flags.String("created-after", "", "only export links created at or after this date (RFC 3339 or YYYY-MM-DD)")
+	createdBefore := flags.String("created-before", "", "only export links created before this date (RFC 3339 or YYYY-MM-DD)")
+	health := flags.String("health", "", "only export links whose destination health is ok or broken")
+	output := flags.String("o", "-", "output file, or - for stdout")
+	_ = flags.Parse(args)
+
+	filter, err := urlService.ParseLinkFilter(*domain, *tag, *host, *createdAfter, *createdBefore, *health)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer, err := services.NewLinkExportWriter(out, *format)
+	if err != nil {
+		return err
+	}
+	if err := urlService.ExportLinks(filter, writer.Write); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// runBackfillSummary counts the links missing from the analytics summary, such as links
+// created before it was introduced. It scans every link, so it is meant to be run once.
+func runBackfillSummary(urlService *services.URLService, args []string) error {
+	if len(args) != 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	added, err := urlService.BackfillSummary()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d links added to the analytics summary\n", added)
+	return nil
+}
+
+// runCheckReserved lists the existing links whose short code is reserved for an analytics
+// route, so they can be recreated under another code. It fails if there are any.
+func runCheckReserved(urlService *services.URLService, args []string) error {
+	if len(args) != 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	shortURLs, err := urlService.ReservedLinks()
+	if err != nil {
+		return err
+	}
+	for _, shortURL := range shortURLs {
+		fmt.Println(shortURL)
+	}
+	if len(shortURLs) > 0 {
+		return fmt.Errorf("%d links use a reserved short code; their analytics are shadowed by an analytics route", len(shortURLs))
+	}
+	return nil
+}
+
+// main is the entry point of the command line tool.
+func main() {
+	// Load environment variables from .env file
+	if err := godotenv.Load(); err != nil {
+		err = fmt.Errorf("failed to load environment variables: %w", err)
+		log.Printf("Warning: %v", err)
+	}
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	urlService := services.NewURLService(config.Load())
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(urlService, os.Args[2:])
+	case "export":
+		err = runExport(urlService, os.Args[2:])
+	case "backfill-summary":
+		err = runBackfillSummary(urlService, os.Args[2:])
+	case "check-reserved":
+		err = runCheckReserved(urlService, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/adeesh/url-shortener/internal/config"
 	"github.com/adeesh/url-shortener/internal/handlers"
+	"github.com/adeesh/url-shortener/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -19,26 +26,145 @@ func createGinApp() *gin.Engine {
 
 // setupRoutes configures the application routes for URL shortening and resolution.
 //   - GET /:url - Resolves short URLs and redirects to original URLs
+//     (GET /:url+ or GET /:url?preview=1 renders a preview page instead; HEAD /:url counts as a bot hit)
 //   - POST /api/v1 - Creates shortened URLs from long URLs
-//   - GET /api/v1/analytics - Returns total redirect analytics
-//   - GET /api/v1/analytics/:url - Returns analytics for specific short URL
+//   - POST /api/v1/bulk - Creates shortened URLs for a batch of long URLs
+//   - GET /api/v1/analytics - Returns total redirect analytics (analytics token)
+//   - GET /api/v1/analytics/summary - Returns top links, links created, active and expired, and the creation rate (analytics token)
+//   - GET /api/v1/analytics/export - Streams daily clicks per link, and optionally breakdowns, as CSV or NDJSON (analytics token)
+//   - GET /api/v1/analytics/:url - Returns analytics for specific short URL (analytics token)
+//   - GET /api/v1/analytics/:url/timeseries - Returns clicks per minute, hour or day for a short URL (analytics token)
+//   - GET /api/v1/analytics/:url/breakdown - Returns top referrers, browsers, OSes, devices and languages (analytics token)
+//   - GET /api/v1/analytics/:url/live - Streams the clicks of a short URL as Server-Sent Events (analytics token)
+//   - GET /api/v1/live - Streams the clicks of all short URLs as Server-Sent Events (analytics token)
+//   - GET /api/v1/links/:code/qr - Returns a QR code (PNG or SVG) for a short URL
+//   - POST /api/v1/links/import - Creates links from a CSV file (or validates it with ?dry_run=1) (admin)
+//   - GET /api/v1/links/export - Streams links with metadata and click counts as CSV or NDJSON (analytics token)
+//   - GET /api/v1/links/:code/health - Returns the destination health history of a short URL
+//   - POST /api/v1/report/:code - Reports a short URL for abuse
+//   - GET /api/v1/admin/reports - Returns reported links awaiting review (admin)
+//   - POST /api/v1/admin/links/:code/quarantine - Quarantines a short URL (admin)
+//   - POST /api/v1/admin/links/:code/restore - Restores a short URL and dismisses its reports (admin)
+//   - GET /api/v1/admin/links/:code/audit - Returns the status changes of a short URL (admin)
+//   - GET /api/v1/admin/clicks - Returns the queue length and counters of the click pipeline (admin)
+//   - GET /api/v1/admin/misses - Returns requests for unknown short codes and the most requested ones (admin)
+//   - DELETE /api/v1/admin/analytics/:code - Starts purging the analytics of a short URL (admin)
+//   - DELETE /api/v1/admin/analytics?domain= - Starts purging the analytics of every short URL on a domain (admin)
+//   - GET /api/v1/admin/analytics/purges/:id - Returns the status of an analytics purge (admin)
 func setupRoutes(app *gin.Engine) {
 	// Route for resolving short URLs (e.g., /abc123)
 	app.GET("/:url", handlers.ResolveURL)
+	app.HEAD("/:url", handlers.ResolveURL)
 
 	// Route for creating shortened URLs
 	app.POST("/api/v1", handlers.ShortenURL)
+	app.POST("/api/v1/bulk", handlers.BulkShortenURL)
 
 	// Analytics routes
-	app.GET("/api/v1/analytics", handlers.GetAnalytics)
-	app.GET("/api/v1/analytics/:url", handlers.GetShortURLAnalytics)
+	analytics := app.Group("/api/v1/analytics", handlers.RequireAnalyticsToken)
+	analytics.GET("", handlers.GetAnalytics)
+	analytics.GET("/summary", handlers.GetAnalyticsSummary)
+	analytics.GET("/export", handlers.ExportClicks)
+	analytics.GET("/:url", handlers.GetShortURLAnalytics)
+	analytics.GET("/:url/timeseries", handlers.GetShortURLTimeseries)
+	analytics.GET("/:url/breakdown", handlers.GetShortURLBreakdown)
+	analytics.GET("/:url/live", handlers.StreamShortURLClicks)
+	app.GET("/api/v1/live", handlers.RequireAnalyticsToken, handlers.StreamClicks)
+
+	// Link routes
+	app.GET("/api/v1/links/:code/qr", handlers.GetQRCode)
+	app.GET("/api/v1/links/:code/health", handlers.GetLinkHealth)
+	app.POST("/api/v1/links/import", handlers.RequireAdmin, handlers.ImportLinks)
+	app.GET("/api/v1/links/export", handlers.RequireAnalyticsToken, handlers.ExportLinks)
+
+	// Abuse reporting and moderation routes
+	app.POST("/api/v1/report/:code", handlers.ReportLink)
+	admin := app.Group("/api/v1/admin", handlers.RequireAdmin)
+	admin.GET("/reports", handlers.GetReviewQueue)
+	admin.POST("/links/:code/quarantine", handlers.QuarantineLink)
+	admin.POST("/links/:code/restore", handlers.RestoreLink)
+	admin.GET("/links/:code/audit", handlers.GetLinkAudit)
+	admin.GET("/clicks", handlers.GetClickPipelineStats)
+	admin.GET("/misses", handlers.GetMissedCodes)
+	admin.DELETE("/analytics", handlers.PurgeAnalytics)
+	admin.DELETE("/analytics/:code", handlers.PurgeAnalytics)
+	admin.GET("/analytics/purges/:id", handlers.GetPurgeJob)
+}
+
+// warnReservedLinks warns about existing links whose short code is reserved for an analytics
+// route, since their analytics cannot be reached. It does not keep the server from starting.
+func warnReservedLinks(cfg *config.Config) {
+	shortURLs, err := services.NewURLService(cfg).ReservedLinks()
+	if err != nil {
+		log.Printf("Warning: failed to check for links with reserved short codes: %v", err)
+		return
+	}
+	for _, shortURL := range shortURLs {
+		log.Printf("Warning: link %s uses a reserved short code; its analytics are shadowed by an analytics route, recreate it under another code (see linkctl check-reserved)", shortURL)
+	}
 }
 
-// startServer starts the Gin server on the configured port and starts listening for HTTP requests.
-func startServer(app *gin.Engine, cfg *config.Config) error {
-	port := cfg.AppPort
-	log.Printf("Starting server on port %s", port)
-	return app.Run(":" + port)
+// startHealthProber starts probing link destinations in the background, if enabled. It returns
+// a function that stops the prober, cancelling the probes in flight, and waits for it to end
+// or for the context to be done.
+func startHealthProber(cfg *config.Config) func(ctx context.Context) error {
+	if cfg.HealthCheckInterval <= 0 {
+		return func(ctx context.Context) error { return nil }
+	}
+	urlService := services.NewURLService(cfg)
+	prober := services.NewHealthProber(cfg, urlService, services.NewProbeClient(urlService.DestinationPolicy()))
+	log.Printf("Checking link destinations every %s", cfg.HealthCheckInterval)
+
+	proberCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		prober.Run(proberCtx, cfg.HealthCheckInterval)
+	}()
+	return func(ctx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("health prober: %w", ctx.Err())
+		}
+	}
+}
+
+// startServer starts the Gin server on the configured port and serves HTTP requests until
+// the process is interrupted or terminated. It then shuts down gracefully: it stops accepting
+// connections, waits for in-flight requests, stops the health prober and records the queued
+// clicks, within the configured shutdown timeout.
+func startServer(app *gin.Engine, cfg *config.Config, stopHealthProber func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: ":" + cfg.AppPort, Handler: app}
+	// Live analytics streams never finish on their own; end them so shutdown does not wait for them
+	server.RegisterOnShutdown(handlers.CloseLiveStreams)
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("Starting server on port %s", cfg.AppPort)
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	if err := stopHealthProber(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	return handlers.StopClickPipeline(shutdownCtx)
 }
 
 // main is the entry point of the application.
@@ -58,8 +184,26 @@ func main() {
 	// Setup application routes
 	setupRoutes(app)
 
+	// Warn about links created before their short code was reserved
+	warnReservedLinks(cfg)
+
+	// Move the reporter secret of earlier versions out of the links
+	if err := services.NewURLService(cfg).MigrateReporterSecret(); err != nil {
+		log.Printf("Warning: failed to migrate the reporter secret: %v", err)
+	}
+
+	// Probe link destinations in the background
+	stopHealthProber := startHealthProber(cfg)
+
+	// Record clicks in the background and deliver them to the configured sinks
+	sinks, err := services.NewClickSinks(cfg)
+	if err != nil {
+		log.Fatal("Failed to create click sinks:", err)
+	}
+	handlers.StartClickPipeline(sinks...)
+
 	// Start the HTTP server and listen for requests
-	if err := startServer(app, cfg); err != nil {
+	if err := startServer(app, cfg, stopHealthProber); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/adeesh/url-shortener/internal/constants"
@@ -14,20 +15,125 @@ type Config struct {
 	AppPort   string        // Application port (e.g., "3000")
 	DBAddr    string        // Redis database address (e.g., "localhost:6379")
 	DBPass    string        // Redis database password
-	Domain    string        // Application domain for generating short URLs
+	Domain    string        // Default application domain for generating short URLs
+	Domains   []string      // Every short domain served by this instance; Domain is always the first
 	APIQuota  int           // Number of API requests allowed per time window
 	RateLimit time.Duration // Duration of the rate limiting window
+
+	RateLimitStore     string // Where rate limit state is kept: "redis", shared by instances, or "memory"
+	RateLimitAlgorithm string // How requests are limited: "fixed_window", "sliding_window", "token_bucket" or "gcra"
+
+	BlocklistFile           string        // Path of the destination blocklist file; empty disables checking
+	BlocklistAction         string        // What to do with blocklisted destinations: "reject" or "quarantine"
+	BlocklistCheckOnResolve bool          // Whether destinations are checked again on every redirect
+	BlocklistReload         time.Duration // How often the blocklist file is checked for changes
+
+	AllowedSchemes []string // Destination URL schemes links may use, lowercase (e.g. "https", "myapp")
+
+	BlockPrivateDestinations    bool                // Whether destinations resolving to internal networks are rejected
+	PrivateDestinationAllowlist map[string][]string // CIDR ranges allowed per short domain host despite the above
+
+	KnownShorteners []string // Hosts of other URL shorteners, lowercase
+	ShortenerAction string   // What to do with destinations on them: "allow", "block" or "unwrap"
+
+	HealthCheckInterval    time.Duration // How often link destinations are probed; zero disables probing
+	HealthCheckConcurrency int           // Number of destinations probed in parallel
+	HealthCheckHostDelay   time.Duration // Minimum time between two probes of the same host
+	HealthWebhookURL       string        // URL notified when links break or recover; empty disables it
+
+	AdminTokens               map[string]string   // Admin names keyed by their API token; empty disables the admin API
+	AnalyticsTokens           map[string]string   // Client names keyed by their analytics token; admins are also allowed
+	AnalyticsTokenDomains     map[string][]string // Short domain hosts each analytics client is limited to ("*" for every domain); clients without an entry see none
+	ReportQuarantineThreshold int                 // Distinct abuse reporters that quarantine a link; zero disables it
+
+	MinuteClickRetention time.Duration // How long per-minute click buckets are kept; zero disables them
+	HourClickRetention   time.Duration // How long per-hour click buckets are kept; zero disables them
+	DayClickRetention    time.Duration // How long per-day click buckets are kept; zero disables them
+
+	VisitorDayRetention time.Duration // How long per-day unique visitor counts are kept; zero disables them
+	VisitorStore        string        // Where unique visitor counts are kept: "redis", shared by instances, or "memory"
+	BotUserAgents       []string      // Lowercase user agent substrings of bots, in addition to the built-in ones
+
+	ClickQueueSize     int           // Clicks that can wait to be recorded before new ones are dropped
+	ClickWorkers       int           // Number of workers recording clicks
+	ClickBatchSize     int           // Maximum number of clicks recorded in one round trip
+	ClickFlushInterval time.Duration // Longest time a click waits for its batch to fill up
+	ShutdownTimeout    time.Duration // How long shutdown waits for requests and queued clicks
+
+	ClickSinks        []string // Sinks every click is delivered to (redis, file, webhook)
+	ClickStreamMaxLen int64    // Approximate maximum length of the click stream; zero keeps every click
+	ClickLogDir       string   // Directory of the NDJSON click files
+	ClickLogMaxBytes  int64    // Size at which a new click file is started
+	ClickWebhookURL   string   // URL batches of clicks are posted to
+	CountryHeader     string   // Request header holding the visitor's country code; empty if unknown
+
+	AnonymizeIP         bool          // Truncate visitor IP addresses before they are used for analytics
+	DoNotTrack          string        // How clicks with DNT or Sec-GPC are recorded: "ignore", "aggregate" or "skip"
+	ClickEventRetention time.Duration // How long raw click events are kept in the stream and files; zero keeps them
 }
 
 // Load loads configuration from environment variables with fallback defaults.
 func Load() *Config {
+	domain := getDomain()
 	return &Config{
 		AppPort:   getAppPort(),
 		DBAddr:    getDBAddr(),
 		DBPass:    getDBPass(),
-		Domain:    getDomain(),
+		Domain:    domain,
+		Domains:   getDomains(domain),
 		APIQuota:  getAPIQuota(),
 		RateLimit: getRateLimit(),
+
+		RateLimitStore:     getRateLimitStore(),
+		RateLimitAlgorithm: getRateLimitAlgorithm(),
+
+		BlocklistFile:           os.Getenv(constants.EnvBlocklistFile),
+		BlocklistAction:         getBlocklistAction(),
+		BlocklistCheckOnResolve: getBool(constants.EnvBlocklistCheckOnResolve, false),
+		BlocklistReload:         getSeconds(constants.EnvBlocklistReloadSeconds, constants.DefaultBlocklistReload),
+
+		AllowedSchemes: getAllowedSchemes(),
+
+		BlockPrivateDestinations:    getBool(constants.EnvBlockPrivateDestinations, true),
+		PrivateDestinationAllowlist: getPrivateDestinationAllowlist(),
+
+		KnownShorteners: getKnownShorteners(),
+		ShortenerAction: getShortenerAction(),
+
+		HealthCheckInterval:    getMinutes(constants.EnvHealthCheckIntervalMinutes, 0),
+		HealthCheckConcurrency: getPositiveInt(constants.EnvHealthCheckConcurrency, constants.DefaultHealthCheckConcurrency),
+		HealthCheckHostDelay:   getSeconds(constants.EnvHealthCheckHostDelaySeconds, constants.DefaultHealthCheckHostDelay),
+		HealthWebhookURL:       os.Getenv(constants.EnvHealthWebhookURL),
+
+		AdminTokens:               getTokens(constants.EnvAdminTokens),
+		AnalyticsTokens:           getTokens(constants.EnvAnalyticsTokens),
+		AnalyticsTokenDomains:     getTokenDomains(constants.EnvAnalyticsTokenDomains),
+		ReportQuarantineThreshold: getNonNegativeInt(constants.EnvReportQuarantineThreshold, constants.DefaultReportQuarantineThreshold),
+
+		MinuteClickRetention: getDuration(constants.EnvMinuteClickRetentionHours, time.Hour, constants.DefaultMinuteClickRetention),
+		HourClickRetention:   getDuration(constants.EnvHourClickRetentionDays, 24*time.Hour, constants.DefaultHourClickRetention),
+		DayClickRetention:    getDuration(constants.EnvDayClickRetentionDays, 24*time.Hour, constants.DefaultDayClickRetention),
+
+		VisitorDayRetention: getDuration(constants.EnvVisitorDayRetentionDays, 24*time.Hour, constants.DefaultVisitorDayRetention),
+		VisitorStore:        getVisitorStore(),
+		BotUserAgents:       getBotUserAgents(),
+
+		ClickQueueSize:     getPositiveInt(constants.EnvClickQueueSize, constants.DefaultClickQueueSize),
+		ClickWorkers:       getPositiveInt(constants.EnvClickWorkers, constants.DefaultClickWorkers),
+		ClickBatchSize:     getPositiveInt(constants.EnvClickBatchSize, constants.DefaultClickBatchSize),
+		ClickFlushInterval: time.Duration(getPositiveInt(constants.EnvClickFlushIntervalMs, constants.DefaultClickFlushIntervalMs)) * time.Millisecond,
+		ShutdownTimeout:    getSeconds(constants.EnvShutdownTimeoutSeconds, constants.DefaultShutdownTimeout),
+
+		ClickSinks:        getClickSinks(),
+		ClickStreamMaxLen: int64(getNonNegativeInt(constants.EnvClickStreamMaxLen, constants.DefaultClickStreamMaxLen)),
+		ClickLogDir:       os.Getenv(constants.EnvClickLogDir),
+		ClickLogMaxBytes:  int64(getPositiveInt(constants.EnvClickLogMaxMB, constants.DefaultClickLogMaxMB)) << 20,
+		ClickWebhookURL:   os.Getenv(constants.EnvClickWebhookURL),
+		CountryHeader:     strings.TrimSpace(os.Getenv(constants.EnvCountryHeader)),
+
+		AnonymizeIP:         getBool(constants.EnvAnonymizeIP, false),
+		DoNotTrack:          getDoNotTrack(),
+		ClickEventRetention: getDuration(constants.EnvClickEventRetentionDays, 24*time.Hour, 0),
 	}
 }
 
@@ -68,6 +174,27 @@ func getDomain() string {
 	return domain
 }
 
+// getDomains returns every short domain served by this instance from environment variables.
+// DOMAINS is a comma separated list of origins (e.g. "https://go.acme.com,https://acme.link");
+// entries without a scheme default to https. The default domain is always the first entry
+// and is added if DOMAINS does not list it. Defaults to just the default domain.
+func getDomains(defaultDomain string) []string {
+	domains := []string{defaultDomain}
+	for _, domain := range strings.Split(os.Getenv(constants.EnvDomains), ",") {
+		domain = strings.TrimRight(strings.TrimSpace(domain), "/")
+		if domain == "" {
+			continue
+		}
+		if !strings.Contains(domain, "://") {
+			domain = "https://" + domain
+		}
+		if domain != defaultDomain {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
 // getAPIQuota returns the API quota (requests per time window) from environment variables.
 // This controls how many requests a client can make within the rate limit window.
 // Defaults to 20 if API_QUOTA is not set or invalid.
@@ -95,3 +222,244 @@ func getRateLimit() time.Duration {
 	}
 	return constants.DefaultRateLimitDuration
 }
+
+// getRateLimitStore returns where rate limit state is kept.
+// Defaults to "redis" if RATE_LIMIT_STORE is not set or invalid.
+func getRateLimitStore() string {
+	if strings.ToLower(os.Getenv(constants.EnvRateLimitStore)) == constants.RateLimitStoreMemory {
+		return constants.RateLimitStoreMemory
+	}
+	return constants.RateLimitStoreRedis
+}
+
+// getVisitorStore returns where unique visitor counts are kept.
+// Defaults to "redis" if VISITOR_STORE is not set or invalid.
+func getVisitorStore() string {
+	if strings.ToLower(os.Getenv(constants.EnvVisitorStore)) == constants.VisitorStoreMemory {
+		return constants.VisitorStoreMemory
+	}
+	return constants.VisitorStoreRedis
+}
+
+// getRateLimitAlgorithm returns the rate limiting algorithm.
+// Defaults to "fixed_window" if RATE_LIMIT_ALGORITHM is not set or invalid.
+func getRateLimitAlgorithm() string {
+	switch algorithm := strings.ToLower(os.Getenv(constants.EnvRateLimitAlgorithm)); algorithm {
+	case constants.RateLimitSlidingWindow, constants.RateLimitTokenBucket, constants.RateLimitGCRA:
+		return algorithm
+	}
+	return constants.RateLimitFixedWindow
+}
+
+// getBlocklistAction returns what happens to links whose destination is blocklisted.
+// Defaults to "reject" if BLOCKLIST_ACTION is not set or invalid.
+func getBlocklistAction() string {
+	action := strings.ToLower(os.Getenv(constants.EnvBlocklistAction))
+	if action == constants.BlocklistActionQuarantine {
+		return action
+	}
+	return constants.BlocklistActionReject
+}
+
+// getBool returns a boolean environment variable.
+// Accepts the values understood by strconv.ParseBool and falls back to the default otherwise.
+func getBool(name string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getSeconds returns a duration given in whole seconds by an environment variable.
+// Falls back to the default if the variable is not set or invalid.
+func getSeconds(name string, fallback time.Duration) time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv(name)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// unsafeSchemes can run code or read local files in the visitor's browser and are never
+// allowed as destinations, even when listed in ALLOWED_SCHEMES.
+var unsafeSchemes = map[string]bool{
+	"javascript": true,
+	"vbscript":   true,
+	"data":       true,
+	"file":       true,
+	"blob":       true,
+}
+
+// getAllowedSchemes returns the destination URL schemes links may use from environment variables.
+// ALLOWED_SCHEMES is a comma separated list such as "http,https,mailto,myapp"; unsafe schemes
+// like javascript are dropped. Defaults to "http,https".
+func getAllowedSchemes() []string {
+	value := os.Getenv(constants.EnvAllowedSchemes)
+	if strings.TrimSpace(value) == "" {
+		value = constants.DefaultAllowedSchemes
+	}
+
+	var schemes []string
+	for _, scheme := range strings.Split(value, ",") {
+		scheme = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(scheme)), "://")
+		if scheme != "" && !unsafeSchemes[scheme] {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// getBotUserAgents returns the extra bot user agent substrings from the comma-separated
+// BOT_USER_AGENTS environment variable, lowercased. Defaults to none.
+func getBotUserAgents() []string {
+	var tokens []string
+	for _, token := range strings.Split(os.Getenv(constants.EnvBotUserAgents), ",") {
+		if token = strings.ToLower(strings.TrimSpace(token)); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// getClickSinks returns the click sinks from the comma-separated CLICK_SINKS environment
+// variable, lowercased and without duplicates. Defaults to none.
+func getClickSinks() []string {
+	var sinks []string
+	seen := make(map[string]bool)
+	for _, sink := range strings.Split(os.Getenv(constants.EnvClickSinks), ",") {
+		if sink = strings.ToLower(strings.TrimSpace(sink)); sink != "" && !seen[sink] {
+			seen[sink] = true
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// getMinutes returns a duration given in whole minutes by an environment variable.
+// Falls back to the default if the variable is not set or invalid.
+func getMinutes(name string, fallback time.Duration) time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv(name)); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return fallback
+}
+
+// getPositiveInt returns a positive integer environment variable.
+// Falls back to the default if the variable is not set or invalid.
+func getPositiveInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// getDuration returns a duration given as a whole number of units by an environment variable.
+// Falls back to the default if the variable is not set or invalid.
+func getDuration(name string, unit, fallback time.Duration) time.Duration {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value >= 0 {
+		return time.Duration(value) * unit
+	}
+	return fallback
+}
+
+// getNonNegativeInt returns a non-negative integer environment variable.
+// Falls back to the default if the variable is not set or invalid.
+func getNonNegativeInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+// getTokens returns API tokens from an environment variable, keyed by token.
+// ADMIN_TOKENS and ANALYTICS_TOKENS are comma separated lists of name:token pairs, for example
+// "alice:s3cret,bob:t0ken"; the name identifies the client, e.g. the admin in audit trails.
+// Entries without a name or token are ignored.
+func getTokens(name string) map[string]string {
+	tokens := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		tokens[parts[1]] = parts[0]
+	}
+	return tokens
+}
+
+// getTokenDomains returns the short domain hosts each token client is limited to.
+// The variable has the form "name=host,host;name=host", for example
+// "acme=go.acme.com,links.acme.com;globex=glbx.io", where names are those of the tokens.
+func getTokenDomains(name string) map[string][]string {
+	domains := make(map[string][]string)
+	for _, entry := range strings.Split(os.Getenv(name), ";") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		client := strings.TrimSpace(parts[0])
+		for _, host := range strings.Split(parts[1], ",") {
+			if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+				domains[client] = append(domains[client], host)
+			}
+		}
+	}
+	return domains
+}
+
+// getPrivateDestinationAllowlist returns the internal ranges each short domain may link to.
+// PRIVATE_DESTINATION_ALLOWLIST has the form "host=cidr,cidr;host=cidr", for example
+// "go.acme.com=10.0.0.0/8,192.168.0.0/16". Hosts are short domain hosts, not origins.
+func getPrivateDestinationAllowlist() map[string][]string {
+	allowlist := make(map[string][]string)
+	for _, entry := range strings.Split(os.Getenv(constants.EnvPrivateDestinationAllowlist), ";") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		host := strings.ToLower(strings.TrimSpace(parts[0]))
+		for _, cidr := range strings.Split(parts[1], ",") {
+			if cidr = strings.TrimSpace(cidr); cidr != "" {
+				allowlist[host] = append(allowlist[host], cidr)
+			}
+		}
+	}
+	return allowlist
+}
+
+// getKnownShorteners returns the hosts of other URL shorteners from environment variables.
+// KNOWN_SHORTENERS is a comma separated list of hosts; subdomains of a listed host also match.
+// Defaults to a list of popular public shorteners.
+func getKnownShorteners() []string {
+	value := os.Getenv(constants.EnvKnownShorteners)
+	if strings.TrimSpace(value) == "" {
+		value = constants.DefaultKnownShorteners
+	}
+
+	var hosts []string
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// getDoNotTrack returns how clicks of visitors sending DNT or Sec-GPC are recorded.
+// Defaults to "ignore" if DO_NOT_TRACK is not set or invalid.
+func getDoNotTrack() string {
+	mode := strings.ToLower(os.Getenv(constants.EnvDoNotTrack))
+	if mode == constants.DoNotTrackAggregate || mode == constants.DoNotTrackSkip {
+		return mode
+	}
+	return constants.DoNotTrackIgnore
+}
+
+// getShortenerAction returns what happens to destinations on other URL shorteners.
+// Defaults to "allow" if SHORTENER_ACTION is not set or invalid.
+func getShortenerAction() string {
+	action := strings.ToLower(os.Getenv(constants.EnvShortenerAction))
+	if action == constants.ShortenerActionBlock || action == constants.ShortenerActionUnwrap {
+		return action
+	}
+	return constants.ShortenerActionAllow
+}
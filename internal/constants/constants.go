@@ -13,6 +13,38 @@ const (
 const (
 	DefaultAPIQuota          = 20
 	DefaultRateLimitDuration = 30 * time.Minute
+	// RateLimitStoreRedis and RateLimitStoreMemory are where rate limit counters are kept:
+	// in Redis, shared by every instance, or in the memory of a single instance
+	RateLimitStoreRedis  = "redis"
+	RateLimitStoreMemory = "memory"
+	// RateLimitSweepInterval is how often expired rate limit state is removed from memory
+	RateLimitSweepInterval = time.Minute
+	// RateLimitFixedWindow, RateLimitSlidingWindow, RateLimitTokenBucket and RateLimitGCRA are the
+	// rate limiting algorithms: a quota per fixed window, a quota per window sliding with time
+	// (estimated from the counts of the current and previous fixed windows), a bucket of quota
+	// tokens refilled steadily over the window, and the generic cell rate algorithm
+	RateLimitFixedWindow   = "fixed_window"
+	RateLimitSlidingWindow = "sliding_window"
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitGCRA          = "gcra"
+)
+
+// Bulk Shortening Constants
+const (
+	// MaxBulkItems is the maximum number of URLs accepted by a single bulk request
+	MaxBulkItems = 1000
+)
+
+// Import and Export Constants
+const (
+	// MaxImportRows is the maximum number of rows read from a single import file
+	MaxImportRows = 100000
+	// MaxImportBytes is the maximum size of an import file uploaded through the API
+	MaxImportBytes = 10 << 20
+	// ExportBatchSize is the number of keys read per SCAN iteration during exports
+	ExportBatchSize    = 500
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
 )
 
 // URL Expiry Constants
@@ -20,12 +52,309 @@ const (
 	DefaultURLExpiryHours = 24
 )
 
+// Preview and Interstitial Constants
+const (
+	// PreviewSuffix is appended to a short code (e.g. /abc123+) to request the preview page
+	PreviewSuffix = "+"
+	// PreviewQueryParam is the query parameter (e.g. ?preview=1) that requests the preview page
+	PreviewQueryParam = "preview"
+	// DefaultInterstitialSeconds is the countdown shown before an interstitial redirects
+	DefaultInterstitialSeconds = 5
+)
+
+// QR Code Constants
+const (
+	QRFormatPNG     = "png"
+	QRFormatSVG     = "svg"
+	DefaultQRSize   = 256
+	MinQRSize       = 64
+	MaxQRSize       = 2048
+	DefaultQRLevel  = "M"
+	DefaultQRMargin = 4
+	MaxQRMargin     = 16
+	// QR codes are only cached briefly by the client, so they stop being served soon after
+	// their link is deleted, quarantined or changed
+	QRCacheControl = "private, max-age=300"
+)
+
+// URL Reputation Constants
+const (
+	BlocklistActionReject     = "reject"
+	BlocklistActionQuarantine = "quarantine"
+	// DefaultBlocklistReload is how often the blocklist file is checked for changes
+	DefaultBlocklistReload = 30 * time.Second
+	// MinBlocklistHashPrefix is the minimum number of hex digits in a hash-prefix rule
+	MinBlocklistHashPrefix = 8
+)
+
+// Destination Policy Constants
+const (
+	// DefaultAllowedSchemes are the destination URL schemes accepted when ALLOWED_SCHEMES is not set
+	DefaultAllowedSchemes = "http,https"
+
+	// DestinationLookupTimeout bounds the DNS lookup of a destination host
+	DestinationLookupTimeout = 2 * time.Second
+)
+
+// Shortener Chain Constants
+const (
+	ShortenerActionAllow  = "allow"
+	ShortenerActionBlock  = "block"
+	ShortenerActionUnwrap = "unwrap"
+	// DefaultKnownShorteners are the shortener hosts recognized when KNOWN_SHORTENERS is not set
+	DefaultKnownShorteners = "bit.ly,bitly.com,t.co,tinyurl.com,goo.gl,ow.ly,is.gd,v.gd,buff.ly,rebrand.ly,cutt.ly,shorturl.at,rb.gy,t.ly,tiny.cc,bl.ink,s.id,lnkd.in"
+	// MaxShortenerHops is the maximum number of shortener redirects followed when unwrapping
+	MaxShortenerHops = 5
+	// ShortenerUnwrapTimeout bounds each request made while unwrapping a shortener link
+	ShortenerUnwrapTimeout = 5 * time.Second
+	// ShortenerUnwrapBudget bounds the total time spent unwrapping shortener links for one
+	// API request; in bulk and import requests it is shared by all items
+	ShortenerUnwrapBudget = 10 * time.Second
+	// OutboundUserAgent identifies requests this service makes to other sites
+	OutboundUserAgent = "url-shortener/1.0"
+)
+
+// Health Check Constants
+const (
+	LinkHealthOK     = "ok"
+	LinkHealthBroken = "broken"
+	// HealthEventBroken and HealthEventRecovered are the events posted to the health webhook
+	HealthEventBroken    = "link.broken"
+	HealthEventRecovered = "link.recovered"
+	// HealthFailureThreshold is the number of consecutive failed probes after which a link is broken
+	HealthFailureThreshold = 2
+	// MaxHealthHistory is the number of health checks kept per link
+	MaxHealthHistory = 20
+	// HealthCheckTimeout bounds a single destination probe, including redirects
+	HealthCheckTimeout = 10 * time.Second
+	// DefaultHealthCheckConcurrency is the number of destinations probed in parallel
+	DefaultHealthCheckConcurrency = 8
+	// DefaultHealthCheckHostDelay is the minimum time between two probes of the same host
+	DefaultHealthCheckHostDelay = 2 * time.Second
+)
+
+// Abuse Report Constants
+const (
+	// DefaultReportQuarantineThreshold is the number of distinct reporters that quarantines a link
+	DefaultReportQuarantineThreshold = 5
+	// MaxReportDetails is the maximum length of the details of an abuse report
+	MaxReportDetails = 2000
+	// MaxReportsPerLink is the number of abuse reports kept per link
+	MaxReportsPerLink = 100
+	// ReviewRecentReports is the number of reports shown per link in the review queue
+	ReviewRecentReports = 5
+	// DefaultReviewQueueLimit and MaxReviewQueueLimit bound the number of links returned by the review queue
+	DefaultReviewQueueLimit = 50
+	MaxReviewQueueLimit     = 200
+	// MaxAuditEntries is the number of status changes kept per link
+	MaxAuditEntries = 100
+
+	AuditActionQuarantine = "quarantine"
+	AuditActionRestore    = "restore"
+	// AuditActorReports and AuditActorBlocklist are the actors of automatic status changes
+	AuditActorReports   = "reports"
+	AuditActorBlocklist = "blocklist"
+)
+
+// Click Time Series Constants
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+	// DefaultMinuteClickRetention is how long per-minute click buckets are kept
+	DefaultMinuteClickRetention = 48 * time.Hour
+	// DefaultHourClickRetention is how long per-hour click buckets are kept
+	DefaultHourClickRetention = 90 * 24 * time.Hour
+	// DefaultDayClickRetention is how long per-day click buckets are kept
+	DefaultDayClickRetention = 2 * 365 * 24 * time.Hour
+	// DefaultTimeseriesPoints is the number of buckets returned when no start is given
+	DefaultTimeseriesPoints = 24
+	// MaxTimeseriesPoints is the maximum number of buckets a time series may contain
+	MaxTimeseriesPoints = 2000
+)
+
+// Unique Visitor Constants
+const (
+	// DefaultVisitorDayRetention is how long per-day unique visitor counts are kept
+	DefaultVisitorDayRetention = 400 * 24 * time.Hour
+	// VisitorSaltLifetime is how long a day's fingerprint salt is kept; it outlives the
+	// day so clicks around midnight can still be attributed
+	VisitorSaltLifetime = 48 * time.Hour
+	// MaxVisitorDays is the maximum number of days a unique visitor query may span
+	MaxVisitorDays = 366
+	// VisitorStoreRedis and VisitorStoreMemory are where unique visitor HyperLogLogs are kept:
+	// in Redis, shared by every instance, or in the memory of a single instance
+	VisitorStoreRedis  = "redis"
+	VisitorStoreMemory = "memory"
+	// VisitorSweepInterval is how often expired unique visitor counts are removed from memory
+	VisitorSweepInterval = time.Hour
+)
+
+// Bot Traffic Constants
+const (
+	// TrafficHuman, TrafficBot and TrafficAll select which hits analytics report
+	TrafficHuman = "human"
+	TrafficBot   = "bot"
+	TrafficAll   = "all"
+	// BotReasonNoUserAgent, BotReasonHeadRequest and BotReasonPrefetch name bot hits
+	// recognized by the request rather than by a user agent signature
+	BotReasonNoUserAgent = "no user agent"
+	BotReasonHeadRequest = "head request"
+	BotReasonPrefetch    = "prefetch"
+)
+
+// Click Pipeline Constants
+const (
+	// DefaultClickQueueSize is the number of clicks that can wait to be recorded
+	DefaultClickQueueSize = 10000
+	// DefaultClickWorkers is the number of workers recording clicks
+	DefaultClickWorkers = 2
+	// DefaultClickBatchSize is the maximum number of clicks recorded in one round trip
+	DefaultClickBatchSize = 100
+	// DefaultClickFlushIntervalMs is the longest time in milliseconds a click waits for its batch
+	DefaultClickFlushIntervalMs = 250
+	// DefaultShutdownTimeout is how long shutdown waits for requests and queued clicks
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// Click Sink Constants
+const (
+	ClickSinkRedis   = "redis"
+	ClickSinkFile    = "file"
+	ClickSinkWebhook = "webhook"
+	// ClickSinkLive is the name of the in-process sink feeding live analytics streams
+	ClickSinkLive = "live"
+	// DefaultClickStreamMaxLen is the approximate maximum length of the click stream
+	DefaultClickStreamMaxLen = 1000000
+	// DefaultClickLogMaxMB is the size in megabytes at which a new click file is started
+	DefaultClickLogMaxMB = 100
+	// ClickWebhookTimeout is the timeout of posting a batch of clicks to the webhook
+	ClickWebhookTimeout = 10 * time.Second
+	// ClickSinkTimeout bounds each attempt to deliver a batch of clicks to one sink
+	ClickSinkTimeout = 15 * time.Second
+	// ClickSinkQueueSize is the number of batches waiting for a sink before batches are dropped for it
+	ClickSinkQueueSize = 64
+	// ClickSinkAttempts is how many times delivering a batch to a sink is tried before it is given up
+	ClickSinkAttempts = 3
+	// ClickSinkRetryBackoff is the wait before the first retry of a batch, doubled for each further retry
+	ClickSinkRetryBackoff = time.Second
+)
+
+// Live Analytics Constants
+const (
+	// MaxLiveSubscribers is the maximum number of open live analytics streams
+	MaxLiveSubscribers = 100
+	// MaxLiveSubscribersPerClient is the maximum number of open live analytics streams of one token
+	MaxLiveSubscribersPerClient = 10
+	// LiveSubscriberBuffer is the number of clicks buffered for a live stream before clicks are dropped
+	LiveSubscriberBuffer = 256
+	// AllAnalyticsDomains in ANALYTICS_TOKEN_DOMAINS gives an analytics client every short domain
+	AllAnalyticsDomains = "*"
+	// LiveHeartbeatInterval is how often an idle live stream sends a comment to keep the connection open
+	LiveHeartbeatInterval = 15 * time.Second
+)
+
+// Click Breakdown Constants
+const (
+	DimensionReferrer = "referrer"
+	DimensionBrowser  = "browser"
+	DimensionOS       = "os"
+	DimensionDevice   = "device"
+	DimensionLanguage = "language"
+
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+
+	// DimensionOther, DimensionDirect and DimensionUnknown are the values of clicks that
+	// cannot be classified, have no referrer, or have no language
+	DimensionOther   = "other"
+	DimensionDirect  = "direct"
+	DimensionUnknown = "unknown"
+
+	// MaxDimensionValues is the number of distinct values kept per link and dimension;
+	// further values are counted as "other"
+	MaxDimensionValues = 100
+	// MaxDimensionValueLength is the longest value stored for a dimension
+	MaxDimensionValueLength = 253
+	// DefaultBreakdownLimit and MaxBreakdownLimit bound the values returned per dimension
+	DefaultBreakdownLimit = 10
+	MaxBreakdownLimit     = MaxDimensionValues
+)
+
+// Analytics Summary Constants
+const (
+	// DefaultSummaryDays and MaxSummaryDays bound the window of the analytics summary in days
+	DefaultSummaryDays = 7
+	MaxSummaryDays     = 31
+	// DefaultTopLinks and MaxTopLinks bound the number of top links in the analytics summary
+	DefaultTopLinks = 10
+	MaxTopLinks     = 100
+)
+
+// Privacy Constants
+const (
+	// DoNotTrackIgnore, DoNotTrackAggregate and DoNotTrackSkip are the ways clicks of visitors
+	// sending DNT or Sec-GPC are recorded: like any click, only in aggregate counters, or not at all
+	DoNotTrackIgnore    = "ignore"
+	DoNotTrackAggregate = "aggregate"
+	DoNotTrackSkip      = "skip"
+	// AnonymizedIPv4Bits and AnonymizedIPv6Bits are the prefix lengths visitor IP addresses are truncated to
+	AnonymizedIPv4Bits = 24
+	AnonymizedIPv6Bits = 48
+	// PurgeBatchSize is the number of keys or stream entries examined per round trip when purging analytics
+	PurgeBatchSize = 1000
+	// PurgeJobRunning, PurgeJobDone and PurgeJobFailed are the states of a background analytics purge
+	PurgeJobRunning = "running"
+	PurgeJobDone    = "done"
+	PurgeJobFailed  = "failed"
+	// MaxPurgeJobs is the number of finished analytics purges kept for their status to be read
+	MaxPurgeJobs = 100
+)
+
+// Missed Short Code Constants
+const (
+	// MaxMissedCodes is the number of missed short codes tracked; once reached, a new code
+	// replaces the least missed one
+	MaxMissedCodes = 1000
+	// DefaultMissDays and MaxMissDays bound the window of daily miss counts in days
+	DefaultMissDays = 7
+	MaxMissDays     = 31
+	// DefaultMissLimit and MaxMissLimit bound the number of top missed codes returned
+	DefaultMissLimit = 20
+	MaxMissLimit     = MaxMissedCodes
+)
+
+// Link Status Constants
+const (
+	LinkStatusActive      = "active"
+	LinkStatusQuarantined = "quarantined"
+)
+
 // Error Messages
 const (
 	ErrorCannotParseJSON       = "cannot parse JSON"
 	ErrorRateLimitExceeded     = "Rate limit exceeded"
 	ErrorInvalidURL            = "Invalid URL"
 	ErrorURLShortInUse         = "URL short already in use"
+	ErrorInvalidShortCode      = "Short code may only contain letters, digits, '.', '_', '~' and '-' (max 64)"
+	ErrorUnknownDomain         = "Domain is not served by this instance"
+	ErrorBlockedURL            = "URL destination is blocked"
+	ErrorPrivateDestination    = "URL destination is a private or internal network address"
+	ErrorSchemeNotAllowed      = "URL scheme is not allowed"
+	ErrorUnresolvedDestination = "URL destination host could not be resolved"
+	ErrorShortenerURL          = "URL destination is a link on another URL shortener"
+	ErrorInvalidReport         = "Report reason must be one of phishing, malware, spam, scam, illegal or other"
+	ErrorAdminDisabled         = "Admin API is disabled"
+	ErrorUnauthorized          = "Unauthorized"
+	ErrorLiveUnavailable       = "Live analytics are unavailable, try again later"
+	ErrorAnalyticsDisabled     = "Analytics API is disabled"
+	ErrorPurgeJobNotFound      = "Purge not found"
+	ErrorLiveClientLimit       = "Too many live analytics streams are open for this token"
+	ErrorTokenInQuery          = "Tokens must be sent in the Authorization header, not the URL"
+	ErrorReservedShortCode     = "Short code is reserved"
+	ErrorDomainNotAllowed      = "Token is not allowed to access this domain"
 	ErrorUpdateRateLimitFailed = "Failed to update rate limit"
 	ShortUrlNotFoundOnDatabase = "Short Url not found on database"
 	CannotConnectToTheDB       = "Cannot connect to the DB"
@@ -45,6 +374,8 @@ const (
 	EnvAppPort = "APP_PORT"
 	// EnvDomain is the environment variable name for application domain
 	EnvDomain = "DOMAIN"
+	// EnvDomains is the environment variable name for the additional short domains
+	EnvDomains = "DOMAINS"
 	// EnvDBAddr is the environment variable name for database address
 	EnvDBAddr = "DB_ADDR"
 	// EnvDBPass is the environment variable name for database password
@@ -53,8 +384,135 @@ const (
 	EnvAPIQuota = "API_QUOTA"
 	// EnvRateLimitMinutes is the environment variable name for rate limit minutes
 	EnvRateLimitMinutes = "RATE_LIMIT_MINUTES"
+	// EnvRateLimitStore is the environment variable name for where rate limit counters are kept
+	EnvRateLimitStore = "RATE_LIMIT_STORE"
+	// EnvRateLimitAlgorithm is the environment variable name for the rate limiting algorithm
+	EnvRateLimitAlgorithm = "RATE_LIMIT_ALGORITHM"
+	// EnvBlocklistFile is the environment variable name for the destination blocklist file
+	EnvBlocklistFile = "BLOCKLIST_FILE"
+	// EnvBlocklistAction is the environment variable name for the blocklist action (reject or quarantine)
+	EnvBlocklistAction = "BLOCKLIST_ACTION"
+	// EnvBlocklistCheckOnResolve is the environment variable name for checking destinations on redirect
+	EnvBlocklistCheckOnResolve = "BLOCKLIST_CHECK_ON_RESOLVE"
+	// EnvBlocklistReloadSeconds is the environment variable name for the blocklist reload interval
+	EnvBlocklistReloadSeconds = "BLOCKLIST_RELOAD_SECONDS"
+	// EnvAllowedSchemes is the environment variable name for the destination URL scheme allowlist
+	EnvAllowedSchemes = "ALLOWED_SCHEMES"
+	// EnvBlockPrivateDestinations is the environment variable name for rejecting internal destinations
+	EnvBlockPrivateDestinations = "BLOCK_PRIVATE_DESTINATIONS"
+	// EnvPrivateDestinationAllowlist is the environment variable name for internal ranges allowed per domain
+	EnvPrivateDestinationAllowlist = "PRIVATE_DESTINATION_ALLOWLIST"
+	// EnvKnownShorteners is the environment variable name for the known URL shortener hosts
+	EnvKnownShorteners = "KNOWN_SHORTENERS"
+	// EnvShortenerAction is the environment variable name for the shortener action (allow, block or unwrap)
+	EnvShortenerAction = "SHORTENER_ACTION"
+	// EnvHealthCheckIntervalMinutes is the environment variable name for the destination health check interval
+	EnvHealthCheckIntervalMinutes = "HEALTH_CHECK_INTERVAL_MINUTES"
+	// EnvHealthCheckConcurrency is the environment variable name for the number of parallel probes
+	EnvHealthCheckConcurrency = "HEALTH_CHECK_CONCURRENCY"
+	// EnvHealthCheckHostDelaySeconds is the environment variable name for the delay between probes of a host
+	EnvHealthCheckHostDelaySeconds = "HEALTH_CHECK_HOST_DELAY_SECONDS"
+	// EnvHealthWebhookURL is the environment variable name for the broken link webhook
+	EnvHealthWebhookURL = "HEALTH_WEBHOOK_URL"
+	// EnvAdminTokens is the environment variable name for the admin API tokens (name:token pairs)
+	EnvAdminTokens = "ADMIN_TOKENS"
+	// EnvAnalyticsTokens is the environment variable name for the analytics tokens (name:token pairs)
+	EnvAnalyticsTokens = "ANALYTICS_TOKENS"
+	// EnvAnalyticsTokenDomains is the environment variable name for the short domains each analytics client is limited to
+	EnvAnalyticsTokenDomains = "ANALYTICS_TOKEN_DOMAINS"
+	// EnvReportQuarantineThreshold is the environment variable name for the reports that quarantine a link
+	EnvReportQuarantineThreshold = "REPORT_QUARANTINE_THRESHOLD"
+	// EnvMinuteClickRetentionHours is the environment variable name for the retention of per-minute clicks
+	EnvMinuteClickRetentionHours = "CLICKS_MINUTE_RETENTION_HOURS"
+	// EnvHourClickRetentionDays is the environment variable name for the retention of per-hour clicks
+	EnvHourClickRetentionDays = "CLICKS_HOUR_RETENTION_DAYS"
+	// EnvDayClickRetentionDays is the environment variable name for the retention of per-day clicks
+	EnvDayClickRetentionDays = "CLICKS_DAY_RETENTION_DAYS"
+	// EnvVisitorDayRetentionDays is the environment variable name for the retention of per-day unique visitors
+	EnvVisitorDayRetentionDays = "VISITORS_DAY_RETENTION_DAYS"
+	// EnvVisitorStore is the environment variable name for where unique visitor counts are kept
+	EnvVisitorStore = "VISITOR_STORE"
+	// EnvBotUserAgents is the environment variable name for extra bot user agent substrings
+	EnvBotUserAgents = "BOT_USER_AGENTS"
+	// EnvClickQueueSize is the environment variable name for the size of the click queue
+	EnvClickQueueSize = "CLICK_QUEUE_SIZE"
+	// EnvClickWorkers is the environment variable name for the number of click workers
+	EnvClickWorkers = "CLICK_WORKERS"
+	// EnvClickBatchSize is the environment variable name for the clicks recorded per round trip
+	EnvClickBatchSize = "CLICK_BATCH_SIZE"
+	// EnvClickFlushIntervalMs is the environment variable name for the click flush interval
+	EnvClickFlushIntervalMs = "CLICK_FLUSH_INTERVAL_MS"
+	// EnvShutdownTimeoutSeconds is the environment variable name for the graceful shutdown timeout
+	EnvShutdownTimeoutSeconds = "SHUTDOWN_TIMEOUT_SECONDS"
+	// EnvClickSinks is the environment variable name for the sinks clicks are delivered to
+	EnvClickSinks = "CLICK_SINKS"
+	// EnvClickStreamMaxLen is the environment variable name for the maximum length of the click stream
+	EnvClickStreamMaxLen = "CLICK_STREAM_MAXLEN"
+	// EnvClickLogDir is the environment variable name for the directory of click files
+	EnvClickLogDir = "CLICK_LOG_DIR"
+	// EnvClickLogMaxMB is the environment variable name for the size of click files
+	EnvClickLogMaxMB = "CLICK_LOG_MAX_MB"
+	// EnvClickWebhookURL is the environment variable name for the click webhook
+	EnvClickWebhookURL = "CLICK_WEBHOOK_URL"
+	// EnvCountryHeader is the environment variable name for the request header holding the visitor's country
+	EnvCountryHeader = "COUNTRY_HEADER"
+	// EnvAnonymizeIP is the environment variable name for truncating visitor IP addresses
+	EnvAnonymizeIP = "ANONYMIZE_IP"
+	// EnvDoNotTrack is the environment variable name for how clicks with DNT or Sec-GPC are recorded
+	EnvDoNotTrack = "DO_NOT_TRACK"
+	// EnvClickEventRetentionDays is the environment variable name for the retention of raw click events
+	EnvClickEventRetentionDays = "CLICK_EVENT_RETENTION_DAYS"
 )
 
+// Redis Key Names
 const (
 	Counter = "counter"
+	// LinkMetaPrefix prefixes the hash holding a short link's metadata (meta:<short_code>)
+	LinkMetaPrefix = "meta:"
+	// LinkHealthPrefix prefixes the list holding a short link's recent health checks (health:<short_code>)
+	LinkHealthPrefix = "health:"
+	// LinkReportsPrefix prefixes the list of a short link's abuse reports (reports:<short_code>)
+	LinkReportsPrefix = "reports:"
+	// LinkReportersPrefix prefixes the set of hashed reporters of a short link (reporters:<short_code>)
+	LinkReportersPrefix = "reporters:"
+	// LinkAuditPrefix prefixes the list of a short link's status changes (audit:<short_code>)
+	LinkAuditPrefix = "audit:"
+	// ReviewQueueKey is the sorted set of reported links awaiting review, scored by last report time
+	ReviewQueueKey = "review_queue"
+	// ReporterSecretKey holds the random secret keying the identifiers of abuse reporters, in the
+	// analytics database; no short code contains ':', so it can never be resolved as a link
+	ReporterSecretKey = "reporter:secret"
+	// LegacyReporterSecretKey is where the reporter secret used to be kept, among the links
+	LegacyReporterSecretKey = "reporter_secret"
+	// ClickBucketPrefix prefixes the hashes of time-bucketed clicks (clicks:<interval>:<short_code>:<window>)
+	ClickBucketPrefix = "clicks:"
+	// ClickDimensionPrefix prefixes the sorted sets of click breakdowns (dims:<dimension>:<short_code>)
+	ClickDimensionPrefix = "dims:"
+	// BotKeyPrefix prefixes the counter, access, clicks and dims keys of bot hits (bot_access:<short_code>);
+	// the unprefixed keys count human clicks
+	BotKeyPrefix = "bot_"
+	// ClickStreamKey is the Redis stream clicks are appended to by the redis click sink
+	ClickStreamKey = "click_events"
+	// VisitorsPrefix prefixes the HyperLogLogs of a link's unique visitors (visitors:<short_code>[:<YYYYMMDD>])
+	VisitorsPrefix = "visitors:"
+	// VisitorsTotalKey is the HyperLogLog of all unique visitors (visitors_total[:<YYYYMMDD>])
+	VisitorsTotalKey = "visitors_total"
+	// VisitorSaltPrefix prefixes the random salt of a day's visitor fingerprints (visitor_salt:<YYYYMMDD>)
+	VisitorSaltPrefix = "visitor_salt:"
+	// TopLinksPrefix prefixes the sorted sets of a day's human clicks per link (top_links:<YYYYMMDD>)
+	TopLinksPrefix = "top_links:"
+	// LinksCreatedKey counts the links created; links_created:<YYYYMMDD> counts a day's links
+	LinksCreatedKey = "links_created"
+	// LinkExpiriesKey is the sorted set of active links scored by expiry time (+inf for links that never expire)
+	LinkExpiriesKey = "link_expiries"
+	// LinksExpiredKey counts the links removed from link_expiries once expired
+	LinksExpiredKey = "links_expired"
+	// MissedCodesKey is the sorted set of the most requested unknown short codes, scored by requests
+	MissedCodesKey = "missed_codes"
+	// RateLimitPrefix prefixes the hashes of clients' rate limit state (rate_limit:<algorithm>:<client_ip>)
+	RateLimitPrefix = "rate_limit:"
+	// MissCounter counts requests for unknown short codes; miss_counter:<YYYYMMDD> counts a day's
+	MissCounter = "miss_counter"
+	// MissedCodesDayPrefix prefixes the HyperLogLogs of a day's distinct unknown short codes (missed_codes:<YYYYMMDD>)
+	MissedCodesDayPrefix = "missed_codes:"
 )
@@ -53,6 +53,24 @@ func Get(client *redis.Client, key string) (string, error) {
 	return client.Get(Ctx, key).Result()
 }
 
+// SetHash stores the given fields in a Redis hash with an optional expiry time.
+// The fields and the expiry are applied atomically so a hash never outlives its TTL.
+func SetHash(client *redis.Client, key string, fields map[string]interface{}, expiry time.Duration) error {
+	pipe := client.TxPipeline()
+	pipe.HSet(Ctx, key, fields)
+	if expiry > 0 {
+		pipe.Expire(Ctx, key, expiry)
+	}
+	_, err := pipe.Exec(Ctx)
+	return err
+}
+
+// GetHash retrieves all fields of a Redis hash.
+// An empty map is returned if the key does not exist.
+func GetHash(client *redis.Client, key string) (map[string]string, error) {
+	return client.HGetAll(Ctx, key).Result()
+}
+
 // Increment increments a counter in Redis.
 // If the counter doesn't exist, Redis will create it starting from 0 → 1.
 func Increment(client *redis.Client, key string) error {
@@ -64,6 +82,11 @@ func Decrement(client *redis.Client, key string) error {
 	return client.Decr(Ctx, key).Err()
 }
 
+// DecrementBy decrements a counter in Redis by the given amount.
+func DecrementBy(client *redis.Client, key string, amount int64) error {
+	return client.DecrBy(Ctx, key, amount).Err()
+}
+
 // GetTTL returns the time-to-live for a key.
 func GetTTL(client *redis.Client, key string) (time.Duration, error) {
 	return client.TTL(Ctx, key).Result()
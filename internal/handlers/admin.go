@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// adminTokens maps admin API tokens to the names of their admins
+var adminTokens = config.Load().AdminTokens
+
+// purgeJobs runs analytics purges in the background
+var purgeJobs = services.NewPurgeJobs(urlService)
+
+// adminContextKey is the gin context key holding the name of the authenticated admin
+const adminContextKey = "admin"
+
+// RequireAdmin authenticates admin API requests with an "Authorization: Bearer <token>"
+// header matching one of ADMIN_TOKENS, and stores the admin's name for audit trails.
+// The admin API is disabled when no tokens are configured.
+func RequireAdmin(c *gin.Context) {
+	if len(adminTokens) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": constants.ErrorAdminDisabled,
+		})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if name, ok := matchToken(adminTokens, token); ok {
+		c.Set(adminContextKey, name)
+		c.Next()
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": constants.ErrorUnauthorized,
+	})
+}
+
+// matchToken returns the name of the client a token belongs to. Every candidate is
+// compared in constant time so the comparison does not leak how much of a token matched.
+func matchToken(tokens map[string]string, token string) (string, bool) {
+	for candidate, name := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// adminStatusRequest represents the optional request body of admin status changes.
+type adminStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+// GetReviewQueue returns reported links awaiting review, most recently reported first.
+// This is the main handler for GET /api/v1/admin/reports requests.
+// The limit query parameter caps the number of links returned, up to MaxReviewQueueLimit.
+func GetReviewQueue(c *gin.Context) {
+	limit := constants.DefaultReviewQueueLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxReviewQueueLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", constants.MaxReviewQueueLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	items, err := urlService.ReviewQueue(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"links": items,
+	})
+}
+
+// QuarantineLink puts a link in quarantine, so visitors see a warning instead of being redirected.
+// This is the main handler for POST /api/v1/admin/links/:code/quarantine requests.
+func QuarantineLink(c *gin.Context) {
+	changeLinkStatus(c, urlService.QuarantineLink)
+}
+
+// RestoreLink makes a quarantined link redirect again and dismisses its abuse reports.
+// This is the main handler for POST /api/v1/admin/links/:code/restore requests.
+func RestoreLink(c *gin.Context) {
+	changeLinkStatus(c, urlService.RestoreLink)
+}
+
+// changeLinkStatus applies an admin status change to the link named by the request.
+// The body may give a reason, which is recorded in the link's audit trail.
+func changeLinkStatus(c *gin.Context, change func(domain, shortCode, actor, reason string) (*services.Link, error)) {
+	var body adminStatusRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": constants.ErrorCannotParseJSON,
+			})
+			return
+		}
+	}
+
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	link, err := change(domain, c.Param("code"), c.GetString(adminContextKey), body.Reason)
+	if err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domain":        link.Domain,
+		"short":         link.ShortCode,
+		"url":           link.URL,
+		"status":        link.Status,
+		"status_reason": link.StatusReason,
+	})
+}
+
+// GetLinkAudit returns the status changes of a link and who made them, newest first.
+// This is the main handler for GET /api/v1/admin/links/:code/audit requests.
+func GetLinkAudit(c *gin.Context) {
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	shortCode := c.Param("code")
+	link, err := urlService.GetLink(domain, shortCode)
+	if err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	trail, err := urlService.GetAuditTrail(domain, shortCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domain":  domain,
+		"short":   shortCode,
+		"status":  link.Status,
+		"reports": link.ReportCount,
+		"audit":   trail,
+	})
+}
+
+// GetClickPipelineStats returns the queue length and the enqueued, dropped, recorded and failed
+// click counters of the click pipeline.
+// This is the main handler for GET /api/v1/admin/clicks requests.
+func GetClickPipelineStats(c *gin.Context) {
+	c.JSON(http.StatusOK, clickPipeline.Stats())
+}
+
+// GetMissedCodes returns the requests for short codes that do not map to a link, in total and
+// per day, with the most requested codes.
+// This is the main handler for GET /api/v1/admin/misses requests.
+// Supported query parameters: days (1-31, default 7) and limit (default 20).
+func GetMissedCodes(c *gin.Context) {
+	days := constants.DefaultMissDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxMissDays {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("days must be between 1 and %d", constants.MaxMissDays),
+			})
+			return
+		}
+		days = parsed
+	}
+
+	limit := constants.DefaultMissLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxMissLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", constants.MaxMissLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	stats, err := urlService.GetMissStats(days, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// PurgeAnalytics starts removing the analytics of a short URL, or of every short URL on a
+// domain, in the background, and responds with 202 and the purge, whose status can be read
+// from the URL in the Location header.
+// This is the main handler for DELETE /api/v1/admin/analytics/:code requests, where the
+// domain query parameter selects the short domain, and DELETE /api/v1/admin/analytics requests,
+// where it is required and selects the domain to purge.
+func PurgeAnalytics(c *gin.Context) {
+	shortCode := c.Param("code")
+	if shortCode == "" && c.Query("domain") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Domain is required",
+		})
+		return
+	}
+
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	job := purgeJobs.Start(domain, shortCode, c.GetString(adminContextKey))
+	c.Header("Location", "/api/v1/admin/analytics/purges/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetPurgeJob returns the status of an analytics purge and, once done, what it removed.
+// This is the main handler for GET /api/v1/admin/analytics/purges/:id requests.
+func GetPurgeJob(c *gin.Context) {
+	job, ok := purgeJobs.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": constants.ErrorPurgeJobNotFound,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
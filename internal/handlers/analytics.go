@@ -1,22 +1,51 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
 // GetAnalytics returns the total redirect count and other analytics data.
 // This endpoint provides access to service-wide analytics metrics.
+// Supported query parameters: from and to select the days of unique visitor counts (default today),
+// traffic selects human clicks (default), bot hits or all.
+// Clients limited to some short domains cannot read service-wide analytics.
 func GetAnalytics(c *gin.Context) {
-	if err := rateLimitService.CheckRateLimit(c.ClientIP()); err != nil {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "Rate limit exceeded",
+	if !checkAllDomainsAllowed(c) || !checkRateLimit(c) {
+		return
+	}
+
+	query, err := analyticsService.ParseVisitorQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	traffic, err := services.ParseTraffic(c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	count, err := analyticsService.GetRedirectCount(traffic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve analytics data",
 		})
 		return
 	}
 
-	count, err := analyticsService.GetRedirectCount()
+	visitors, err := analyticsService.GetUniqueVisitors("", query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve analytics data",
@@ -26,17 +55,150 @@ func GetAnalytics(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"total_redirects": count,
+		"traffic":         traffic,
+		"visitors":        visitors,
 		"message":         "Analytics data retrieved successfully",
 	})
 }
 
-// GetShortURLAnalytics returns the access count for a specific short URL.
+// GetAnalyticsSummary returns the top links by human clicks over a window of days, the number of
+// links created, active and expired, and the link creation rate.
+// This is the main handler for GET /api/v1/analytics/summary requests.
+// Supported query parameters: days (1-31, default 7) selects the window, ending today (UTC),
+// and limit the number of top links (default 10).
+// Clients limited to some short domains cannot read the summary, which spans every domain.
+func GetAnalyticsSummary(c *gin.Context) {
+	if !checkAllDomainsAllowed(c) || !checkRateLimit(c) {
+		return
+	}
+
+	days := constants.DefaultSummaryDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxSummaryDays {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("days must be between 1 and %d", constants.MaxSummaryDays),
+			})
+			return
+		}
+		days = parsed
+	}
+
+	limit := constants.DefaultTopLinks
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxTopLinks {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", constants.MaxTopLinks),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	summary, err := urlService.GetSummary(days, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve analytics summary",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ExportClicks streams the daily clicks of every link matching the filter as CSV or NDJSON,
+// one row per link and day with clicks.
+// This is the main handler for GET /api/v1/analytics/export requests.
+// Supported query parameters: format (csv|ndjson), from and to (RFC 3339, YYYY-MM-DD or Unix seconds;
+// by default the last 24 days), traffic (human|bot|all, default human), breakdowns=1 to add each
+// link's lifetime referrer, browser, OS, device and language breakdowns, and the link filters of
+// the link export (domain, tag, host, created_after, created_before and health).
+// Clients limited to some short domains only receive the links on those domains.
+func ExportClicks(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	filter, err := urlService.ParseLinkFilter(
+		c.Query("domain"),
+		c.Query("tag"),
+		c.Query("host"),
+		c.Query("created_after"),
+		c.Query("created_before"),
+		c.Query("health"),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter.Domains = analyticsDomains(c)
+	if filter.Domain != "" && !domainAllowed(filter.Domains, filter.Domain) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": constants.ErrorDomainNotAllowed,
+		})
+		return
+	}
+
+	query, err := analyticsService.ParseTimeseriesQuery(c.Query("from"), c.Query("to"), constants.IntervalDay, c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	breakdowns := c.Query("breakdowns") == "1" || c.Query("breakdowns") == "true"
+
+	format := c.DefaultQuery("format", constants.ExportFormatCSV)
+	writer, err := services.NewClickExportWriter(c.Writer, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == constants.ExportFormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="clicks.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// Flush periodically so clients receive data while the export is still running
+	written := 0
+	err = urlService.ExportClicks(filter, query, breakdowns, func(row *services.ClickExportRow) error {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+		written++
+		if written%constants.ExportBatchSize == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Click export failed after %d rows: %v", written, err)
+	}
+}
+
+// GetShortURLAnalytics returns the access count and unique visitors for a specific short URL.
 // This endpoint provides analytics for individual short URLs.
+// Supported query parameters: from and to select the days of unique visitor counts (default today),
+// traffic selects human clicks (default), bot hits or all. Unique visitors are always human.
 func GetShortURLAnalytics(c *gin.Context) {
-	if err := rateLimitService.CheckRateLimit(c.ClientIP()); err != nil {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "Rate limit exceeded",
-		})
+	if !checkRateLimit(c) {
 		return
 	}
 
@@ -48,7 +210,43 @@ func GetShortURLAnalytics(c *gin.Context) {
 		return
 	}
 
-	count, err := analyticsService.GetShortURLAccessCount(shortCode)
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !checkDomainAllowed(c, domain) {
+		return
+	}
+
+	query, err := analyticsService.ParseVisitorQuery(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	traffic, err := services.ParseTraffic(c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	linkKey := urlService.LinkKey(domain, shortCode)
+	count, err := analyticsService.GetShortURLAccessCount(linkKey, traffic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve short URL analytics",
+		})
+		return
+	}
+
+	visitors, err := analyticsService.GetUniqueVisitors(linkKey, query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve short URL analytics",
@@ -58,7 +256,118 @@ func GetShortURLAnalytics(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"short_code":   shortCode,
+		"domain":       domain,
 		"access_count": count,
+		"traffic":      traffic,
+		"visitors":     visitors,
 		"message":      "Short URL analytics retrieved successfully",
 	})
 }
+
+// GetShortURLTimeseries returns the clicks of a specific short URL per time bucket.
+// This is the main handler for GET /api/v1/analytics/:url/timeseries requests.
+// Supported query parameters: interval (minute|hour|day), from and to (RFC 3339, YYYY-MM-DD
+// or Unix seconds), traffic (human|bot|all, default human) and domain to select the short domain.
+// The series is zero-filled.
+func GetShortURLTimeseries(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	shortCode := c.Param("url")
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !checkDomainAllowed(c, domain) {
+		return
+	}
+
+	query, err := analyticsService.ParseTimeseriesQuery(c.Query("from"), c.Query("to"), c.Query("interval"), c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	series, err := analyticsService.GetClickTimeseries(urlService.LinkKey(domain, shortCode), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve short URL analytics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"short_code": shortCode,
+		"domain":     domain,
+		"interval":   series.Interval,
+		"traffic":    series.Traffic,
+		"from":       series.From,
+		"to":         series.To,
+		"total":      series.Total,
+		"points":     series.Points,
+	})
+}
+
+// GetShortURLBreakdown returns the top referrers, browsers, operating systems, device classes
+// and languages of the clicks on a specific short URL.
+// This is the main handler for GET /api/v1/analytics/:url/breakdown requests.
+// Supported query parameters: limit (values per dimension), traffic (human|bot|all, default human)
+// and domain to select the short domain.
+func GetShortURLBreakdown(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	shortCode := c.Param("url")
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !checkDomainAllowed(c, domain) {
+		return
+	}
+
+	traffic, err := services.ParseTraffic(c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	limit := constants.DefaultBreakdownLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > constants.MaxBreakdownLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("limit must be between 1 and %d", constants.MaxBreakdownLimit),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	breakdowns, err := analyticsService.GetClickBreakdowns(urlService.LinkKey(domain, shortCode), limit, traffic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve short URL analytics",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"short_code": shortCode,
+		"domain":     domain,
+		"traffic":    traffic,
+		"breakdowns": breakdowns,
+	})
+}
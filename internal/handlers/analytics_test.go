@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetShortURLTimeseries(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	saved := analyticsTokenDomains
+	defer func() { analyticsTokenDomains = saved }()
+	analyticsTokenDomains = map[string][]string{"acme": {"go.acme.com"}}
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	err := analyticsService.TrackClicks([]*services.ClickEvent{
+		{LinkKey: "promo", ShortCode: "promo", Time: now, UserAgent: "Mozilla/5.0 Firefox/127.0", VisitorIP: "203.0.113.7"},
+		{LinkKey: "promo", ShortCode: "promo", Time: now.Add(-time.Hour), UserAgent: "Mozilla/5.0 Firefox/127.0", VisitorIP: "203.0.113.8"},
+	})
+	if err != nil {
+		t.Fatalf("TrackClicks = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		key    string
+		client string
+		query  string
+		status int
+		total  int64
+		points int
+	}{
+		{"last day by hour", adminContextKey, "alice", "", http.StatusOK, 2, constants.DefaultTimeseriesPoints},
+		{"last hour by minute", adminContextKey, "alice", "?interval=minute&from=" + now.Add(-time.Hour).Format(time.RFC3339) + "&to=" + now.Format(time.RFC3339), http.StatusOK, 2, 61},
+		{"invalid interval", adminContextKey, "alice", "?interval=week", http.StatusBadRequest, 0, 0},
+		{"client of another domain", analyticsClientContextKey, "acme", "", http.StatusForbidden, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			app := gin.New()
+			app.GET("/api/v1/analytics/:url/timeseries", func(c *gin.Context) {
+				c.Set(tt.key, tt.client)
+			}, GetShortURLTimeseries)
+
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/analytics/promo/timeseries"+tt.query, nil))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var body struct {
+				Total  int64                       `json:"total"`
+				Points []*services.TimeseriesPoint `json:"points"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding %s: %v", recorder.Body, err)
+			}
+			if body.Total != tt.total || len(body.Points) != tt.points {
+				t.Errorf("series of %d points with %d clicks, want %d points with %d", len(body.Points), body.Total, tt.points, tt.total)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// BulkShortenURL handles batch URL shortening requests.
+// This is the main handler for POST /api/v1/bulk requests; the body is a JSON array
+// of the same objects accepted by POST /api/v1.
+//
+// Quota accounting: every item counts as one request. The whole batch is taken from
+// the client's quota up front, and rejected if the remaining quota cannot cover all
+// items; the items that were not created are given back afterwards.
+func BulkShortenURL(c *gin.Context) {
+	var body []services.ShortenURLRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": constants.ErrorCannotParseJSON,
+		})
+		return
+	}
+
+	if len(body) == 0 || len(body) > constants.MaxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Bulk requests must contain between 1 and %d items", constants.MaxBulkItems),
+		})
+		return
+	}
+
+	// Take the batch from the quota BEFORE processing it
+	reservation := reserveQuota(c, len(body))
+	if reservation == nil {
+		return
+	}
+	defer reservation.release()
+
+	reqs := make([]*services.ShortenURLRequest, len(body))
+	for i := range body {
+		reqs[i] = &body[i]
+	}
+
+	results, err := urlService.ShortenURLs(reqs)
+	if err != nil {
+		reservation.fail(http.StatusInternalServerError, gin.H{
+			"error": "Failed to shorten URLs",
+		})
+		return
+	}
+
+	created := 0
+	for _, result := range results {
+		if result.Error == "" {
+			created++
+		}
+	}
+
+	// Only created links consume quota; the reset is reported in whole minutes
+	rateLimitInfo := reservation.keep(created)
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":          results,
+		"created":          created,
+		"failed":           len(results) - created,
+		"rate_limit":       rateLimitInfo.Remaining,
+		"rate_limit_reset": rateLimitInfo.Reset / time.Minute,
+	})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// requestDomain returns the short domain an API request refers to.
+// The ?domain= query parameter selects a domain explicitly, which lets API clients on the
+// primary host address links on other domains; otherwise the request's Host header is used.
+func requestDomain(c *gin.Context) (string, error) {
+	if domain := c.Query("domain"); domain != "" {
+		return urlService.LookupDomain(domain)
+	}
+	return urlService.DomainForHost(c.Request.Host), nil
+}
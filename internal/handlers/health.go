@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetLinkHealth returns the destination health of a link and its recent health checks, newest first.
+// This is the main handler for GET /api/v1/links/:code/health requests.
+// The domain query parameter selects the short domain when it differs from the request's host.
+func GetLinkHealth(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	shortCode := c.Param("code")
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	link, err := urlService.GetLink(domain, shortCode)
+	if err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	history, err := urlService.GetHealthHistory(domain, shortCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"domain":  domain,
+		"short":   shortCode,
+		"url":     link.URL,
+		"health":  link.Health,
+		"history": history,
+	}
+	if !link.HealthCheckedAt.IsZero() {
+		response["checked_at"] = link.HealthCheckedAt
+	}
+	c.JSON(http.StatusOK, response)
+}
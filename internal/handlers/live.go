@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// analyticsTokens maps analytics tokens to the names of their clients
+var analyticsTokens = config.Load().AnalyticsTokens
+
+// analyticsTokenDomains maps analytics clients to the short domain hosts they may access
+var analyticsTokenDomains = config.Load().AnalyticsTokenDomains
+
+// analyticsClientContextKey is the gin context key holding the name of the authenticated analytics client
+const analyticsClientContextKey = "analytics_client"
+
+// clickBroker fans recorded clicks out to live analytics streams
+var clickBroker = services.NewClickBroker()
+
+// CloseLiveStreams ends the open live analytics streams, which would otherwise keep
+// the server from shutting down.
+func CloseLiveStreams() {
+	_ = clickBroker.Close()
+}
+
+// RequireAnalyticsToken authenticates analytics requests with a token from ANALYTICS_TOKENS or
+// ADMIN_TOKENS, given as an "Authorization: Bearer <token>" header.
+// Tokens in the query string are refused, since URLs end up in access logs and browser history.
+// The analytics API is disabled when no tokens are configured.
+func RequireAnalyticsToken(c *gin.Context) {
+	if len(analyticsTokens) == 0 && len(adminTokens) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": constants.ErrorAnalyticsDisabled,
+		})
+		return
+	}
+
+	if _, ok := c.GetQuery("token"); ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": constants.ErrorTokenInQuery,
+		})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if name, ok := matchToken(analyticsTokens, token); ok {
+		c.Set(analyticsClientContextKey, name)
+		c.Next()
+		return
+	}
+	if name, ok := matchToken(adminTokens, token); ok {
+		c.Set(adminContextKey, name)
+		c.Next()
+		return
+	}
+
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error": constants.ErrorUnauthorized,
+	})
+}
+
+// analyticsDomains returns the short domains the authenticated analytics client may access by
+// ANALYTICS_TOKEN_DOMAINS, or nil if it may access every domain, as admins and clients given
+// "*" may. Clients without an entry may access no domain, so a forgotten entry fails closed.
+// Configured hosts that are not served by this instance are ignored.
+func analyticsDomains(c *gin.Context) []string {
+	client, ok := c.Get(analyticsClientContextKey)
+	if !ok {
+		return nil
+	}
+	domains := []string{}
+	for _, host := range analyticsTokenDomains[client.(string)] {
+		if host == constants.AllAnalyticsDomains {
+			return nil
+		}
+		if domain, err := urlService.LookupDomain(host); err == nil {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// domainAllowed reports whether a short domain is within the domains of an analytics client.
+func domainAllowed(domains []string, domain string) bool {
+	if domains == nil {
+		return true
+	}
+	for _, allowed := range domains {
+		if allowed == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDomainAllowed responds with 403 and returns false if the analytics client may not
+// access a short domain.
+func checkDomainAllowed(c *gin.Context, domain string) bool {
+	if domainAllowed(analyticsDomains(c), domain) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": constants.ErrorDomainNotAllowed,
+	})
+	return false
+}
+
+// checkAllDomainsAllowed responds with 403 and returns false if the analytics client is
+// limited to some short domains, for analytics spanning every domain.
+func checkAllDomainsAllowed(c *gin.Context) bool {
+	if analyticsDomains(c) == nil {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error": constants.ErrorDomainNotAllowed,
+	})
+	return false
+}
+
+// StreamShortURLClicks streams the clicks of a specific short URL as Server-Sent Events.
+// This is the main handler for GET /api/v1/analytics/:url/live requests.
+// Supported query parameters: traffic (human|bot|all, default human) and domain to select the short domain.
+func StreamShortURLClicks(c *gin.Context) {
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !checkDomainAllowed(c, domain) {
+		return
+	}
+	streamClicks(c, domain, c.Param("url"))
+}
+
+// StreamClicks streams the clicks of all short URLs as Server-Sent Events.
+// This is the main handler for GET /api/v1/live requests.
+// Supported query parameters: traffic (human|bot|all, default human).
+// Clients limited to some short domains cannot follow every link.
+func StreamClicks(c *gin.Context) {
+	if !checkAllDomainsAllowed(c) {
+		return
+	}
+	streamClicks(c, "", "")
+}
+
+// liveClient identifies the authenticated token for the live stream limit of each client.
+// Analytics clients and admins are named apart, so they cannot share a limit by sharing a name.
+func liveClient(c *gin.Context) string {
+	if name, ok := c.Get(analyticsClientContextKey); ok {
+		return "analytics:" + name.(string)
+	}
+	return "admin:" + c.GetString(adminContextKey)
+}
+
+// streamClicks streams clicks until the client disconnects or the server shuts down.
+// Each click is a "click" event holding a click record. When the client reads too slowly,
+// clicks are dropped and a "dropped" event with their number precedes the next click.
+// Comments are sent while idle so proxies keep the connection open.
+func streamClicks(c *gin.Context, domain, shortCode string) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	traffic, err := services.ParseTraffic(c.Query("traffic"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	sub, err := clickBroker.Subscribe(liveClient(c), domain, shortCode, traffic)
+	if errors.Is(err, services.ErrLiveClientLimit) {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer clickBroker.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(constants.LiveHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case record, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if dropped := sub.TakeDropped(); dropped > 0 {
+				c.SSEvent("dropped", gin.H{"count": dropped})
+			}
+			c.SSEvent("click", record)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
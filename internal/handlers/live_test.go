@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAnalyticsDomains(t *testing.T) {
+	domain := urlService.Domains()[0]
+	saved := analyticsTokenDomains
+	defer func() { analyticsTokenDomains = saved }()
+	analyticsTokenDomains = map[string][]string{
+		"acme":     {"unknown.example.com", domain},
+		"internal": {"*"},
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		client  string
+		want    []string
+		allowed bool // Whether the client may read analytics spanning every domain
+	}{
+		{"limited client", analyticsClientContextKey, "acme", []string{domain}, false},
+		{"client given every domain", analyticsClientContextKey, "internal", nil, true},
+		{"client without an entry", analyticsClientContextKey, "globex", []string{}, false},
+		{"admin", adminContextKey, "alice", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Set(tt.key, tt.client)
+
+			if got := analyticsDomains(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("analyticsDomains = %#v, want %#v", got, tt.want)
+			}
+			if got := checkAllDomainsAllowed(c); got != tt.allowed {
+				t.Errorf("checkAllDomainsAllowed = %v, want %v", got, tt.allowed)
+			}
+			if !tt.allowed && recorder.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
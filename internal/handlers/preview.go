@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// previewTemplate renders the preview and interstitial pages for a short link.
+// When Countdown is greater than zero the page redirects automatically once it reaches zero.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+{{if and (gt .Countdown 0) .Href}}<meta http-equiv="refresh" content="{{.Countdown}};url={{.Href}}">{{end}}
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; max-width: 40rem; margin: 4rem auto; padding: 0 1rem; color: #222; }
+.destination { word-break: break-all; padding: 0.75rem; background: #f4f4f4; border-radius: 4px; }
+.meta { color: #666; font-size: 0.9rem; }
+.warning { padding: 0.75rem; margin-bottom: 1rem; background: #fdecea; border: 1px solid #f5c2c0; border-radius: 4px; color: #8a1c14; }
+a.button { display: inline-block; margin-top: 1rem; padding: 0.5rem 1rem; background: #0366d6; color: #fff; text-decoration: none; border-radius: 4px; }
+</style>
+</head>
+<body>
+{{if .Warning}}<div class="warning"><strong>Warning:</strong> this link has been flagged as potentially harmful and is under review. Only continue if you trust the destination.</div>{{end}}
+<h1>{{if .Title}}{{.Title}}{{else}}This short link leads to{{end}}</h1>
+<p class="destination">{{.URL}}</p>
+<p class="meta">Short code: {{.ShortCode}}{{if .CreatedAt}} &middot; Created {{.CreatedAt}}{{end}}</p>
+{{if and (gt .Countdown 0) .Href}}<p>You will be redirected in <span id="countdown">{{.Countdown}}</span> seconds.</p>{{end}}
+{{if .Href}}<a class="button" href="{{.Href}}" rel="noopener noreferrer nofollow">{{if .Warning}}Continue at your own risk{{else}}Continue to destination{{end}}</a>{{end}}
+{{if and (gt .Countdown 0) .Href}}<script>
+(function () {
+	var remaining = {{.Countdown}};
+	var el = document.getElementById("countdown");
+	var timer = setInterval(function () {
+		remaining--;
+		if (remaining <= 0) {
+			clearInterval(timer);
+			window.location.replace({{.Href}});
+			return;
+		}
+		el.textContent = remaining;
+	}, 1000);
+})();
+</script>{{end}}
+</body>
+</html>
+`))
+
+// previewPage holds the data rendered by previewTemplate.
+type previewPage struct {
+	ShortCode string
+	URL       string
+	Href      string // URL to link and redirect to; empty unless it is an http or https URL
+	Title     string
+	CreatedAt string
+	Countdown int  // Seconds before redirecting; zero disables the automatic redirect
+	Warning   bool // Whether the link is quarantined and the page must warn the visitor
+}
+
+// isPreviewRequest reports whether the client asked for the preview page instead of a redirect,
+// either with a trailing "+" on the short code or with ?preview=1.
+func isPreviewRequest(c *gin.Context, shortCode string) bool {
+	if strings.HasSuffix(shortCode, constants.PreviewSuffix) {
+		return true
+	}
+	preview := c.Query(constants.PreviewQueryParam)
+	return preview == "1" || preview == "true"
+}
+
+// previewHref returns the destination if the page may link or redirect to it, which is only
+// for http and https URLs. The scheme is checked again when rendering, rather than trusting it
+// was checked when the link was created, because the page also redirects from script and a
+// meta refresh, which the template does not sanitize.
+func previewHref(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if scheme := strings.ToLower(parsed.Scheme); scheme != "http" && scheme != "https" {
+		return ""
+	}
+	return rawURL
+}
+
+// renderPreview renders the preview page for a link.
+// A countdown of zero renders a static preview; otherwise the page redirects after the countdown.
+func renderPreview(c *gin.Context, link *services.Link, countdown int) {
+	page := previewPage{
+		ShortCode: link.ShortCode,
+		URL:       link.URL,
+		Href:      previewHref(link.URL),
+		Title:     link.Title,
+		Countdown: countdown,
+	}
+	if !link.CreatedAt.IsZero() {
+		page.CreatedAt = link.CreatedAt.Format("January 2, 2006 15:04 MST")
+	}
+
+	// Previews must never be cached, otherwise a later redirect could be served from cache
+	c.Header("Cache-Control", "no-store")
+	c.Render(http.StatusOK, render.HTML{
+		Template: previewTemplate,
+		Name:     "preview",
+		Data:     page,
+	})
+}
+
+// renderWarning renders the warning page for a quarantined link.
+// The page never redirects automatically.
+func renderWarning(c *gin.Context, link *services.Link) {
+	page := previewPage{
+		ShortCode: link.ShortCode,
+		URL:       link.URL,
+		Href:      previewHref(link.URL),
+		Title:     link.Title,
+		Warning:   true,
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Render(http.StatusOK, render.HTML{
+		Template: previewTemplate,
+		Name:     "preview",
+		Data:     page,
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPreviewHref(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/path?q=1", "https://example.com/path?q=1"},
+		{"HTTP://example.com/", "HTTP://example.com/"},
+		{"javascript:alert(1)", ""},
+		{"JavaScript:alert(1)", ""},
+		{"data:text/html,<script>alert(1)</script>", ""},
+		{"myapp://open/item", ""},
+		{"%zz", ""},
+	}
+	for _, tt := range tests {
+		if got := previewHref(tt.url); got != tt.want {
+			t.Errorf("previewHref(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestRenderPreviewDoesNotLinkToScripts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	renderPreview(c, &services.Link{ShortCode: "abc", URL: "javascript:alert(document.cookie)"}, 5)
+
+	body := recorder.Body.String()
+	if strings.Contains(body, "href=\"javascript:") {
+		t.Errorf("preview page links to the javascript: URL:\n%s", body)
+	}
+	if strings.Contains(body, "http-equiv=\"refresh\"") || strings.Contains(body, "location.replace") {
+		t.Errorf("preview page redirects to a non-web URL:\n%s", body)
+	}
+}
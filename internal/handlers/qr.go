@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// qrService is a shared instance of the QR code service
+var qrService = services.NewQRService()
+
+// GetQRCode returns a QR code encoding the complete short URL of a link.
+// This is the main handler for GET /api/v1/links/:code/qr requests.
+// Supported query parameters: format (png|svg), size (pixels), level (L|M|Q|H),
+// margin (modules), fg and bg (hex colors such as 000000 or ffffff00), and domain
+// to select the short domain when it differs from the request's host.
+func GetQRCode(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	shortCode := c.Param("code")
+	domain, err := requestDomain(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	opts, err := services.ParseQROptions(
+		c.Query("format"),
+		c.Query("size"),
+		c.Query("level"),
+		c.Query("margin"),
+		c.Query("fg"),
+		c.Query("bg"),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only generate codes for links that exist
+	if _, err := urlService.GetOriginalURL(domain, shortCode); err != nil {
+		if errors.Is(err, services.ErrLinkNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve URL",
+		})
+		return
+	}
+
+	data, contentType, err := qrService.Generate(urlService.ShortURL(domain, shortCode), opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to generate QR code",
+		})
+		return
+	}
+
+	c.Header("Cache-Control", constants.QRCacheControl)
+	c.Data(http.StatusOK, contentType, data)
+}
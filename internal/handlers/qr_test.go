@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetQRCode(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	_ = server.Set("home", "https://example.com/")
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	app.GET("/api/v1/links/:code/qr", GetQRCode)
+
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+	}{
+		{"png", "/api/v1/links/home/qr", http.StatusOK, "image/png"},
+		{"svg", "/api/v1/links/home/qr?format=svg&size=128", http.StatusOK, "image/svg+xml"},
+		{"unknown link", "/api/v1/links/missing/qr", http.StatusNotFound, ""},
+		{"invalid option", "/api/v1/links/home/qr?size=10", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			header := recorder.Result().Header
+			if contentType := header.Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", contentType, tt.contentType)
+			}
+			// Codes of links that are later deleted or quarantined must not stay in shared caches
+			if cache := header.Get("Cache-Control"); cache != constants.QRCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", cache, constants.QRCacheControl)
+			}
+		})
+	}
+}
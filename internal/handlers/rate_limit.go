@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// quotaReservation is quota taken from a client before a request is processed. Taking it up
+// front in one atomic step keeps concurrent requests from exceeding the quota; requests that
+// turn out not to count give it back, so only successful operations use quota up.
+type quotaReservation struct {
+	c        *gin.Context
+	reserved int // Requests taken and not yet kept or given back
+	info     *services.RateLimitInfo
+}
+
+// checkRateLimit refuses the request with 429 Too Many Requests once the client's quota is
+// used up, without taking a request from it. It reports whether the request may go on.
+func checkRateLimit(c *gin.Context) bool {
+	return reserveQuota(c, 0) != nil
+}
+
+// reserveQuota takes n requests from the client's quota and reports the quota in the rate
+// limit headers. If they are not all allowed, or the rate limit cannot be checked, it writes
+// the error response and returns nil. Write error responses with fail on the returned
+// reservation, and defer release so nothing stays reserved.
+func reserveQuota(c *gin.Context, n int) *quotaReservation {
+	info, err := rateLimitService.Allow(c.ClientIP(), n)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": constants.ErrorUpdateRateLimitFailed,
+		})
+		return nil
+	}
+	setRateLimitHeaders(c, info)
+	if !info.Allowed {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": constants.ErrorRateLimitExceeded,
+		})
+		return nil
+	}
+	return &quotaReservation{c: c, reserved: n, info: info}
+}
+
+// setRateLimitHeaders reports the client's quota in the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers of the IETF rate limit headers draft and, when the request was
+// refused, in Retry-After. Times are in seconds, rounded up so clients never retry too early.
+func setRateLimitHeaders(c *gin.Context, info *services.RateLimitInfo) {
+	c.Header("RateLimit-Limit", strconv.Itoa(info.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(info.Remaining))
+	c.Header("RateLimit-Reset", strconv.FormatInt(ceilSeconds(info.Reset), 10))
+	if !info.Allowed {
+		retryAfter := ceilSeconds(info.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+}
+
+// ceilSeconds returns a duration in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// keep counts k of the reserved requests, gives the others back and returns the client's
+// quota afterwards, updating the rate limit headers.
+func (q *quotaReservation) keep(k int) *services.RateLimitInfo {
+	unused := q.reserved - k
+	q.reserved = 0
+	if unused > 0 && q.refund(unused) {
+		q.info.Remaining += unused
+		if q.info.Remaining > q.info.Limit {
+			q.info.Remaining = q.info.Limit
+		}
+		setRateLimitHeaders(q.c, q.info)
+	}
+	return q.info
+}
+
+// release gives back the reserved requests that were not kept and updates the rate limit
+// headers. Call it before writing a response that does not count, since headers cannot
+// change once the response is written; deferred, it only makes sure nothing stays reserved.
+// A nil reservation has nothing to give back.
+func (q *quotaReservation) release() {
+	if q != nil {
+		q.keep(0)
+	}
+}
+
+// fail gives back the reserved requests and writes an error response, so its rate limit
+// headers report the quota the client has left.
+func (q *quotaReservation) fail(status int, body interface{}) {
+	q.release()
+	q.c.JSON(status, body)
+}
+
+// refund gives requests back, reporting whether it succeeded. A failure only costs the
+// client quota until the window resets, so it is logged rather than failing the request.
+func (q *quotaReservation) refund(n int) bool {
+	if err := rateLimitService.Refund(q.c.ClientIP(), n); err != nil {
+		log.Printf("Failed to give back %d requests of %s's quota: %v", n, q.c.ClientIP(), err)
+		return false
+	}
+	return true
+}
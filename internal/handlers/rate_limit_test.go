@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitHeadersOfRequestsThatDoNotCount(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	app.GET("/:url", ResolveURL)
+	app.POST("/api/v1", ShortenURL)
+	app.POST("/api/v1/report/:code", ReportLink)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"unknown short code", http.MethodGet, "/missing", "", http.StatusNotFound},
+		{"malformed shorten request", http.MethodPost, "/api/v1", "{", http.StatusBadRequest},
+		{"invalid destination", http.MethodPost, "/api/v1", `{"url": "ftp://example.com/file"}`, http.StatusBadRequest},
+		{"report of an unknown link", http.MethodPost, "/api/v1/report/missing", `{"reason": "spam"}`, http.StatusNotFound},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = "203.0.113." + strconv.Itoa(i+1) + ":1234"
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			// The request was given back before the response was written, so the headers
+			// sent with it report the full quota
+			header := recorder.Result().Header
+			limit := header.Get("RateLimit-Limit")
+			if remaining := header.Get("RateLimit-Remaining"); limit == "" || remaining != limit {
+				t.Errorf("RateLimit-Remaining = %q, want the full quota of %q", remaining, limit)
+			}
+		})
+	}
+}
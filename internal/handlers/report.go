@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ReportLink files an abuse report against a short link.
+// This is the main handler for POST /api/v1/report/:code requests. The body is
+// {"reason": "phishing|malware|spam|scam|illegal|other", "details": "..."}; the domain
+// query parameter selects the short domain when it differs from the request's host.
+// Reports count against the client's rate limit like any other request.
+func ReportLink(c *gin.Context) {
+	reservation := reserveQuota(c, 1)
+	if reservation == nil {
+		return
+	}
+	defer reservation.release()
+
+	var body services.AbuseReportRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		reservation.fail(http.StatusBadRequest, gin.H{
+			"error": constants.ErrorCannotParseJSON,
+		})
+		return
+	}
+
+	domain, err := requestDomain(c)
+	if err != nil {
+		reservation.fail(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Report counts and quarantine decisions are not disclosed to reporters
+	if _, err := urlService.ReportLink(domain, c.Param("code"), &body, c.ClientIP()); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidReport):
+			reservation.fail(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+		case errors.Is(err, services.ErrLinkNotFound):
+			reservation.fail(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+		default:
+			reservation.fail(http.StatusInternalServerError, gin.H{
+				"error": "Failed to report URL",
+			})
+		}
+		return
+	}
+
+	reservation.keep(1)
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "received",
+	})
+}
@@ -1,55 +1,147 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/adeesh/url-shortener/internal/config"
 	"github.com/adeesh/url-shortener/internal/constants"
 	"github.com/adeesh/url-shortener/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
 // analyticsService is a shared instance of the analytics service
-var analyticsService = services.NewAnalyticsService()
+var analyticsService = services.NewAnalyticsService(config.Load())
+
+// clickPipeline records the clicks of redirects in the background
+var clickPipeline = services.NewClickPipeline(config.Load(), analyticsService)
+
+// StartClickPipeline starts recording the clicks of redirects, also delivering them to the sinks
+// and to live analytics streams.
+func StartClickPipeline(sinks ...services.ClickSink) {
+	clickPipeline.AddSink(clickBroker)
+	for _, sink := range sinks {
+		clickPipeline.AddSink(sink)
+	}
+	clickPipeline.Start()
+}
+
+// StopClickPipeline stops accepting clicks and waits for the queued ones to be recorded.
+func StopClickPipeline(ctx context.Context) error {
+	return clickPipeline.Close(ctx)
+}
 
 // ResolveURL handles requests to short URLs and redirects to the original URL.
-// This is the main handler for GET /:url requests.
+// This is the main handler for GET /:url and HEAD /:url requests.
 func ResolveURL(c *gin.Context) {
-	// Check rate limit BEFORE processing any request
-	if err := rateLimitService.CheckRateLimit(c.ClientIP()); err != nil {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": constants.ErrorRateLimitExceeded,
-		})
+	// Take the request from the quota BEFORE processing it; only redirects keep it
+	reservation := reserveQuota(c, 1)
+	if reservation == nil {
 		return
 	}
+	defer reservation.release()
 
 	shortCode := c.Param("url")
+	preview := isPreviewRequest(c, shortCode)
+	shortCode = strings.TrimSuffix(shortCode, constants.PreviewSuffix)
 
-	originalURL, err := urlService.GetOriginalURL(shortCode)
+	// Short codes are scoped to the domain the request was made on
+	domain := urlService.DomainForHost(c.Request.Host)
+	link, err := urlService.GetLink(domain, shortCode)
+	if errors.Is(err, services.ErrLinkNotFound) {
+		// Count the miss so popular expired codes and enumeration attempts can be spotted
+		clickPipeline.Enqueue(&services.ClickEvent{
+			LinkKey:   urlService.LinkKey(domain, shortCode),
+			Domain:    domain,
+			ShortCode: shortCode,
+			Time:      time.Now(),
+			Miss:      true,
+		})
+		reservation.fail(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		var ginErr *gin.Error
 		if errors.As(err, &ginErr) {
-			c.JSON(http.StatusNotFound, gin.H{
+			reservation.fail(http.StatusNotFound, gin.H{
 				"error": ginErr.Error(),
 			})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		reservation.fail(http.StatusInternalServerError, gin.H{
 			"error": "Failed to retrieve URL",
 		})
 		return
 	}
 
-	// Update rate limit after successful resolution
-	go func() {
-		_, _ = rateLimitService.DecrementRateLimit(c.ClientIP())
-		// Track total redirects
-		_ = analyticsService.TrackRedirectCounter()
-		// Track individual short URL access
-		_ = analyticsService.TrackShortURLAccess(shortCode)
-	}()
+	// Re-check the destination against the blocklist if configured
+	if err := urlService.ScreenResolvedLink(link); err != nil {
+		if errors.Is(err, services.ErrBlockedURL) {
+			reservation.fail(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		reservation.fail(http.StatusInternalServerError, gin.H{
+			"error": "Failed to retrieve URL",
+		})
+		return
+	}
+
+	// Quarantined links show a warning instead of redirecting
+	if link.Status == constants.LinkStatusQuarantined {
+		reservation.release()
+		renderWarning(c, link)
+		return
+	}
+
+	// Preview requests show where the link goes without redirecting or counting as a visit
+	if preview {
+		reservation.release()
+		renderPreview(c, link, 0)
+		return
+	}
+
+	// Successful resolutions count against the rate limit
+	reservation.keep(1)
+
+	// Queue the click for recording in the background; it is dropped rather than delaying
+	// the redirect if the queue is full. Hits by bots, such as link unfurlers and crawlers,
+	// are counted apart from clicks by people. Visitors asking not to be tracked are only
+	// counted in aggregate, or not at all, as configured
+	if tracking := analyticsService.DoNotTrack(c.Request); tracking != constants.DoNotTrackSkip {
+		bot, botName := analyticsService.ClassifyBot(c.Request)
+		click := &services.ClickEvent{
+			LinkKey:        urlService.LinkKey(domain, shortCode),
+			Domain:         domain,
+			ShortCode:      shortCode,
+			Time:           time.Now(),
+			Referrer:       c.Request.Referer(),
+			UserAgent:      c.Request.UserAgent(),
+			AcceptLanguage: c.GetHeader("Accept-Language"),
+			VisitorIP:      analyticsService.VisitorIP(c.ClientIP()),
+			Country:        analyticsService.ClientCountry(c.Request),
+			Bot:            bot,
+			BotName:        botName,
+			DoNotTrack:     tracking == constants.DoNotTrackAggregate,
+		}
+		clickPipeline.Enqueue(click)
+	}
+
+	// Links flagged as interstitial always show the preview page with a countdown
+	if link.Interstitial {
+		renderPreview(c, link, constants.DefaultInterstitialSeconds)
+		return
+	}
 
 	// Redirect the user to the original URL
-	// 301 = Moved Permanently (browser may cache the redirect)
-	c.Redirect(http.StatusMovedPermanently, originalURL)
+	// 302 = Found, never cached, so every click is counted and quarantining, restoring or
+	// deleting the link takes effect for visitors who already followed it
+	c.Header("Cache-Control", "private, max-age=0")
+	c.Redirect(http.StatusFound, link.URL)
 }
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResolveURLRedirectsAreNotCached(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	_ = server.Set("home", "https://example.com/")
+	domain := urlService.Domains()[0]
+	gin.SetMode(gin.TestMode)
+	app := gin.New()
+	app.GET("/:url", ResolveURL)
+
+	tests := []struct {
+		name   string
+		change func() error
+		status int
+	}{
+		{"active link", func() error { return nil }, http.StatusFound},
+		{"quarantined link", func() error {
+			_, err := urlService.QuarantineLink(domain, "home", "alice", "phishing")
+			return err
+		}, http.StatusOK},
+		{"restored link", func() error {
+			_, err := urlService.RestoreLink(domain, "home", "alice", "false positive")
+			return err
+		}, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatalf("changing the link: %v", err)
+			}
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/home", nil))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status != http.StatusFound {
+				return
+			}
+			header := recorder.Result().Header
+			if location := header.Get("Location"); location != "https://example.com/" {
+				t.Errorf("Location = %q, want the destination", location)
+			}
+			if cache := header.Get("Cache-Control"); cache != "private, max-age=0" {
+				t.Errorf("Cache-Control = %q, want the redirect not to be cached", cache)
+			}
+		})
+	}
+}
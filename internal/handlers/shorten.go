@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/adeesh/url-shortener/internal/config"
 	"github.com/adeesh/url-shortener/internal/constants"
 	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/adeesh/url-shortener/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -19,18 +21,17 @@ var urlService = services.NewURLService(config.Load())
 // ShortenURL handles URL shortening requests with rate limiting and validation.
 // This is the main handler for POST /api/v1 requests.
 func ShortenURL(c *gin.Context) {
-	// Check rate limit BEFORE processing any request
-	if err := rateLimitService.CheckRateLimit(c.ClientIP()); err != nil {
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error": "Rate limit exceeded",
-		})
+	// Take the request from the quota BEFORE processing it; it is given back if shortening fails
+	reservation := reserveQuota(c, 1)
+	if reservation == nil {
 		return
 	}
+	defer reservation.release()
 
 	// Parse request body
 	body, err := parseRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+		reservation.fail(http.StatusBadRequest, gin.H{
 			"error": constants.ErrorCannotParseJSON,
 		})
 		return
@@ -38,38 +39,51 @@ func ShortenURL(c *gin.Context) {
 
 	// Use URL service for URL shortening
 	req := &services.ShortenURLRequest{
-		URL:         body.URL,
-		CustomShort: body.CustomShort,
-		Expiry:      body.Expiry,
+		URL:          body.URL,
+		CustomShort:  body.CustomShort,
+		Expiry:       body.Expiry,
+		Title:        body.Title,
+		Interstitial: body.Interstitial,
+		Tags:         body.Tags,
+		Domain:       body.Domain,
 	}
 
 	response, err := urlService.ShortenURL(req)
 	if err != nil {
+		// Blocklisted and internal destinations are refused, not failures
+		if errors.Is(err, services.ErrBlockedURL) || errors.Is(err, services.ErrPrivateDestination) {
+			reservation.fail(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		// Destinations with a scheme outside the allowlist, on other shorteners or with hosts
+		// that cannot be looked up are client errors
+		if errors.Is(err, utils.ErrSchemeNotAllowed) || errors.Is(err, services.ErrShortenerURL) ||
+			errors.Is(err, services.ErrUnresolvedDestination) {
+			reservation.fail(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		// Handle Gin errors
 		if ginErr, ok := err.(*gin.Error); ok {
-			c.JSON(http.StatusBadRequest, gin.H{
+			reservation.fail(http.StatusBadRequest, gin.H{
 				"error": ginErr.Error(),
 			})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		reservation.fail(http.StatusInternalServerError, gin.H{
 			"error": "Failed to shorten URL",
 		})
 		return
 	}
 
-	// Update rate limit and get updated values
-	rateRemaining, rateReset, err := updateRateLimit(c)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": constants.ErrorUpdateRateLimitFailed,
-		})
-		return
-	}
-
-	// Update the response with rate limit info
-	response.XRateRemaining = rateRemaining
-	response.XRateLimitReset = rateReset
+	// Update the response with rate limit info; the reset is reported in whole minutes
+	rateLimitInfo := reservation.keep(1)
+	response.XRateRemaining = rateLimitInfo.Remaining
+	response.XRateLimitReset = rateLimitInfo.Reset / time.Minute
 
 	c.JSON(http.StatusOK, response)
 }
@@ -82,13 +96,3 @@ func parseRequestBody(c *gin.Context) (*services.ShortenURLRequest, error) {
 	}
 	return &body, nil
 }
-
-// updateRateLimit decrements the rate limit counter and returns updated values.
-// Uses the rate limit service for consistent rate limiting logic.
-func updateRateLimit(c *gin.Context) (int, time.Duration, error) {
-	rateLimitInfo, err := rateLimitService.DecrementRateLimit(c.ClientIP())
-	if err != nil {
-		return 0, 0, err
-	}
-	return rateLimitInfo.Remaining, rateLimitInfo.Reset, nil
-}
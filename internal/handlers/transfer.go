@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ImportLinks creates links from an uploaded CSV file.
+// This is the main handler for POST /api/v1/links/import requests, which require an admin token,
+// since an import can create links on any domain. The CSV is sent either
+// as the raw request body or as a multipart form file named "file".
+// With ?dry_run=1 the rows are only validated and a report is returned without creating links.
+//
+// Like bulk shortening, every row of a real import counts as one request: all rows are taken
+// from the quota up front, the import is rejected if they cannot all be covered, and the rows
+// that were not created are given back.
+func ImportLinks(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "1" || c.Query("dry_run") == "true"
+
+	if !checkRateLimit(c) {
+		return
+	}
+
+	body, err := importBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A CSV file is required",
+		})
+		return
+	}
+	defer body.Close()
+
+	rows, err := services.ParseImportCSV(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	var reservation *quotaReservation
+	if !dryRun {
+		if reservation = reserveQuota(c, len(rows)); reservation == nil {
+			return
+		}
+		defer reservation.release()
+	}
+
+	report, err := urlService.ImportLinks(rows, dryRun)
+	if err != nil {
+		reservation.release()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to import links",
+		})
+		return
+	}
+
+	if reservation != nil {
+		reservation.keep(report.Created)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// importBody returns the uploaded CSV, limited to MaxImportBytes.
+func importBody(c *gin.Context) (io.ReadCloser, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, constants.MaxImportBytes)
+
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return c.Request.Body, nil
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	return fileHeader.Open()
+}
+
+// ExportLinks streams all links matching the filter as CSV or NDJSON.
+// This is the main handler for GET /api/v1/links/export requests.
+// Supported query parameters: format (csv|ndjson), domain (short domain), tag, host (destination host),
+// created_after and created_before (RFC 3339 or YYYY-MM-DD), and health (ok|broken).
+// It requires an analytics token; clients limited to some short domains only receive their links.
+func ExportLinks(c *gin.Context) {
+	if !checkRateLimit(c) {
+		return
+	}
+
+	filter, err := urlService.ParseLinkFilter(
+		c.Query("domain"),
+		c.Query("tag"),
+		c.Query("host"),
+		c.Query("created_after"),
+		c.Query("created_before"),
+		c.Query("health"),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	filter.Domains = analyticsDomains(c)
+	if filter.Domain != "" && !checkDomainAllowed(c, filter.Domain) {
+		return
+	}
+
+	format := c.DefaultQuery("format", constants.ExportFormatCSV)
+	writer, err := services.NewLinkExportWriter(c.Writer, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == constants.ExportFormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="links.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// Flush periodically so clients receive data while the export is still running
+	written := 0
+	err = urlService.ExportLinks(filter, func(link *services.LinkExport) error {
+		if err := writer.Write(link); err != nil {
+			return err
+		}
+		written++
+		if written%constants.ExportBatchSize == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// Headers are already sent, so the error can only be logged
+		log.Printf("Export failed after %d links: %v", written, err)
+	}
+}
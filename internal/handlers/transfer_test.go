@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportLinksIsLimitedToTheClientsDomains(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	_ = server.Set("home", "https://example.com/")
+	domain := urlService.Domains()[0]
+	saved := analyticsTokenDomains
+	defer func() { analyticsTokenDomains = saved }()
+	analyticsTokenDomains = map[string][]string{
+		"acme":     {"go.acme.com"},
+		"internal": {domain},
+	}
+
+	tests := []struct {
+		name     string
+		client   string
+		query    string
+		status   int
+		exported bool
+	}{
+		{"client of the link's domain", "internal", "", http.StatusOK, true},
+		{"client of another domain", "acme", "", http.StatusOK, false},
+		{"client without an entry", "globex", "", http.StatusOK, false},
+		{"client asking for a domain it was not given", "acme", "?domain=" + domain, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			app := gin.New()
+			app.GET("/api/v1/links/export", func(c *gin.Context) {
+				c.Set(analyticsClientContextKey, tt.client)
+			}, ExportLinks)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/links/export"+tt.query, nil)
+			recorder := httptest.NewRecorder()
+			app.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if exported := strings.Contains(recorder.Body.String(), "https://example.com/"); exported != tt.exported {
+				t.Errorf("link exported = %v, want %v: %s", exported, tt.exported, recorder.Body)
+			}
+		})
+	}
+}
@@ -2,21 +2,133 @@ package services
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/adeesh/url-shortener/internal/config"
 	"github.com/adeesh/url-shortener/internal/constants"
 	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
 )
 
 // AnalyticsService handles analytics tracking.
-type AnalyticsService struct{}
+type AnalyticsService struct {
+	granularities    []*clickGranularity // Time buckets clicks are counted in, finest first
+	visitorRetention time.Duration       // How long per-day unique visitor counts are kept
+	memoryVisitors   *memoryVisitorStore // Where unique visitors are counted instead of Redis; nil for Redis
+	bots             *BotFilter          // Tells bot hits apart from human clicks
+	countryHeader    string              // Request header holding the visitor's country, set by a proxy or CDN
+	anonymizeIP      bool                // Whether visitor IP addresses are truncated
+	doNotTrack       string              // How clicks with DNT or Sec-GPC are recorded
+
+	saltMu  sync.Mutex // Guards the cached fingerprint salt
+	saltDay string     // Day of the cached salt
+	salt    string
+}
+
+// ClickEvent describes a single redirect of a short link, as seen in the visitor's request.
+type ClickEvent struct {
+	LinkKey        string    // Key of the link (short code, prefixed by the host on non-default domains)
+	Domain         string    // Short domain of the link
+	ShortCode      string    // Short code of the link
+	Time           time.Time // When the redirect happened
+	Referrer       string    // Referer header
+	UserAgent      string    // User-Agent header
+	AcceptLanguage string    // Accept-Language header
+	VisitorIP      string    // Client IP address as returned by VisitorIP, only used to fingerprint the visitor
+	Country        string    // ISO 3166-1 alpha-2 country of the visitor, when known
+	Bot            bool      // Whether the hit was made by a bot rather than a person
+	BotName        string    // Name of the bot, as returned by BotFilter.Classify
+	Miss           bool      // Whether the short code does not map to a link; misses are only counted as such
+	DoNotTrack     bool      // Whether the visitor asked not to be tracked; the click is only counted in aggregate
+}
 
 // NewAnalyticsService creates a new analytics service instance.
-func NewAnalyticsService() *AnalyticsService {
-	return &AnalyticsService{}
+func NewAnalyticsService(cfg *config.Config) *AnalyticsService {
+	s := &AnalyticsService{
+		granularities:    clickGranularities(cfg),
+		visitorRetention: cfg.VisitorDayRetention,
+		bots:             NewBotFilter(cfg.BotUserAgents),
+		countryHeader:    cfg.CountryHeader,
+		anonymizeIP:      cfg.AnonymizeIP,
+		doNotTrack:       cfg.DoNotTrack,
+	}
+	if cfg.VisitorStore == constants.VisitorStoreMemory {
+		s.memoryVisitors = memoryVisitors
+	}
+	return s
 }
 
-// TrackRedirectCounter increments the total redirect counter.
-func (s *AnalyticsService) TrackRedirectCounter() error {
+// ClassifyBot reports whether a request to a short link was made by a bot, and which one.
+func (s *AnalyticsService) ClassifyBot(r *http.Request) (bool, string) {
+	return s.bots.Classify(r)
+}
+
+// ClientCountry returns the visitor's country from the configured request header, which a
+// proxy or CDN in front of the service sets (e.g. CF-IPCountry), or "" when it is unknown.
+func (s *AnalyticsService) ClientCountry(r *http.Request) string {
+	if s.countryHeader == "" {
+		return ""
+	}
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(s.countryHeader)))
+	if len(country) != 2 || country[0] < 'A' || country[0] > 'Z' || country[1] < 'A' || country[1] > 'Z' {
+		return ""
+	}
+	return country
+}
+
+// ParseTraffic validates which hits analytics should report: human clicks (the default),
+// bot hits, or all of them.
+func ParseTraffic(value string) (string, error) {
+	switch traffic := strings.ToLower(strings.TrimSpace(value)); traffic {
+	case "":
+		return constants.TrafficHuman, nil
+	case constants.TrafficHuman, constants.TrafficBot, constants.TrafficAll:
+		return traffic, nil
+	}
+	return "", fmt.Errorf("invalid traffic: %s (expected %s, %s or %s)", value, constants.TrafficHuman, constants.TrafficBot, constants.TrafficAll)
+}
+
+// trafficPrefix returns the prefix of the analytics keys of human or bot hits.
+func trafficPrefix(bot bool) string {
+	if bot {
+		return constants.BotKeyPrefix
+	}
+	return ""
+}
+
+// trafficPrefixes returns the prefixes of the analytics keys of the hits a traffic selection covers.
+func trafficPrefixes(traffic string) []string {
+	switch traffic {
+	case constants.TrafficBot:
+		return []string{constants.BotKeyPrefix}
+	case constants.TrafficAll:
+		return []string{"", constants.BotKeyPrefix}
+	}
+	return []string{""}
+}
+
+// sumCounters returns the sum of the counters stored at the keys; missing counters count as zero.
+func sumCounters(r *redis.Client, keys []string) (int64, error) {
+	vals, err := r.MGet(database.Ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, val := range vals {
+		if str, ok := val.(string); ok {
+			var count int64
+			_, _ = fmt.Sscanf(str, "%d", &count)
+			total += count
+		}
+	}
+	return total, nil
+}
+
+// GetRedirectCount returns the total number of redirects of the selected traffic.
+func (s *AnalyticsService) GetRedirectCount(traffic string) (int64, error) {
 	r := database.CreateClient(constants.RedisDBRateLimit)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -25,11 +137,24 @@ func (s *AnalyticsService) TrackRedirectCounter() error {
 		}
 	}()
 
-	return database.Increment(r, constants.Counter)
+	var keys []string
+	for _, prefix := range trafficPrefixes(traffic) {
+		keys = append(keys, prefix+constants.Counter)
+	}
+	return sumCounters(r, keys)
 }
 
-// GetRedirectCount returns the total number of redirects.
-func (s *AnalyticsService) GetRedirectCount() (int64, error) {
+// TrackClicks records a batch of clicks in one round trip. Each click counts towards the total
+// redirect counter, its link's lifetime counter, the time buckets of every enabled granularity,
+// the referrer, browser, OS, device and language breakdowns, its link's unique visitors and
+// the day's top links. Bot hits are counted under separate keys and are neither visitors nor top links.
+// Requests for unknown short codes are only counted as misses. Clicks of visitors who asked not
+// to be tracked count towards the counters, time buckets and top links only.
+func (s *AnalyticsService) TrackClicks(events []*ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
 	r := database.CreateClient(constants.RedisDBRateLimit)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -38,23 +163,60 @@ func (s *AnalyticsService) GetRedirectCount() (int64, error) {
 		}
 	}()
 
-	val, err := database.Get(r, constants.Counter)
-	if err != nil {
-		return 0, err
+	// Without a fingerprint a click is still counted, only not as a visitor
+	fingerprints := make([]string, len(events))
+	var fingerprintErr error
+	for i, event := range events {
+		if event.Bot || event.Miss || event.DoNotTrack {
+			continue
+		}
+		fingerprint, err := s.visitorFingerprint(r, event)
+		if err != nil {
+			fingerprintErr = err
+			continue
+		}
+		fingerprints[i] = fingerprint
 	}
 
-	// Parse the string value to int64
-	var count int64
-	_, err = fmt.Sscanf(val, "%d", &count)
+	// Breakdowns expire with their links, and their script is sent by hash in the pipeline
+	expiries, err := linkExpiries(events)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if err := boundedIncrScript.Load(database.Ctx, r).Err(); err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
 	}
 
-	return count, nil
+	_, err = r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for i, event := range events {
+			if event.Miss {
+				s.trackMiss(pipe, event)
+				continue
+			}
+			prefix := trafficPrefix(event.Bot)
+			pipe.Incr(database.Ctx, prefix+constants.Counter)
+			pipe.Incr(database.Ctx, prefix+"access:"+event.LinkKey)
+			s.trackClickBuckets(pipe, prefix, event.LinkKey, event.Time)
+			if !event.DoNotTrack {
+				s.trackClickDimensions(pipe, prefix, event, expiries[event.LinkKey])
+			}
+			if !event.Bot {
+				s.trackTopLink(pipe, event.LinkKey, event.Time)
+			}
+			if fingerprints[i] != "" {
+				s.trackVisitor(pipe, event.LinkKey, fingerprints[i], event.Time)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return fingerprintErr
 }
 
-// TrackShortURLAccess tracks access to a specific short URL.
-func (s *AnalyticsService) TrackShortURLAccess(shortCode string) error {
+// GetShortURLAccessCount returns the access count of the selected traffic for a specific short URL.
+func (s *AnalyticsService) GetShortURLAccessCount(shortCode, traffic string) (int64, error) {
 	r := database.CreateClient(constants.RedisDBRateLimit)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -63,12 +225,21 @@ func (s *AnalyticsService) TrackShortURLAccess(shortCode string) error {
 		}
 	}()
 
-	key := "access:" + shortCode
-	return database.Increment(r, key)
+	var keys []string
+	for _, prefix := range trafficPrefixes(traffic) {
+		keys = append(keys, prefix+"access:"+shortCode)
+	}
+	return sumCounters(r, keys)
 }
 
-// GetShortURLAccessCount returns the access count for a specific short URL.
-func (s *AnalyticsService) GetShortURLAccessCount(shortCode string) (int64, error) {
+// GetShortURLAccessCounts returns the human access counts for several short URLs in one round trip.
+// Short URLs that were never accessed have a count of zero.
+func (s *AnalyticsService) GetShortURLAccessCounts(shortCodes []string) ([]int64, error) {
+	counts := make([]int64, len(shortCodes))
+	if len(shortCodes) == 0 {
+		return counts, nil
+	}
+
 	r := database.CreateClient(constants.RedisDBRateLimit)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -77,18 +248,19 @@ func (s *AnalyticsService) GetShortURLAccessCount(shortCode string) (int64, erro
 		}
 	}()
 
-	key := "access:" + shortCode
-	val, err := database.Get(r, key)
-	if err != nil {
-		return 0, err
+	keys := make([]string, len(shortCodes))
+	for i, shortCode := range shortCodes {
+		keys[i] = "access:" + shortCode
 	}
 
-	// Parse the string value to int64
-	var count int64
-	_, err = fmt.Sscanf(val, "%d", &count)
+	vals, err := r.MGet(database.Ctx, keys...).Result()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	return count, nil
+	for i, val := range vals {
+		if str, ok := val.(string); ok {
+			_, _ = fmt.Sscanf(str, "%d", &counts[i])
+		}
+	}
+	return counts, nil
 }
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// botSignatures are user agent substrings of link unfurlers, search crawlers, monitoring
+// services and headless browsers, with the name their hits are reported under. Specific
+// signatures come before the generic ones at the end of the list.
+var botSignatures = []uaRule{
+	// Link unfurlers of chat and social apps
+	{"slackbot", "Slackbot"},
+	{"slack-imgproxy", "Slackbot"},
+	{"twitterbot", "Twitterbot"},
+	{"facebookexternalhit", "Facebook"},
+	{"facebookcatalog", "Facebook"},
+	{"meta-externalagent", "Facebook"},
+	{"linkedinbot", "LinkedInBot"},
+	{"discordbot", "Discordbot"},
+	{"telegrambot", "TelegramBot"},
+	{"whatsapp", "WhatsApp"},
+	{"skypeuripreview", "Skype"},
+	{"microsoftpreview", "Microsoft Teams"},
+	{"mattermost", "Mattermost"},
+	{"mastodon", "Mastodon"},
+	{"pinterestbot", "Pinterest"},
+	{"redditbot", "Redditbot"},
+	{"embedly", "Embedly"},
+	{"iframely", "Iframely"},
+	// Search engine crawlers
+	{"googlebot", "Googlebot"},
+	{"google-inspectiontool", "Googlebot"},
+	{"adsbot-google", "Googlebot"},
+	{"bingbot", "Bingbot"},
+	{"bingpreview", "Bingbot"},
+	{"applebot", "Applebot"},
+	{"duckduckbot", "DuckDuckBot"},
+	{"yandexbot", "YandexBot"},
+	{"baiduspider", "Baiduspider"},
+	{"slurp", "Yahoo Slurp"},
+	// Monitoring services and headless browsers
+	{"uptimerobot", "UptimeRobot"},
+	{"pingdom", "Pingdom"},
+	{"headlesschrome", "Headless Chrome"},
+	{"lighthouse", "Lighthouse"},
+	// Generic markers
+	{"bot", constants.DimensionOther},
+	{"crawler", constants.DimensionOther},
+	{"spider", constants.DimensionOther},
+	{"preview", constants.DimensionOther},
+}
+
+// prefetchHeaders are request headers browsers send with speculative loads (prefetch and
+// prerender) that are not clicks, with the values that mark them.
+var prefetchHeaders = map[string]string{
+	"Purpose":     "prefetch",
+	"Sec-Purpose": "prefetch",
+	"X-Purpose":   "preview",
+	"X-Moz":       "prefetch",
+}
+
+// BotFilter tells automated hits on short links apart from clicks by people.
+type BotFilter struct {
+	signatures []uaRule
+}
+
+// NewBotFilter creates a bot filter from the built-in signatures and the extra user agent
+// substrings in the configuration.
+func NewBotFilter(extraSignatures []string) *BotFilter {
+	signatures := make([]uaRule, 0, len(extraSignatures)+len(botSignatures))
+	for _, token := range extraSignatures {
+		signatures = append(signatures, uaRule{token: strings.ToLower(token), name: constants.DimensionOther})
+	}
+	return &BotFilter{signatures: append(signatures, botSignatures...)}
+}
+
+// Classify reports whether a request to a short link was made by a bot, and which one.
+// Besides matching the user agent against the signatures, requests without a user agent,
+// HEAD requests (used by unfurlers to check a link) and prefetches are counted as bots.
+// The name is a bot name, DimensionOther for unnamed bots, or a BotReason constant.
+func (f *BotFilter) Classify(r *http.Request) (bool, string) {
+	ua := strings.ToLower(r.UserAgent())
+	if name, ok := matchBotSignature(ua, f.signatures); ok {
+		return true, name
+	}
+
+	switch {
+	case strings.TrimSpace(ua) == "":
+		return true, constants.BotReasonNoUserAgent
+	case r.Method == http.MethodHead:
+		return true, constants.BotReasonHeadRequest
+	}
+	for header, marker := range prefetchHeaders {
+		if strings.Contains(strings.ToLower(r.Header.Get(header)), marker) {
+			return true, constants.BotReasonPrefetch
+		}
+	}
+	return false, ""
+}
+
+// matchBotSignature returns the name of the first signature occurring in the lowercase user agent.
+func matchBotSignature(ua string, signatures []uaRule) (string, bool) {
+	for _, signature := range signatures {
+		if signature.token != "" && strings.Contains(ua, signature.token) {
+			return signature.name, true
+		}
+	}
+	return "", false
+}
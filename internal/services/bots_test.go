@@ -0,0 +1,103 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestBotFilterClassify(t *testing.T) {
+	const firefox = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:127.0) Gecko/20100101 Firefox/127.0"
+	filter := NewBotFilter([]string{"AcmeMonitor", ""})
+
+	tests := []struct {
+		name    string
+		method  string
+		ua      string
+		headers map[string]string
+		bot     bool
+		botName string
+	}{
+		{name: "browser", ua: firefox},
+		{name: "link unfurler", ua: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", bot: true, botName: "Slackbot"},
+		{name: "social crawler", ua: "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", bot: true, botName: "Facebook"},
+		{name: "search crawler", ua: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", bot: true, botName: "Googlebot"},
+		{name: "headless browser", ua: "Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/126.0.0.0 Safari/537.36", bot: true, botName: "Headless Chrome"},
+		{name: "unnamed bot", ua: "SomeNewBot/0.1", bot: true, botName: constants.DimensionOther},
+		{name: "configured signature", ua: "acmemonitor/2.0", bot: true, botName: constants.DimensionOther},
+		{name: "no user agent", bot: true, botName: constants.BotReasonNoUserAgent},
+		{name: "blank user agent", ua: "   ", bot: true, botName: constants.BotReasonNoUserAgent},
+		{name: "head request", method: http.MethodHead, ua: firefox, bot: true, botName: constants.BotReasonHeadRequest},
+		{name: "signature of a head request", method: http.MethodHead, ua: "Twitterbot/1.0", bot: true, botName: "Twitterbot"},
+		{name: "prefetch", ua: firefox, headers: map[string]string{"Sec-Purpose": "prefetch;prerender"}, bot: true, botName: constants.BotReasonPrefetch},
+		{name: "legacy prefetch", ua: firefox, headers: map[string]string{"X-Moz": "prefetch"}, bot: true, botName: constants.BotReasonPrefetch},
+		{name: "other purpose", ua: firefox, headers: map[string]string{"Purpose": "navigate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/promo", nil)
+			req.Header.Set("User-Agent", tt.ua)
+			for header, value := range tt.headers {
+				req.Header.Set(header, value)
+			}
+
+			bot, botName := filter.Classify(req)
+			if bot != tt.bot || botName != tt.botName {
+				t.Errorf("Classify = %v, %q, want %v, %q", bot, botName, tt.bot, tt.botName)
+			}
+		})
+	}
+}
+
+func TestBotHitsAreCountedApart(t *testing.T) {
+	startTestRedis(t)
+	analytics := NewAnalyticsService(&config.Config{Domain: "https://sho.rt", Domains: []string{"https://sho.rt"}})
+
+	now := time.Now()
+	human := &ClickEvent{LinkKey: "promo", ShortCode: "promo", Time: now, UserAgent: "Mozilla/5.0 Firefox/127.0", VisitorIP: "203.0.113.7"}
+	bot := &ClickEvent{LinkKey: "promo", ShortCode: "promo", Time: now, UserAgent: "Slackbot 1.0", VisitorIP: "203.0.113.8", Bot: true, BotName: "Slackbot"}
+	if err := analytics.TrackClicks([]*ClickEvent{human, bot, bot}); err != nil {
+		t.Fatalf("TrackClicks = %v", err)
+	}
+
+	for traffic, want := range map[string]int64{
+		constants.TrafficHuman: 1,
+		constants.TrafficBot:   2,
+		constants.TrafficAll:   3,
+	} {
+		if got, err := analytics.GetShortURLAccessCount("promo", traffic); err != nil || got != want {
+			t.Errorf("GetShortURLAccessCount(%s) = %d, %v, want %d", traffic, got, err, want)
+		}
+		if got, err := analytics.GetRedirectCount(traffic); err != nil || got != want {
+			t.Errorf("GetRedirectCount(%s) = %d, %v, want %d", traffic, got, err, want)
+		}
+	}
+	// The lifetime counts exported with links are those of people
+	if counts, err := analytics.GetShortURLAccessCounts([]string{"promo"}); err != nil || counts[0] != 1 {
+		t.Errorf("GetShortURLAccessCounts = %v, %v, want [1]", counts, err)
+	}
+
+	// Bots are reported under their name, and are not top links
+	breakdowns, err := analytics.GetClickBreakdowns("promo", 10, constants.TrafficBot)
+	if err != nil {
+		t.Fatalf("GetClickBreakdowns = %v", err)
+	}
+	if browsers := breakdowns[constants.DimensionBrowser]; len(browsers) != 1 || browsers[0].Value != "Slackbot" || browsers[0].Clicks != 2 {
+		t.Errorf("bot browsers = %+v, want Slackbot with 2 hits", browsers)
+	}
+	if devices := breakdowns[constants.DimensionDevice]; len(devices) != 1 || devices[0].Value != constants.DeviceBot {
+		t.Errorf("bot devices = %+v, want %s", devices, constants.DeviceBot)
+	}
+	top, err := analytics.GetTopLinks(1, 10)
+	if err != nil || len(top) != 1 || top[0].Score != 1 {
+		t.Errorf("GetTopLinks = %v, %v, want promo with its human click", top, err)
+	}
+}
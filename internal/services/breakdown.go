@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// clickDimensions are the breakdowns recorded for every click, in response order.
+var clickDimensions = []string{
+	constants.DimensionReferrer,
+	constants.DimensionBrowser,
+	constants.DimensionOS,
+	constants.DimensionDevice,
+	constants.DimensionLanguage,
+}
+
+// boundedIncrScript increments a member of a sorted set, or the "other" member once the set
+// holds the maximum number of members and the member is new, so that a link's breakdowns
+// cannot grow without bound however many distinct referrers its visitors come from.
+// Unless ARGV[4] is 0, the set expires at ARGV[4] (Unix milliseconds), with its link.
+var boundedIncrScript = redis.NewScript(`
+local member = ARGV[3]
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) or redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) then
+	member = ARGV[1]
+end
+local count = redis.call('ZINCRBY', KEYS[1], 1, member)
+if ARGV[4] ~= '0' then
+	redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+end
+return count
+`)
+
+// BreakdownEntry is the number of clicks with one value of a dimension.
+type BreakdownEntry struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// clickDimensionValues returns the value of every recorded dimension for a click.
+// Bot hits are reported with the bot's name as browser.
+func clickDimensionValues(event *ClickEvent) map[string]string {
+	client := ParseUserAgent(event.UserAgent)
+	if event.Bot {
+		client.Browser, client.Device = event.BotName, constants.DeviceBot
+	}
+	return map[string]string{
+		constants.DimensionReferrer: ReferrerHost(event.Referrer),
+		constants.DimensionBrowser:  client.Browser,
+		constants.DimensionOS:       client.OS,
+		constants.DimensionDevice:   client.Device,
+		constants.DimensionLanguage: PrimaryLanguage(event.AcceptLanguage),
+	}
+}
+
+// trackClickDimensions queues the breakdown increments of a click on the pipeline.
+// The prefix selects human or bot hits. The breakdowns expire with the link at expireAt,
+// unless it is zero. boundedIncrScript must be loaded; in a pipeline Script.Run only sends
+// EVALSHA, without falling back to EVAL.
+func (s *AnalyticsService) trackClickDimensions(pipe redis.Pipeliner, prefix string, event *ClickEvent, expireAt time.Time) {
+	expireAtMs := int64(0)
+	if !expireAt.IsZero() {
+		expireAtMs = expireAt.UnixNano() / int64(time.Millisecond)
+	}
+	for dimension, value := range clickDimensionValues(event) {
+		key := prefix + constants.ClickDimensionPrefix + dimension + ":" + event.LinkKey
+		boundedIncrScript.Run(database.Ctx, pipe, []string{key}, value, constants.MaxDimensionValues, constants.DimensionOther, expireAtMs)
+	}
+}
+
+// linkExpiries returns when the links of the clicks whose breakdowns are recorded expire,
+// keyed by link key. Links without expiry are left out.
+func linkExpiries(events []*ClickEvent) (map[string]time.Time, error) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	now := time.Now()
+	ttls := make(map[string]*redis.DurationCmd)
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for _, event := range events {
+			if event.Miss || event.DoNotTrack || ttls[event.LinkKey] != nil {
+				continue
+			}
+			ttls[event.LinkKey] = pipe.PTTL(database.Ctx, event.LinkKey)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	expiries := make(map[string]time.Time, len(ttls))
+	for linkKey, cmd := range ttls {
+		// Links without expiry have a negative TTL, as do links deleted since the click
+		if ttl := cmd.Val(); ttl > 0 {
+			expiries[linkKey] = now.Add(ttl)
+		}
+	}
+	return expiries, nil
+}
+
+// GetClickBreakdowns returns the top values of every dimension for a link's selected traffic,
+// most clicks first.
+func (s *AnalyticsService) GetClickBreakdowns(linkKey string, limit int, traffic string) (map[string][]*BreakdownEntry, error) {
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	// A single traffic class is read up to the limit; combining classes needs their whole
+	// sets, which are bounded by MaxDimensionValues
+	prefixes := trafficPrefixes(traffic)
+	stop := int64(limit) - 1
+	if len(prefixes) > 1 {
+		stop = -1
+	}
+
+	cmds := make([][]*redis.ZSliceCmd, len(clickDimensions))
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for i, dimension := range clickDimensions {
+			for _, prefix := range prefixes {
+				key := prefix + constants.ClickDimensionPrefix + dimension + ":" + linkKey
+				cmds[i] = append(cmds[i], pipe.ZRevRangeWithScores(database.Ctx, key, 0, stop))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	breakdowns := make(map[string][]*BreakdownEntry, len(clickDimensions))
+	for i, dimension := range clickDimensions {
+		clicks := make(map[string]int64)
+		for _, cmd := range cmds[i] {
+			for _, z := range cmd.Val() {
+				clicks[z.Member.(string)] += int64(z.Score)
+			}
+		}
+		entries := make([]*BreakdownEntry, 0, len(clicks))
+		for value, count := range clicks {
+			entries = append(entries, &BreakdownEntry{Value: value, Clicks: count})
+		}
+		sort.Slice(entries, func(a, b int) bool {
+			if entries[a].Clicks != entries[b].Clicks {
+				return entries[a].Clicks > entries[b].Clicks
+			}
+			return entries[a].Value < entries[b].Value
+		})
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+		breakdowns[dimension] = entries
+	}
+	return breakdowns, nil
+}
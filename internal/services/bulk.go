@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// BulkShortenResult is the outcome of shortening a single item of a bulk request.
+// Exactly one of Short and Error is set.
+type BulkShortenResult struct {
+	Index  int           `json:"index"`           // Position of the item in the request
+	URL    string        `json:"url"`             // The original URL
+	Short  string        `json:"short,omitempty"` // The complete shortened URL on success
+	Expiry time.Duration `json:"expiry,omitempty"`
+	Status string        `json:"status,omitempty"` // "active", or "quarantined" if the destination is blocklisted
+	Error  string        `json:"error,omitempty"`  // Why the item was rejected
+}
+
+// bulkItem tracks a bulk request item through validation and persistence.
+type bulkItem struct {
+	result *BulkShortenResult
+	key    string // Database key of the link within its domain namespace
+	link   *Link
+	expiry time.Duration
+	setNX  *redis.BoolCmd
+}
+
+// ShortenURLs shortens a batch of URLs.
+// Items are validated independently, then all mappings are written in one pipeline using
+// SET NX so that a short code taken concurrently is reported as an item error rather than
+// overwritten. Metadata for the created links is written in a second pipeline.
+// The returned slice has one result per request item, in request order.
+func (s *URLService) ShortenURLs(reqs []*ShortenURLRequest) ([]*BulkShortenResult, error) {
+	results := make([]*BulkShortenResult, len(reqs))
+	items := make([]*bulkItem, 0, len(reqs))
+	seen := make(map[string]int, len(reqs))
+	now := time.Now().UTC()
+	// All items share one unwrap time limit
+	ctx, cancel := newUnwrapContext()
+	defer cancel()
+
+	for i, req := range reqs {
+		results[i] = &BulkShortenResult{Index: i, URL: req.URL}
+
+		originalURL, err := s.validateURL(ctx, req.URL)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		status, reason, err := s.screenDestination(originalURL)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		domain, err := s.LookupDomain(req.Domain)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		if err := s.checkDestination(originalURL, domain); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		if err := validateShortCode(req.CustomShort); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		shortCode := s.generateShortCode(req.CustomShort)
+		key := s.LinkKey(domain, shortCode)
+		if first, ok := seen[key]; ok {
+			results[i].Error = fmt.Sprintf("short code in use: %s (duplicate of item %d)", constants.ErrorURLShortInUse, first)
+			continue
+		}
+		seen[key] = i
+
+		results[i].URL = originalURL
+		items = append(items, &bulkItem{
+			result: results[i],
+			key:    key,
+			link: &Link{
+				Domain:       domain,
+				ShortCode:    shortCode,
+				URL:          originalURL,
+				Title:        req.Title,
+				CreatedAt:    now,
+				Interstitial: req.Interstitial,
+				Tags:         normalizeTags(req.Tags),
+				Status:       status,
+				StatusReason: reason,
+			},
+			expiry: bulkExpiry(req.Expiry),
+		})
+	}
+
+	if len(items) == 0 {
+		return results, nil
+	}
+
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	// Claim every short code in a single round trip
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			item.setNX = pipe.SetNX(database.Ctx, item.key, item.link.URL, expiryTTL(item.expiry))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	// Store metadata for the links that were created
+	created := make(map[string]time.Duration, len(items))
+	_, err = r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			if !item.setNX.Val() {
+				item.result.Error = fmt.Sprintf("short code in use: %s", constants.ErrorURLShortInUse)
+				continue
+			}
+			metaKey := constants.LinkMetaPrefix + item.key
+			pipe.HSet(database.Ctx, metaKey, linkMetaFields(item.link))
+			pipe.Expire(database.Ctx, metaKey, expiryTTL(item.expiry))
+
+			item.result.Short = s.ShortURL(item.link.Domain, item.link.ShortCode)
+			item.result.Expiry = item.expiry
+			item.result.Status = item.link.Status
+			created[item.key] = expiryTTL(item.expiry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	s.trackLinksCreated(created)
+	return results, nil
+}
+
+// bulkExpiry returns the expiry of a bulk item in hours, the default if not provided.
+func bulkExpiry(expiry time.Duration) time.Duration {
+	if expiry == 0 {
+		return time.Duration(constants.DefaultURLExpiryHours)
+	}
+	return expiry
+}
+
+// expiryTTL converts an expiry given in hours into the TTL of the Redis keys.
+func expiryTTL(expiry time.Duration) time.Duration {
+	return expiry * time.Hour
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// ClickExportRow is a row of a click export: the clicks of a link on one day or, for
+// breakdown rows, with one value of a dimension over the link's lifetime, since breakdowns
+// are not kept per day.
+type ClickExportRow struct {
+	Domain    string `json:"domain"`
+	ShortCode string `json:"short"`
+	ShortURL  string `json:"short_url"`
+	Date      string `json:"date,omitempty"`      // YYYY-MM-DD; empty on breakdown rows
+	Dimension string `json:"dimension,omitempty"` // Set on breakdown rows
+	Value     string `json:"value,omitempty"`     // Set on breakdown rows
+	Clicks    int64  `json:"clicks"`
+}
+
+// ClickExportWriter writes click export rows in a streaming format.
+type ClickExportWriter interface {
+	Write(row *ClickExportRow) error
+	Flush() error
+}
+
+// ExportClicks streams the daily clicks of every link matching the filter over the days of
+// the query (which must use the day interval) to fn, one row per link and day with clicks.
+// With breakdowns, each link's rows are followed by the top values of every dimension.
+// Links are read as by ExportLinks, and their clicks are read one batch of links at a time.
+func (s *URLService) ExportClicks(filter *LinkFilter, query *TimeseriesQuery, breakdowns bool, fn func(*ClickExportRow) error) error {
+	analytics := NewAnalyticsService(s.config)
+	batch := make([]*LinkExport, 0, constants.ExportBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		linkKeys := make([]string, len(batch))
+		for i, link := range batch {
+			linkKeys[i] = s.LinkKey(link.Domain, link.ShortCode)
+		}
+		series, err := analytics.GetClickTimeseriesBatch(linkKeys, query)
+		if err != nil {
+			return err
+		}
+
+		for i, link := range batch {
+			for _, point := range series[i].Points {
+				if point.Clicks == 0 {
+					continue
+				}
+				row := &ClickExportRow{
+					Domain:    link.Domain,
+					ShortCode: link.ShortCode,
+					ShortURL:  link.ShortURL,
+					Date:      point.Time.Format("2006-01-02"),
+					Clicks:    point.Clicks,
+				}
+				if err := fn(row); err != nil {
+					return err
+				}
+			}
+			if !breakdowns {
+				continue
+			}
+
+			values, err := analytics.GetClickBreakdowns(linkKeys[i], constants.MaxBreakdownLimit, query.Traffic)
+			if err != nil {
+				return err
+			}
+			for _, dimension := range clickDimensions {
+				for _, entry := range values[dimension] {
+					row := &ClickExportRow{
+						Domain:    link.Domain,
+						ShortCode: link.ShortCode,
+						ShortURL:  link.ShortURL,
+						Dimension: dimension,
+						Value:     entry.Value,
+						Clicks:    entry.Clicks,
+					}
+					if err := fn(row); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := s.ExportLinks(filter, func(link *LinkExport) error {
+		batch = append(batch, link)
+		if len(batch) < constants.ExportBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// NewClickExportWriter returns a writer producing CSV or NDJSON.
+func NewClickExportWriter(w io.Writer, format string) (ClickExportWriter, error) {
+	switch format {
+	case constants.ExportFormatCSV:
+		return newCSVClickWriter(w)
+	case constants.ExportFormatNDJSON:
+		return &ndjsonClickWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("invalid format: %s (expected %s or %s)", format, constants.ExportFormatCSV, constants.ExportFormatNDJSON)
+}
+
+// csvClickWriter writes click export rows as CSV with a header row.
+type csvClickWriter struct {
+	writer *csv.Writer
+}
+
+// newCSVClickWriter creates a CSV writer and writes the header row.
+func newCSVClickWriter(w io.Writer) (*csvClickWriter, error) {
+	writer := csv.NewWriter(w)
+	header := []string{"domain", "short", "short_url", "date", "dimension", "value", "clicks"}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvClickWriter{writer: writer}, nil
+}
+
+// Write writes a single row as a CSV record.
+func (w *csvClickWriter) Write(row *ClickExportRow) error {
+	return w.writer.Write([]string{
+		row.Domain,
+		row.ShortCode,
+		row.ShortURL,
+		row.Date,
+		row.Dimension,
+		row.Value,
+		strconv.FormatInt(row.Clicks, 10),
+	})
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (w *csvClickWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonClickWriter writes one JSON object per line.
+type ndjsonClickWriter struct {
+	encoder *json.Encoder
+}
+
+// Write writes a single row as a JSON line.
+func (w *ndjsonClickWriter) Write(row *ClickExportRow) error {
+	return w.encoder.Encode(row)
+}
+
+// Flush is a no-op; every line is written as soon as it is encoded.
+func (w *ndjsonClickWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/utils"
+)
+
+// ErrPrivateDestination is returned when a destination resolves to a private or internal address.
+var ErrPrivateDestination = errors.New(constants.ErrorPrivateDestination)
+
+// ErrUnresolvedDestination is returned when a destination's host cannot be looked up, so it
+// is unknown whether it is internal.
+var ErrUnresolvedDestination = errors.New(constants.ErrorUnresolvedDestination)
+
+// Resolver looks up the IP addresses of a host. *net.Resolver satisfies it; tests can
+// inject a fake to control what hosts resolve to.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// internalNetworks are the ranges destinations may not resolve to unless allowed:
+// loopback, link-local (including the 169.254.169.254 metadata service), RFC 1918,
+// carrier-grade NAT, unique local IPv6 (including AWS's fd00:ec2::254) and other
+// non-routable ranges.
+var internalNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // RFC 1918
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, cloud metadata services
+	"172.16.0.0/12",  // RFC 1918
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // RFC 1918
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // NAT64, may embed any of the IPv4 ranges above
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+// internalHostnames are names that resolve to metadata services inside cloud networks
+// but may not resolve (or resolve differently) where links are created.
+var internalHostnames = map[string]bool{
+	"localhost":                true,
+	"metadata":                 true,
+	"metadata.google.internal": true,
+	"instance-data":            true,
+}
+
+// DestinationPolicy rejects destinations that resolve to loopback, link-local, private
+// or metadata-service addresses, so short links cannot be used to reach internal services
+// through link-unfurling bots. Ranges can be allowed per short domain for intranet links.
+//
+// Hosts that do not exist (NXDOMAIN) are allowed: they cannot reach an internal service at
+// creation time and rejecting them would break links to domains that are not live yet. Any
+// other lookup failure, such as a timeout, is rejected, since the host may be internal.
+type DestinationPolicy struct {
+	resolver Resolver
+	timeout  time.Duration
+	allowed  map[string][]*net.IPNet // allowed ranges keyed by short domain host
+}
+
+// NewDestinationPolicy creates a destination policy.
+// allowed maps short domain hosts to CIDR ranges their links may point to; invalid
+// ranges are logged and ignored.
+func NewDestinationPolicy(resolver Resolver, timeout time.Duration, allowed map[string][]string) *DestinationPolicy {
+	policy := &DestinationPolicy{
+		resolver: resolver,
+		timeout:  timeout,
+		allowed:  make(map[string][]*net.IPNet, len(allowed)),
+	}
+	for host, cidrs := range allowed {
+		host = strings.ToLower(host)
+		for _, cidr := range cidrs {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				log.Printf("Warning: ignoring invalid private destination range %q for %s: %v", cidr, host, err)
+				continue
+			}
+			policy.allowed[host] = append(policy.allowed[host], network)
+		}
+	}
+	return policy
+}
+
+// Check returns ErrPrivateDestination if the URL's host is, or resolves to, an internal
+// address that is not allowed for the short domain, and ErrUnresolvedDestination if it
+// cannot be looked up. Numeric IPv4 forms such as "2130706433" are checked as addresses.
+// Only http and https destinations are checked; other schemes are not fetched by servers.
+func (p *DestinationPolicy) Check(rawURL, domain string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if internalHostnames[host] || strings.HasSuffix(host, ".localhost") {
+		if len(p.allowed[domainHost(domain)]) == 0 {
+			return fmt.Errorf("private destination: %w", ErrPrivateDestination)
+		}
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else if ip := utils.ParseNumericIPv4(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		defer cancel()
+		addrs, err := p.resolver.LookupIPAddr(ctx, host)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			log.Printf("Destination host %s does not exist, allowing it", host)
+			return nil
+		}
+		if err != nil {
+			log.Printf("Could not resolve destination host %s, rejecting it: %v", host, err)
+			return fmt.Errorf("unresolved destination: %w", ErrUnresolvedDestination)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	// Every address must be acceptable, otherwise DNS round-robin could still reach an internal host
+	for _, ip := range ips {
+		if err := p.CheckIP(ip, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIP returns ErrPrivateDestination if the address is internal and not allowed for the
+// short domain.
+func (p *DestinationPolicy) CheckIP(ip net.IP, domain string) error {
+	if isInternalIP(ip) && !containsIP(p.allowed[domainHost(domain)], ip) {
+		return fmt.Errorf("private destination: %w", ErrPrivateDestination)
+	}
+	return nil
+}
+
+// destinationDomainKey is the context key of the short domain whose link a request fetches.
+type destinationDomainKey struct{}
+
+// withDestinationDomain returns a context for fetching the destination of a link on the
+// short domain, so the dialer checks addresses against the domain's allowed ranges.
+func withDestinationDomain(ctx context.Context, domain string) context.Context {
+	return context.WithValue(ctx, destinationDomainKey{}, domain)
+}
+
+// DialContext connects to an address like net.Dialer.DialContext, refusing internal addresses
+// after they are resolved and before connecting. Checking every connection, rather than the
+// destination once, covers redirects to internal hosts and hosts whose DNS changed since they
+// were checked. The short domain is read from the context; see withDestinationDomain.
+func (p *DestinationPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	domain, _ := ctx.Value(destinationDomainKey{}).(string)
+	dialer := &net.Dialer{
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return fmt.Errorf("private destination: %w", ErrPrivateDestination)
+			}
+			return p.CheckIP(ip, domain)
+		},
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isInternalIP reports whether an address belongs to one of the internal networks.
+// IPv4-mapped IPv6 addresses are checked as IPv4.
+func isInternalIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return containsIP(internalNetworks, ip)
+}
+
+// containsIP reports whether any of the networks contains the address.
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustParseCIDRs parses a list of CIDR ranges, panicking on invalid input.
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// checkDestination applies the destination policy, if enabled, to a link on a short domain.
+func (s *URLService) checkDestination(rawURL, domain string) error {
+	if s.policy == nil {
+		return nil
+	}
+	return s.policy.Check(rawURL, domain)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// stubResolver resolves hosts from a table and fails the others with err.
+type stubResolver struct {
+	addrs   map[string][]string
+	err     error
+	lookups []string
+}
+
+func (r *stubResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups = append(r.lookups, host)
+	ips, ok := r.addrs[host]
+	if !ok {
+		return nil, r.err
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestDestinationPolicyNumericIPv4(t *testing.T) {
+	hosts := []string{
+		"2130706433",
+		"127.1",
+		"0x7f.0.0.1",
+		"0x7f000001",
+		"017700000001",
+		"0177.0.0.1",
+		"127.0.1",
+		"0xA9.254.169.254",
+		"2852039166", // 169.254.169.254
+	}
+	for _, host := range hosts {
+		t.Run(host, func(t *testing.T) {
+			resolver := &stubResolver{err: &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}}
+			policy := NewDestinationPolicy(resolver, time.Second, nil)
+
+			err := policy.Check("http://"+host+"/admin", "https://sho.rt")
+			if !errors.Is(err, ErrPrivateDestination) {
+				t.Fatalf("Check(%q) = %v, want ErrPrivateDestination", host, err)
+			}
+			if len(resolver.lookups) != 0 {
+				t.Errorf("Check(%q) looked up %v, want no lookup", host, resolver.lookups)
+			}
+		})
+	}
+}
+
+func TestDestinationPolicyLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		addrs   map[string][]string
+		err     error
+		allowed map[string][]string
+		want    error
+	}{
+		{
+			name:  "public",
+			host:  "example.com",
+			addrs: map[string][]string{"example.com": {"93.184.216.34"}},
+		},
+		{
+			name:  "private",
+			host:  "intranet.example.com",
+			addrs: map[string][]string{"intranet.example.com": {"10.0.0.5"}},
+			want:  ErrPrivateDestination,
+		},
+		{
+			name:  "one private address among public ones",
+			host:  "mixed.example.com",
+			addrs: map[string][]string{"mixed.example.com": {"93.184.216.34", "169.254.169.254"}},
+			want:  ErrPrivateDestination,
+		},
+		{
+			name:    "allowed range",
+			host:    "intranet.example.com",
+			addrs:   map[string][]string{"intranet.example.com": {"10.0.0.5"}},
+			allowed: map[string][]string{"sho.rt": {"10.0.0.0/8"}},
+		},
+		{
+			name: "nxdomain",
+			host: "not-live-yet.example.com",
+			err:  &net.DNSError{Err: "no such host", Name: "not-live-yet.example.com", IsNotFound: true},
+		},
+		{
+			name: "timeout",
+			host: "slow.example.com",
+			err:  &net.DNSError{Err: "i/o timeout", Name: "slow.example.com", IsTimeout: true},
+			want: ErrUnresolvedDestination,
+		},
+		{
+			name: "server failure",
+			host: "broken.example.com",
+			err:  &net.DNSError{Err: "server misbehaving", Name: "broken.example.com", IsTemporary: true},
+			want: ErrUnresolvedDestination,
+		},
+		{
+			name: "context deadline",
+			host: "slow.example.com",
+			err:  context.DeadlineExceeded,
+			want: ErrUnresolvedDestination,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewDestinationPolicy(&stubResolver{addrs: tt.addrs, err: tt.err}, time.Second, tt.allowed)
+
+			err := policy.Check("https://"+tt.host+"/path", "https://sho.rt")
+			if tt.want == nil && err != nil {
+				t.Fatalf("Check(%q) = %v, want nil", tt.host, err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Check(%q) = %v, want %v", tt.host, err, tt.want)
+			}
+		})
+	}
+}
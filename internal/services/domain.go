@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// Domains returns every short domain served by this instance; the first one is the default.
+func (s *URLService) Domains() []string {
+	return s.config.Domains
+}
+
+// DomainForHost returns the configured short domain matching a request's Host header.
+// Requests on hosts that are not configured (e.g. direct IP access) use the default domain.
+func (s *URLService) DomainForHost(host string) string {
+	if domain, ok := s.findDomain(host); ok {
+		return domain
+	}
+	return s.config.Domain
+}
+
+// LookupDomain returns the configured short domain named by a client, either as a host
+// (e.g. "acme.link") or as an origin (e.g. "https://acme.link"). An empty name selects
+// the default domain.
+func (s *URLService) LookupDomain(name string) (string, error) {
+	if name == "" {
+		return s.config.Domain, nil
+	}
+	if strings.Contains(name, "://") {
+		name = domainHost(name)
+	}
+	if domain, ok := s.findDomain(name); ok {
+		return domain, nil
+	}
+	return "", fmt.Errorf("unknown domain: %s", constants.ErrorUnknownDomain)
+}
+
+// findDomain looks up a configured short domain by host, ignoring case.
+func (s *URLService) findDomain(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	for _, domain := range s.config.Domains {
+		if domainHost(domain) == host {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// LinkKey returns the database key of a short code within a domain's namespace.
+// Codes on the default domain are stored under the bare code so links created before
+// multiple domains were supported keep working; other domains use "<host>/<code>".
+// Short codes cannot contain '/', so the two forms never collide.
+func (s *URLService) LinkKey(domain, shortCode string) string {
+	if domain == "" || domain == s.config.Domain {
+		return shortCode
+	}
+	return domainHost(domain) + "/" + shortCode
+}
+
+// linkHostPattern matches the host, with any port, that prefixes link keys of other domains.
+var linkHostPattern = regexp.MustCompile(`^[a-z0-9.-]+(:[0-9]+)?$`)
+
+// isLinkKey reports whether a key of the links database has the shape of a link key, a short
+// code optionally prefixed with a domain's host, so scans can tell links from other keys.
+func isLinkKey(key string) bool {
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		if !linkHostPattern.MatchString(key[:i]) {
+			return false
+		}
+		key = key[i+1:]
+	}
+	return shortCodePattern.MatchString(key)
+}
+
+// splitLinkKey is the inverse of LinkKey. Keys for hosts that are no longer configured
+// are attributed to that host using the default domain's scheme.
+func (s *URLService) splitLinkKey(key string) (string, string) {
+	i := strings.Index(key, "/")
+	if i < 0 {
+		return s.config.Domain, key
+	}
+
+	host, shortCode := key[:i], key[i+1:]
+	if domain, ok := s.findDomain(host); ok {
+		return domain, shortCode
+	}
+	scheme := "https"
+	if parsed, err := url.Parse(s.config.Domain); err == nil && parsed.Scheme != "" {
+		scheme = parsed.Scheme
+	}
+	return scheme + "://" + host, shortCode
+}
+
+// domainHost returns the lowercase host (including any port) of a domain origin.
+func domainHost(domain string) string {
+	parsed, err := url.Parse(domain)
+	if err != nil || parsed.Host == "" {
+		return strings.ToLower(domain)
+	}
+	return strings.ToLower(parsed.Host)
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// newTestDomainService returns a URL service serving a default domain and two others,
+// one of them on a port.
+func newTestDomainService() *URLService {
+	return NewURLService(&config.Config{
+		Domain:          "https://sho.rt",
+		Domains:         []string{"https://sho.rt", "https://Go.Acme.com", "http://localhost:3000"},
+		AllowedSchemes:  []string{"http", "https"},
+		ShortenerAction: constants.ShortenerActionAllow,
+	})
+}
+
+func TestDomainLookup(t *testing.T) {
+	urlService := newTestDomainService()
+
+	tests := []struct {
+		name    string
+		value   string
+		forHost string // DomainForHost of the value
+		lookup  string // LookupDomain of the value; empty if unknown
+	}{
+		{"default domain", "sho.rt", "https://sho.rt", "https://sho.rt"},
+		{"other domain", "go.acme.com", "https://Go.Acme.com", "https://Go.Acme.com"},
+		{"host in another case", "GO.ACME.COM", "https://Go.Acme.com", "https://Go.Acme.com"},
+		{"host with a port", "localhost:3000", "http://localhost:3000", "http://localhost:3000"},
+		{"host without its port", "localhost", "https://sho.rt", ""},
+		{"origin", "https://go.acme.com", "https://sho.rt", "https://Go.Acme.com"},
+		{"unknown host", "203.0.113.7", "https://sho.rt", ""},
+		{"no host", "", "https://sho.rt", "https://sho.rt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Requests on unknown hosts, such as direct IP access, are served on the default domain
+			if got := urlService.DomainForHost(tt.value); got != tt.forHost {
+				t.Errorf("DomainForHost(%q) = %q, want %q", tt.value, got, tt.forHost)
+			}
+			// Clients naming a domain that is not served get an error instead
+			got, err := urlService.LookupDomain(tt.value)
+			if tt.lookup == "" {
+				if err == nil || !strings.Contains(err.Error(), constants.ErrorUnknownDomain) {
+					t.Errorf("LookupDomain(%q) = %q, %v, want an unknown domain error", tt.value, got, err)
+				}
+			} else if err != nil || got != tt.lookup {
+				t.Errorf("LookupDomain(%q) = %q, %v, want %q", tt.value, got, err, tt.lookup)
+			}
+		})
+	}
+}
+
+func TestLinkKey(t *testing.T) {
+	urlService := newTestDomainService()
+
+	tests := []struct {
+		name    string
+		domain  string
+		code    string
+		key     string
+		splitAs string // Domain splitLinkKey returns, when it differs from domain
+	}{
+		{name: "default domain", domain: "https://sho.rt", code: "promo", key: "promo"},
+		{name: "no domain", code: "promo", key: "promo", splitAs: "https://sho.rt"},
+		{name: "other domain", domain: "https://Go.Acme.com", code: "promo", key: "go.acme.com/promo"},
+		{name: "domain with a port", domain: "http://localhost:3000", code: "a.b~c", key: "localhost:3000/a.b~c"},
+		{name: "domain no longer served", domain: "https://old.example", code: "promo", key: "old.example/promo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := urlService.LinkKey(tt.domain, tt.code)
+			if key != tt.key {
+				t.Fatalf("LinkKey = %q, want %q", key, tt.key)
+			}
+			wantDomain := tt.domain
+			if tt.splitAs != "" {
+				wantDomain = tt.splitAs
+			}
+			if domain, code := urlService.splitLinkKey(key); domain != wantDomain || code != tt.code {
+				t.Errorf("splitLinkKey(%q) = %q, %q, want %q, %q", key, domain, code, wantDomain, tt.code)
+			}
+			if !isLinkKey(key) {
+				t.Errorf("isLinkKey(%q) = false, want true", key)
+			}
+		})
+	}
+
+	// Other keys of the links database are not link keys
+	for _, key := range []string{"reporter:secret", "meta:promo", "Go.Acme.com/promo", "go.acme.com/", "/promo", "go.acme.com/a/b", ""} {
+		if isLinkKey(key) {
+			t.Errorf("isLinkKey(%q) = true, want false", key)
+		}
+	}
+}
+
+func TestShortCodesAreScopedToTheirDomain(t *testing.T) {
+	startTestRedis(t)
+	urlService := newTestDomainService()
+
+	links := []struct {
+		domain string
+		url    string
+		short  string
+	}{
+		{"", "https://example.com/default", "https://sho.rt/promo"},
+		{"go.acme.com", "https://acme.example/sale", "https://Go.Acme.com/promo"},
+		{"localhost:3000", "https://example.com/local", "http://localhost:3000/promo"},
+	}
+	for _, link := range links {
+		resp, err := urlService.ShortenURL(&ShortenURLRequest{URL: link.url, CustomShort: "promo", Domain: link.domain})
+		if err != nil {
+			t.Fatalf("ShortenURL on %q = %v", link.domain, err)
+		}
+		if resp.CustomShort != link.short {
+			t.Errorf("short URL = %q, want %q", resp.CustomShort, link.short)
+		}
+	}
+
+	// The same code is taken again only on the domain that has it
+	_, err := urlService.ShortenURL(&ShortenURLRequest{URL: "https://example.com/other", CustomShort: "promo", Domain: "go.acme.com"})
+	if err == nil || !strings.Contains(err.Error(), constants.ErrorURLShortInUse) {
+		t.Errorf("ShortenURL of a code in use = %v, want it refused", err)
+	}
+	if _, err := urlService.ShortenURL(&ShortenURLRequest{URL: "https://example.com/", Domain: "unknown.example"}); err == nil {
+		t.Error("ShortenURL on an unknown domain succeeded")
+	}
+
+	for _, link := range links {
+		domain, _ := urlService.LookupDomain(link.domain)
+		got, err := urlService.GetLink(domain, "promo")
+		if err != nil || got.URL != link.url {
+			t.Errorf("GetLink(%q, promo) = %+v, %v, want %q", domain, got, err, link.url)
+		}
+	}
+	if _, err := urlService.GetLink("https://old.example", "promo"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("GetLink on another domain = %v, want ErrLinkNotFound", err)
+	}
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// HealthCheck is the outcome of probing a link's destination once.
+type HealthCheck struct {
+	CheckedAt  time.Time `json:"checked_at"`
+	Healthy    bool      `json:"healthy"`
+	StatusCode int       `json:"status_code,omitempty"` // HTTP status of the final response
+	Error      string    `json:"error,omitempty"`       // Network error, when there was no response
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// HealthEvent is the payload posted to the health webhook when a link changes state.
+type HealthEvent struct {
+	Event    string       `json:"event"` // HealthEventBroken or HealthEventRecovered
+	Domain   string       `json:"domain"`
+	Short    string       `json:"short"`
+	ShortURL string       `json:"short_url"`
+	URL      string       `json:"url"`
+	Check    *HealthCheck `json:"check"`
+}
+
+// probeTarget is a link queued for probing, with the state needed to record the outcome.
+type probeTarget struct {
+	link     *Link
+	key      string
+	ttl      time.Duration // Remaining lifetime of the link; history must not outlive it
+	health   string        // Health before this probe
+	failures int           // Consecutive failed probes before this one
+}
+
+// HealthProber periodically probes link destinations and records their health.
+//
+// Destinations are probed with HEAD, falling back to GET when HEAD is not supported,
+// following redirects. Network errors, 404, 410 and 5xx responses count as failures;
+// other statuses (including 401, 403 and 429) show the destination exists. A link is
+// marked broken after HealthFailureThreshold consecutive failures so a single hiccup
+// does not flag it, and the optional webhook is notified when a link becomes broken
+// or recovers.
+//
+// Probes run on a bounded number of workers, and requests to the same host are spaced
+// by the configured delay so large numbers of links to one site do not hammer it.
+type HealthProber struct {
+	urlService    *URLService
+	client        HTTPDoer
+	webhookClient HTTPDoer
+	webhookURL    string
+	concurrency   int
+	hostDelay     time.Duration
+
+	mu       sync.Mutex
+	nextSlot map[string]time.Time // Earliest time the next request to each host may start
+}
+
+// NewHealthProber creates a health prober using the given HTTP client for probes.
+// The client should follow redirects, have a timeout and refuse internal addresses; see
+// NewProbeClient. Webhooks, which may well go to internal addresses, use their own client.
+func NewHealthProber(cfg *config.Config, urlService *URLService, client HTTPDoer) *HealthProber {
+	concurrency := cfg.HealthCheckConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &HealthProber{
+		urlService:    urlService,
+		client:        client,
+		webhookClient: &http.Client{Timeout: constants.HealthCheckTimeout},
+		webhookURL:    cfg.HealthWebhookURL,
+		concurrency:   concurrency,
+		hostDelay:     cfg.HealthCheckHostDelay,
+		nextSlot:      make(map[string]time.Time),
+	}
+}
+
+// NewProbeClient returns the HTTP client used for destination probes. With a destination
+// policy, every connection is checked against it, so destinations that redirect to internal
+// addresses cannot be used to reach them. Proxies are never used: they would hide the
+// addresses connected to.
+func NewProbeClient(policy *DestinationPolicy) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	if policy != nil {
+		transport.DialContext = policy.DialContext
+	}
+	return &http.Client{Timeout: constants.HealthCheckTimeout, Transport: transport}
+}
+
+// Run probes every link immediately and then once per interval, until the context is cancelled.
+func (p *HealthProber) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.ProbeAll(ctx); err != nil {
+			log.Printf("Health check round failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes the destination of every link once and records the results.
+// Links are read with SCAN in batches, so memory use does not grow with the number of links.
+func (p *HealthProber) ProbeAll(ctx context.Context) error {
+	p.pruneHostSlots(time.Now())
+
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	targets := make(chan *probeTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targets {
+				p.probeAndRecord(ctx, r, target)
+			}
+		}()
+	}
+
+	err := p.scanTargets(ctx, r, targets)
+	close(targets)
+	wg.Wait()
+	return err
+}
+
+// scanTargets reads links in batches and queues those with web destinations.
+func (p *HealthProber) scanTargets(ctx context.Context, r *redis.Client, targets chan<- *probeTarget) error {
+	var cursor uint64
+	for {
+		// URL mappings are the only string keys in the mappings database
+		keys, next, err := r.ScanType(ctx, cursor, "*", constants.ExportBatchSize, "string").Result()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		batch, err := p.loadTargets(ctx, r, keys)
+		if err != nil {
+			return err
+		}
+		for _, target := range batch {
+			select {
+			case targets <- target:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// loadTargets reads the URL, metadata and expiry of a batch of links in one round trip.
+func (p *HealthProber) loadTargets(ctx context.Context, r *redis.Client, keys []string) ([]*probeTarget, error) {
+	gets := make([]*redis.StringCmd, len(keys))
+	metas := make([]*redis.StringStringMapCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(ctx, key)
+			metas[i] = pipe.HGetAll(ctx, constants.LinkMetaPrefix+key)
+			ttls[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	targets := make([]*probeTarget, 0, len(keys))
+	for i, key := range keys {
+		// The link may have expired between SCAN and GET
+		if gets[i].Err() != nil {
+			continue
+		}
+
+		domain, shortCode := p.urlService.splitLinkKey(key)
+		link := &Link{Domain: domain, ShortCode: shortCode, URL: gets[i].Val()}
+		meta := metas[i].Val()
+		parseLinkMeta(link, meta)
+
+		// Deep links and other schemes cannot be probed over HTTP
+		parsed, err := url.Parse(link.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			continue
+		}
+
+		failures, _ := strconv.Atoi(meta["health_failures"])
+		targets = append(targets, &probeTarget{
+			link:     link,
+			key:      key,
+			ttl:      ttls[i].Val(),
+			health:   link.Health,
+			failures: failures,
+		})
+	}
+	return targets, nil
+}
+
+// probeAndRecord probes a link, records the outcome and sends webhooks on state changes.
+func (p *HealthProber) probeAndRecord(ctx context.Context, r *redis.Client, target *probeTarget) {
+	check := p.Probe(ctx, target.link)
+	if check == nil {
+		return
+	}
+
+	failures := 0
+	if !check.Healthy {
+		failures = target.failures + 1
+	}
+	health := constants.LinkHealthOK
+	if failures >= constants.HealthFailureThreshold {
+		health = constants.LinkHealthBroken
+	} else if failures > 0 && target.health == constants.LinkHealthBroken {
+		health = constants.LinkHealthBroken // Stays broken until a probe succeeds
+	}
+
+	if err := p.record(ctx, r, target, check, health, failures); err != nil {
+		log.Printf("Failed to record health of %s: %v", target.key, err)
+		return
+	}
+
+	switch {
+	case health == constants.LinkHealthBroken && target.health != constants.LinkHealthBroken:
+		p.notify(ctx, constants.HealthEventBroken, target.link, check)
+	case health == constants.LinkHealthOK && target.health == constants.LinkHealthBroken:
+		p.notify(ctx, constants.HealthEventRecovered, target.link, check)
+	}
+}
+
+// Probe checks a link's destination once. Returns nil if the context was cancelled
+// before the probe could finish.
+func (p *HealthProber) Probe(ctx context.Context, link *Link) *HealthCheck {
+	// DNS may have changed since the link was created
+	if err := p.urlService.checkDestination(link.URL, link.Domain); err != nil {
+		return &HealthCheck{CheckedAt: time.Now().UTC(), Error: err.Error()}
+	}
+
+	parsed, err := url.Parse(link.URL)
+	if err != nil {
+		return &HealthCheck{CheckedAt: time.Now().UTC(), Error: err.Error()}
+	}
+	if !p.waitForHost(ctx, parsed.Hostname()) {
+		return nil
+	}
+
+	start := time.Now()
+	check := &HealthCheck{CheckedAt: start.UTC()}
+	status, err := p.fetchStatus(withDestinationDomain(ctx, link.Domain), link.URL)
+	check.DurationMs = time.Since(start).Milliseconds()
+	// A probe cut short says nothing about the destination
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	check.StatusCode = status
+	check.Healthy = status != http.StatusNotFound && status != http.StatusGone && status < 500
+	return check
+}
+
+// fetchStatus returns the status of the final response for a URL.
+// HEAD is tried first; destinations that reject it are asked with GET.
+func (p *HealthProber) fetchStatus(ctx context.Context, rawURL string) (int, error) {
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("User-Agent", constants.OutboundUserAgent)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+
+		status = resp.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	return status, nil
+}
+
+// waitForHost blocks until a request to the host may start, spacing requests to the
+// same host by the host delay. Returns false if the context is cancelled first.
+func (p *HealthProber) waitForHost(ctx context.Context, host string) bool {
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.nextSlot[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	p.nextSlot[host] = slot.Add(p.hostDelay)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pruneHostSlots forgets the hosts whose next slot has passed, which may be probed right away,
+// so the slots kept do not grow with every host ever probed.
+func (p *HealthProber) pruneHostSlots(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for host, slot := range p.nextSlot {
+		if !slot.After(now) {
+			delete(p.nextSlot, host)
+		}
+	}
+}
+
+// record stores the outcome of a probe in the link's metadata and prepends it to the
+// link's health history, keeping the last MaxHealthHistory checks.
+func (p *HealthProber) record(ctx context.Context, r *redis.Client, target *probeTarget, check *HealthCheck, health string, failures int) error {
+	entry, err := json.Marshal(check)
+	if err != nil {
+		return err
+	}
+
+	metaKey := constants.LinkMetaPrefix + target.key
+	historyKey := constants.LinkHealthPrefix + target.key
+	_, err = r.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, metaKey, map[string]interface{}{
+			"health":            health,
+			"health_checked_at": check.CheckedAt.Unix(),
+			"health_failures":   failures,
+		})
+		pipe.LPush(ctx, historyKey, entry)
+		pipe.LTrim(ctx, historyKey, 0, constants.MaxHealthHistory-1)
+		// Neither key may outlive the link; links without expiry have a negative TTL
+		if target.ttl > 0 {
+			pipe.PExpire(ctx, metaKey, target.ttl)
+			pipe.PExpire(ctx, historyKey, target.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	return nil
+}
+
+// notify posts a health event to the webhook, if one is configured.
+// Failures are logged; the next state change will be delivered independently.
+func (p *HealthProber) notify(ctx context.Context, event string, link *Link, check *HealthCheck) {
+	if p.webhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(&HealthEvent{
+		Event:    event,
+		Domain:   link.Domain,
+		Short:    link.ShortCode,
+		ShortURL: p.urlService.ShortURL(link.Domain, link.ShortCode),
+		URL:      link.URL,
+		Check:    check,
+	})
+	if err != nil {
+		log.Printf("Failed to encode health webhook: %v", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to create health webhook request: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", constants.OutboundUserAgent)
+
+	resp, err := p.webhookClient.Do(req)
+	if err != nil {
+		log.Printf("Health webhook failed for %s: %v", link.ShortCode, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Health webhook for %s returned status %d", link.ShortCode, resp.StatusCode)
+	}
+}
+
+// GetHealthHistory returns the most recent health checks of a link, newest first.
+func (s *URLService) GetHealthHistory(domain, shortCode string) ([]*HealthCheck, error) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	entries, err := r.LRange(database.Ctx, constants.LinkHealthPrefix+s.LinkKey(domain, shortCode), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	history := make([]*HealthCheck, 0, len(entries))
+	for _, entry := range entries {
+		check := &HealthCheck{}
+		if err := json.Unmarshal([]byte(entry), check); err != nil {
+			continue
+		}
+		history = append(history, check)
+	}
+	return history, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+)
+
+func TestProbeClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	// The test server is on loopback, which only the intranet short domain may link to
+	policy := NewDestinationPolicy(&stubResolver{}, time.Second, map[string][]string{
+		"intranet.sho.rt": {"127.0.0.0/8"},
+	})
+	client := NewProbeClient(policy)
+
+	tests := []struct {
+		name   string
+		domain string
+	}{
+		{"internal destination", "https://sho.rt"},
+		{"redirect to an internal address", "https://intranet.sho.rt"},
+		{"no short domain", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.domain != "" {
+				ctx = withDestinationDomain(ctx, tt.domain)
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if !errors.Is(err, ErrPrivateDestination) {
+				t.Fatalf("Do = %v, want ErrPrivateDestination", err)
+			}
+		})
+	}
+}
+
+func TestProbeClientAllowsAllowedRanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	policy := NewDestinationPolicy(&stubResolver{}, time.Second, map[string][]string{
+		"intranet.sho.rt": {"127.0.0.0/8"},
+	})
+	ctx := withDestinationDomain(context.Background(), "https://intranet.sho.rt")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewProbeClient(policy).Do(req)
+	if err != nil {
+		t.Fatalf("Do = %v, want the allowed range to be reachable", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
+
+func TestHealthProberForgetsPassedHostSlots(t *testing.T) {
+	startTestRedis(t)
+	prober := NewHealthProber(&config.Config{HealthCheckHostDelay: time.Hour}, nil, nil)
+
+	// Requests to a host are spaced by the delay, and the host is remembered until then
+	ctx, cancel := context.WithCancel(context.Background())
+	if !prober.waitForHost(ctx, "example.com") {
+		t.Fatal("first request to a host waited")
+	}
+	cancel()
+	if prober.waitForHost(ctx, "example.com") {
+		t.Fatal("second request to a host did not wait for the delay")
+	}
+	now := time.Now()
+	prober.nextSlot["passed.example.com"] = now.Add(-time.Second)
+
+	if err := prober.ProbeAll(context.Background()); err != nil {
+		t.Fatalf("ProbeAll = %v", err)
+	}
+	if _, ok := prober.nextSlot["passed.example.com"]; ok || len(prober.nextSlot) != 1 {
+		t.Errorf("slots after a probe round = %v, want only example.com", prober.nextSlot)
+	}
+
+	prober.pruneHostSlots(now.Add(3 * time.Hour))
+	if len(prober.nextSlot) != 0 {
+		t.Errorf("slots once every delay has passed = %v, want none", prober.nextSlot)
+	}
+}
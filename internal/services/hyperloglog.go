@@ -0,0 +1,228 @@
+package services
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// hllPrecision is the number of hash bits selecting a register. With 2^14 registers the
+// standard error is 0.81%, as with Redis HyperLogLogs.
+const hllPrecision = 14
+
+// hllRegisters is the number of registers of a HyperLogLog.
+const hllRegisters = 1 << hllPrecision
+
+// hllSparseMax is the number of registers a sparse HyperLogLog may set before it is made
+// dense; beyond it the sparse form would be larger than the dense one.
+const hllSparseMax = hllRegisters / 4
+
+// hyperLogLog estimates the number of distinct members added to it, like a Redis HyperLogLog.
+// It starts sparse, storing only the registers that are set, so the many HyperLogLogs of links
+// with few visitors stay small, and becomes dense, one byte per register, as it fills.
+type hyperLogLog struct {
+	sparse []uint32 // Set registers as index<<8 | value, sorted by index; nil once dense
+	dense  []uint8
+}
+
+// hllHash hashes a member to 64 bits: FNV-1a, finished with MurmurHash3's mixer so every
+// bit depends on every input bit, as the register index and rank need.
+func hllHash(member string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// add adds a member.
+func (h *hyperLogLog) add(member string) {
+	x := hllHash(member)
+	index := uint32(x >> (64 - hllPrecision))
+	// The rank is the position of the first set bit in the remaining bits
+	rank := bits.LeadingZeros64(x<<hllPrecision) + 1
+	if rank > 64-hllPrecision+1 {
+		rank = 64 - hllPrecision + 1
+	}
+	h.set(index, uint8(rank))
+}
+
+// set raises a register to value if it is lower.
+func (h *hyperLogLog) set(index uint32, value uint8) {
+	if h.dense != nil {
+		if h.dense[index] < value {
+			h.dense[index] = value
+		}
+		return
+	}
+
+	i := sort.Search(len(h.sparse), func(i int) bool { return h.sparse[i]>>8 >= index })
+	if i < len(h.sparse) && h.sparse[i]>>8 == index {
+		if uint8(h.sparse[i]) < value {
+			h.sparse[i] = index<<8 | uint32(value)
+		}
+		return
+	}
+	if len(h.sparse) >= hllSparseMax {
+		h.makeDense()
+		h.dense[index] = value
+		return
+	}
+	h.sparse = append(h.sparse, 0)
+	copy(h.sparse[i+1:], h.sparse[i:])
+	h.sparse[i] = index<<8 | uint32(value)
+}
+
+// makeDense converts a sparse HyperLogLog to the dense form.
+func (h *hyperLogLog) makeDense() {
+	h.dense = make([]uint8, hllRegisters)
+	for _, entry := range h.sparse {
+		h.dense[entry>>8] = uint8(entry)
+	}
+	h.sparse = nil
+}
+
+// merge raises every register to the other's, so the HyperLogLog counts the union of both.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	if other.dense != nil {
+		if h.dense == nil {
+			h.makeDense()
+		}
+		for i, value := range other.dense {
+			if h.dense[i] < value {
+				h.dense[i] = value
+			}
+		}
+		return
+	}
+	for _, entry := range other.sparse {
+		h.set(entry>>8, uint8(entry))
+	}
+}
+
+// count returns the estimated number of distinct members, using linear counting while many
+// registers are still zero.
+func (h *hyperLogLog) count() int64 {
+	m := float64(hllRegisters)
+	zeros := 0
+	sum := 0.0
+	if h.dense != nil {
+		for _, value := range h.dense {
+			if value == 0 {
+				zeros++
+			}
+			sum += math.Ldexp(1, -int(value))
+		}
+	} else {
+		zeros = hllRegisters - len(h.sparse)
+		sum = float64(zeros)
+		for _, entry := range h.sparse {
+			sum += math.Ldexp(1, -int(uint8(entry)))
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// memoryVisitorStore keeps unique visitor HyperLogLogs in the memory of a single instance,
+// under the keys they would have in Redis, for VISITOR_STORE=memory. Counts are lost when
+// the instance stops. It is safe for concurrent use.
+type memoryVisitorStore struct {
+	mu        sync.Mutex
+	hlls      map[string]*memoryHyperLogLog
+	nextSweep time.Time
+}
+
+// memoryHyperLogLog is a HyperLogLog and when it may be forgotten; zero if never.
+type memoryHyperLogLog struct {
+	hll     hyperLogLog
+	expires time.Time
+}
+
+// memoryVisitors is the store shared by every analytics service of the instance.
+var memoryVisitors = &memoryVisitorStore{hlls: make(map[string]*memoryHyperLogLog)}
+
+// add adds a visitor's fingerprint to the HyperLogLog at key, which expires at expireAt
+// unless it is zero.
+func (m *memoryVisitorStore) add(key, fingerprint string, expireAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+	entry, ok := m.hlls[key]
+	if !ok || m.expired(entry, now) {
+		entry = &memoryHyperLogLog{}
+		m.hlls[key] = entry
+	}
+	entry.hll.add(fingerprint)
+	entry.expires = expireAt
+}
+
+// count returns the estimated number of distinct visitors across the HyperLogLogs at keys.
+func (m *memoryVisitorStore) count(keys ...string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if len(keys) == 1 {
+		if entry, ok := m.hlls[keys[0]]; ok && !m.expired(entry, now) {
+			return entry.hll.count()
+		}
+		return 0
+	}
+	union := &hyperLogLog{}
+	for _, key := range keys {
+		if entry, ok := m.hlls[key]; ok && !m.expired(entry, now) {
+			union.merge(&entry.hll)
+		}
+	}
+	return union.count()
+}
+
+// purge forgets the HyperLogLogs whose keys match and returns how many there were.
+func (m *memoryVisitorStore) purge(matches func(key string) bool) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for key := range m.hlls {
+		if matches(key) {
+			delete(m.hlls, key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// expired reports whether a HyperLogLog has expired.
+func (m *memoryVisitorStore) expired(entry *memoryHyperLogLog, now time.Time) bool {
+	return !entry.expires.IsZero() && !now.Before(entry.expires)
+}
+
+// sweep forgets expired HyperLogLogs at most once per VisitorSweepInterval. The caller holds
+// the mutex.
+func (m *memoryVisitorStore) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(constants.VisitorSweepInterval)
+	for key, entry := range m.hlls {
+		if m.expired(entry, now) {
+			delete(m.hlls, key)
+		}
+	}
+}
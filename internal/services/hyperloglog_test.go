@@ -0,0 +1,120 @@
+package services
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHyperLogLogCount(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 1000, 10000, 100000, 1000000} {
+		h := &hyperLogLog{}
+		for i := 0; i < n; i++ {
+			h.add("visitor-" + strconv.Itoa(i))
+			h.add("visitor-" + strconv.Itoa(i)) // Members added again are not counted again
+		}
+		got := h.count()
+		// Six standard errors, so the test never fails by chance
+		if tolerance := math.Max(1, 6*0.0081*float64(n)); math.Abs(float64(got-int64(n))) > tolerance {
+			t.Errorf("count of %d members = %d, want within %.0f", n, got, tolerance)
+		}
+	}
+}
+
+func TestHyperLogLogStaysSparseWhileSmall(t *testing.T) {
+	h := &hyperLogLog{}
+	for i := 0; i < 1000; i++ {
+		h.add(strconv.Itoa(i))
+	}
+	if h.dense != nil {
+		t.Fatalf("HyperLogLog of 1000 members is dense")
+	}
+
+	for i := 1000; i < 20000; i++ {
+		h.add(strconv.Itoa(i))
+	}
+	if h.dense == nil {
+		t.Fatalf("HyperLogLog of 20000 members is sparse")
+	}
+}
+
+func TestHyperLogLogSparseAndDenseAgree(t *testing.T) {
+	sparse, dense := &hyperLogLog{}, &hyperLogLog{}
+	dense.makeDense()
+	for i := 0; i < 3000; i++ {
+		sparse.add(strconv.Itoa(i))
+		dense.add(strconv.Itoa(i))
+	}
+	if sparse.dense != nil {
+		t.Fatalf("HyperLogLog of 3000 members is dense")
+	}
+	if sparse.count() != dense.count() {
+		t.Errorf("sparse count = %d, dense count = %d", sparse.count(), dense.count())
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b, both := &hyperLogLog{}, &hyperLogLog{}, &hyperLogLog{}
+	for i := 0; i < 30000; i++ {
+		a.add(strconv.Itoa(i))
+		both.add(strconv.Itoa(i))
+	}
+	// Half of b's members are also in a
+	for i := 15000; i < 45000; i++ {
+		b.add(strconv.Itoa(i))
+		both.add(strconv.Itoa(i))
+	}
+
+	union := &hyperLogLog{}
+	union.merge(a)
+	union.merge(b)
+	if union.count() != both.count() {
+		t.Errorf("count of merged HyperLogLogs = %d, want %d as if all members were added to one", union.count(), both.count())
+	}
+}
+
+func TestMemoryVisitorStore(t *testing.T) {
+	store := &memoryVisitorStore{hlls: make(map[string]*memoryHyperLogLog)}
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	for i := 0; i < 100; i++ {
+		store.add("visitors:abc:20240501", "a"+strconv.Itoa(i), future)
+		store.add("visitors:abc:20240502", "b"+strconv.Itoa(i), future)
+		store.add("visitors:abc:20240430", "c"+strconv.Itoa(i), past)
+		store.add("visitors:def", "d"+strconv.Itoa(i), time.Time{})
+	}
+
+	tests := []struct {
+		keys []string
+		want int64
+	}{
+		{[]string{"visitors:abc:20240501"}, 100},
+		{[]string{"visitors:abc:20240501", "visitors:abc:20240502"}, 200},
+		{[]string{"visitors:abc:20240430"}, 0}, // Expired
+		{[]string{"visitors:def"}, 100},
+		{[]string{"visitors:none"}, 0},
+	}
+	// Counts are estimates, off by a visitor or two at this size
+	near := func(got, want int64) bool {
+		return got >= want-2 && got <= want+2
+	}
+	for _, tt := range tests {
+		if got := store.count(tt.keys...); !near(got, tt.want) {
+			t.Errorf("count(%v) = %d, want about %d", tt.keys, got, tt.want)
+		}
+	}
+
+	purged := store.purge(func(key string) bool {
+		linkKey, ok := analyticsLinkKey(key)
+		return ok && linkKey == "abc"
+	})
+	if purged != 3 {
+		t.Errorf("purge removed %d HyperLogLogs, want 3", purged)
+	}
+	if got := store.count("visitors:abc:20240501"); got != 0 {
+		t.Errorf("count after purge = %d, want 0", got)
+	}
+	if got := store.count("visitors:def"); !near(got, 100) {
+		t.Errorf("count of another link after purge = %d, want about 100", got)
+	}
+}
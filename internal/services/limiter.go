@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// Limiter decides whether clients may make requests. Every decision is atomic, so concurrent
+// requests of a client can never take more than its quota. Implementations are safe for
+// concurrent use.
+type Limiter interface {
+	// Allow takes n requests from the client's quota if they are all allowed now and returns
+	// the decision with the client's quota afterwards. With n of zero nothing is taken; the
+	// client is allowed if a single request would be.
+	Allow(key string, n int) (*RateLimitInfo, error)
+	// Refund gives back n requests taken by Allow that turned out not to count.
+	Refund(key string, n int) error
+}
+
+// Clock tells limiters the time, so their decisions can be reproduced with a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real clock.
+var SystemClock Clock = systemClock{}
+
+// systemClock reads the system time.
+type systemClock struct{}
+
+// Now returns the current time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewLimiter creates the limiter selected by RATE_LIMIT_ALGORITHM, allowing APIQuota requests
+// per RateLimit window and keeping its state in RATE_LIMIT_STORE. Redis limiters take the time
+// from the clock too, so instances sharing Redis need synchronized clocks.
+func NewLimiter(cfg *config.Config, clock Clock) Limiter {
+	params := limitParams{
+		quota:  float64(cfg.APIQuota),
+		window: float64(cfg.RateLimit) / float64(time.Millisecond),
+	}
+	// A zero quota or window means the same to every algorithm, and the fixed window needs no
+	// division by them
+	var algorithm rateLimitAlgorithm
+	switch algorithmName := cfg.RateLimitAlgorithm; {
+	case params.quota <= 0 || params.window <= 0:
+		algorithm = fixedWindow{params}
+	case algorithmName == constants.RateLimitSlidingWindow:
+		algorithm = slidingWindow{params}
+	case algorithmName == constants.RateLimitTokenBucket:
+		algorithm = tokenBucket{params}
+	case algorithmName == constants.RateLimitGCRA:
+		algorithm = gcra{params}
+	default:
+		algorithm = fixedWindow{params}
+	}
+
+	if cfg.RateLimitStore == constants.RateLimitStoreMemory {
+		return &memoryLimiter{
+			algorithm: algorithm,
+			clock:     clock,
+			states:    make(map[string]*memoryLimitState),
+		}
+	}
+	return &redisLimiter{
+		algorithm: algorithm,
+		clock:     clock,
+		script:    redis.NewScript(limiterScriptPrelude + algorithm.script() + limiterScriptEpilogue),
+	}
+}
+
+// limitState is the state a rate limiting algorithm keeps per client: up to three numbers,
+// with times in milliseconds since the Unix epoch. A client without state has all zeros.
+type limitState [3]float64
+
+// limitParams are the quota and window, in milliseconds, of a rate limiting algorithm.
+type limitParams struct {
+	quota  float64
+	window float64
+}
+
+// params returns the quota and window; algorithms embed limitParams.
+func (p limitParams) params() limitParams {
+	return p
+}
+
+// rateLimitAlgorithm is how a rate limiting algorithm updates and reads a client's state.
+// The Go methods serve the in-memory limiter, and the script does the same in Redis.
+type rateLimitAlgorithm interface {
+	// name identifies the algorithm in Redis keys, so switching algorithms never misreads state.
+	name() string
+	// params returns the quota and window.
+	params() limitParams
+	// step brings the state up to now, then takes n requests if max(n, 1) of them are allowed,
+	// or gives n requests back. It returns whether the requests were taken and how many
+	// milliseconds the state must be kept.
+	step(s *limitState, now float64, n int, refund bool) (allowed bool, ttl float64)
+	// info reads a state brought up to now: the requests left, the milliseconds until the full
+	// quota is back, and the milliseconds until need requests are allowed.
+	info(s limitState, now float64, need int) (remaining int, reset, retryAfter float64)
+	// script is the Lua body of step, run between limiterScriptPrelude and limiterScriptEpilogue.
+	script() string
+}
+
+// limiterScriptPrelude loads a client's state from the hash at KEYS[1] into a, b and c.
+// ARGV are now in milliseconds, n, the quota, the window in milliseconds, and "1" to give
+// requests back; nothing is given back to clients without state.
+const limiterScriptPrelude = `
+if ARGV[5] == '1' and redis.call('EXISTS', KEYS[1]) == 0 then
+	return false
+end
+local state = redis.call('HMGET', KEYS[1], 'a', 'b', 'c')
+local a, b, c = tonumber(state[1]) or 0, tonumber(state[2]) or 0, tonumber(state[3]) or 0
+local now, n, quota, window = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local refund = ARGV[5] == '1'
+local need = math.max(n, 1)
+local allowed = 0
+local ttl
+`
+
+// limiterScriptEpilogue stores the state with its expiry and returns whether the requests
+// were taken and the state, as strings so fractions survive.
+const limiterScriptEpilogue = `
+redis.call('HSET', KEYS[1], 'a', tostring(a), 'b', tostring(b), 'c', tostring(c))
+redis.call('PEXPIRE', KEYS[1], math.max(math.ceil(ttl), 1))
+return {allowed, tostring(a), tostring(b), tostring(c)}
+`
+
+// millis converts a time to milliseconds since the Unix epoch.
+func millis(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Millisecond)
+}
+
+// newRateLimitInfo reads the quota left in a state after a decision.
+func newRateLimitInfo(algorithm rateLimitAlgorithm, s limitState, now float64, n int, allowed bool) *RateLimitInfo {
+	need := n
+	if need < 1 {
+		need = 1
+	}
+	remaining, reset, retryAfter := algorithm.info(s, now, need)
+	info := &RateLimitInfo{
+		Allowed:   allowed,
+		Remaining: remaining,
+		Reset:     time.Duration(reset * float64(time.Millisecond)),
+	}
+	if !allowed {
+		info.RetryAfter = time.Duration(retryAfter * float64(time.Millisecond))
+	}
+	return info
+}
+
+// memoryLimiter keeps rate limit state in memory, for single instance deployments.
+// A mutex makes each decision atomic.
+type memoryLimiter struct {
+	algorithm rateLimitAlgorithm
+	clock     Clock
+
+	mu        sync.Mutex
+	states    map[string]*memoryLimitState
+	nextSweep time.Time
+}
+
+// memoryLimitState is a client's state and when it may be forgotten.
+type memoryLimitState struct {
+	state   limitState
+	expires time.Time
+}
+
+// Allow takes requests from the client's quota.
+func (l *memoryLimiter) Allow(key string, n int) (*RateLimitInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.sweep(now)
+	entry, ok := l.states[key]
+	if !ok || !now.Before(entry.expires) {
+		entry = &memoryLimitState{}
+		l.states[key] = entry
+	}
+
+	ms := millis(now)
+	allowed, ttl := l.algorithm.step(&entry.state, ms, n, false)
+	entry.expires = now.Add(time.Duration(ttl * float64(time.Millisecond)))
+	return newRateLimitInfo(l.algorithm, entry.state, ms, n, allowed), nil
+}
+
+// Refund gives requests back to the client's quota.
+func (l *memoryLimiter) Refund(key string, n int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if entry, ok := l.states[key]; ok && now.Before(entry.expires) {
+		_, ttl := l.algorithm.step(&entry.state, millis(now), n, true)
+		entry.expires = now.Add(time.Duration(ttl * float64(time.Millisecond)))
+	}
+	return nil
+}
+
+// sweep forgets expired state at most once per RateLimitSweepInterval, so clients that went
+// away do not hold memory. The caller holds the mutex.
+func (l *memoryLimiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
+		return
+	}
+	l.nextSweep = now.Add(constants.RateLimitSweepInterval)
+	for key, entry := range l.states {
+		if !now.Before(entry.expires) {
+			delete(l.states, key)
+		}
+	}
+}
+
+// redisLimiter keeps rate limit state in Redis, shared by every instance. The algorithm's
+// script makes each decision atomic.
+type redisLimiter struct {
+	algorithm rateLimitAlgorithm
+	clock     Clock
+	script    *redis.Script
+}
+
+// Allow takes requests from the client's quota.
+func (l *redisLimiter) Allow(key string, n int) (*RateLimitInfo, error) {
+	now := millis(l.clock.Now())
+	allowed, state, err := l.run(key, now, n, false)
+	if err != nil {
+		return nil, err
+	}
+	return newRateLimitInfo(l.algorithm, state, now, n, allowed), nil
+}
+
+// Refund gives requests back to the client's quota.
+func (l *redisLimiter) Refund(key string, n int) error {
+	_, _, err := l.run(key, millis(l.clock.Now()), n, true)
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// run runs the algorithm's script on the client's state.
+func (l *redisLimiter) run(key string, now float64, n int, refund bool) (bool, limitState, error) {
+	r2 := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r2); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	var state limitState
+	refundArg := "0"
+	if refund {
+		refundArg = "1"
+	}
+	stateKey := constants.RateLimitPrefix + l.algorithm.name() + ":" + key
+	params := l.algorithm.params()
+	res, err := l.script.Run(database.Ctx, r2, []string{stateKey},
+		strconv.FormatFloat(now, 'f', -1, 64), n, params.quota, strconv.FormatFloat(params.window, 'f', -1, 64), refundArg).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, state, err
+	}
+	if err != nil {
+		return false, state, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 4 {
+		return false, state, fmt.Errorf("unexpected rate limit reply: %v", res)
+	}
+	allowed, _ := values[0].(int64)
+	for i := range state {
+		text, _ := values[i+1].(string)
+		state[i], _ = strconv.ParseFloat(text, 64)
+	}
+	return allowed == 1, state, nil
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"math"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// Each algorithm below is written twice, in Go for the in-memory limiter and in Lua for Redis;
+// the two must stay in step. Requests are counted as floats so tokens can refill gradually.
+
+// remainingEpsilon keeps rounding errors from costing a request when counts are floored.
+const remainingEpsilon = 1e-9
+
+// floorRemaining floors a number of requests left, clamped to [0, quota].
+func floorRemaining(left, quota float64) int {
+	return int(math.Max(0, math.Min(quota, math.Floor(left+remainingEpsilon))))
+}
+
+// needed returns the requests that must be allowed to take n: at least one.
+func needed(n int) float64 {
+	return math.Max(float64(n), 1)
+}
+
+// fixedWindow allows quota requests per window, starting with a client's first request.
+// Clients can make up to twice the quota in a short time across the end of a window.
+// State: a is the requests made in the window and b when it ends.
+type fixedWindow struct {
+	limitParams
+}
+
+// name identifies the fixed window.
+func (fixedWindow) name() string {
+	return constants.RateLimitFixedWindow
+}
+
+// step starts a new window once the last one ended and counts requests in it.
+func (w fixedWindow) step(s *limitState, now float64, n int, refund bool) (bool, float64) {
+	if now >= s[1] {
+		s[0], s[1] = 0, now+w.window
+	}
+	allowed := false
+	if refund {
+		s[0] = math.Max(s[0]-float64(n), 0)
+	} else if s[0]+needed(n) <= w.quota {
+		s[0] += float64(n)
+		allowed = true
+	}
+	return allowed, s[1] - now
+}
+
+// info reports the requests left in the window; the full quota is back when it ends.
+func (w fixedWindow) info(s limitState, now float64, need int) (int, float64, float64) {
+	reset := s[1] - now
+	return floorRemaining(w.quota-s[0], w.quota), reset, reset
+}
+
+// script is step in Lua.
+func (fixedWindow) script() string {
+	return `
+if now >= b then
+	a, b = 0, now + window
+end
+if refund then
+	a = math.max(a - n, 0)
+elseif a + need <= quota then
+	a = a + n
+	allowed = 1
+end
+ttl = b - now
+`
+}
+
+// slidingWindow allows quota requests in any window-long period, estimating the requests
+// made in the last window from the counts of the current and previous fixed windows, weighted
+// by how much of the previous one the last window still covers.
+// State: a is the requests of the previous window, b of the current one, and c when it started.
+type slidingWindow struct {
+	limitParams
+}
+
+// name identifies the sliding window.
+func (slidingWindow) name() string {
+	return constants.RateLimitSlidingWindow
+}
+
+// step moves on to the current fixed window and counts requests in it.
+func (w slidingWindow) step(s *limitState, now float64, n int, refund bool) (bool, float64) {
+	if start := math.Floor(now/w.window) * w.window; start > s[2] {
+		if start-s[2] == w.window {
+			s[0] = s[1]
+		} else {
+			s[0] = 0
+		}
+		s[1], s[2] = 0, start
+	}
+	allowed := false
+	if refund {
+		// Requests taken before the window moved on count in the previous one
+		s[1] -= float64(n)
+		if s[1] < 0 {
+			s[0], s[1] = math.Max(s[0]+s[1], 0), 0
+		}
+	} else if w.estimate(*s, now)+needed(n) <= w.quota {
+		s[1] += float64(n)
+		allowed = true
+	}
+	return allowed, s[2] + 2*w.window - now
+}
+
+// estimate returns the requests made in the last window.
+func (w slidingWindow) estimate(s limitState, now float64) float64 {
+	return s[0]*(w.window-(now-s[2]))/w.window + s[1]
+}
+
+// info reports the requests left in the last window, when its requests are all forgotten and
+// when need more would fit.
+func (w slidingWindow) info(s limitState, now float64, need int) (int, float64, float64) {
+	elapsed := now - s[2]
+	reset := 0.0
+	switch {
+	case s[1] > 0:
+		reset = 2*w.window - elapsed
+	case s[0] > 0:
+		reset = w.window - elapsed
+	}
+
+	// The estimate falls as the previous window is covered less, until the current window
+	// ends; then the current window's requests become the previous ones and fall in turn
+	retryAfter := reset
+	spare := w.quota - float64(need)
+	switch {
+	case spare < 0:
+	case w.estimate(s, now) <= spare:
+		retryAfter = 0
+	case s[0] > 0 && spare-s[1] >= 0:
+		retryAfter = w.window*(1-(spare-s[1])/s[0]) - elapsed
+	case s[1] > 0:
+		retryAfter = w.window - elapsed + w.window*(1-spare/s[1])
+	}
+	return floorRemaining(w.quota-w.estimate(s, now), w.quota), reset, math.Max(retryAfter, 0)
+}
+
+// script is step in Lua.
+func (slidingWindow) script() string {
+	return `
+local start = math.floor(now / window) * window
+if start > c then
+	if start - c == window then
+		a = b
+	else
+		a = 0
+	end
+	b, c = 0, start
+end
+if refund then
+	b = b - n
+	if b < 0 then
+		a, b = math.max(a + b, 0), 0
+	end
+elseif a * (window - (now - c)) / window + b + need <= quota then
+	b = b + n
+	allowed = 1
+end
+ttl = c + 2 * window - now
+`
+}
+
+// tokenBucket holds up to quota tokens, refilled steadily so the bucket fills up in a window;
+// each request takes a token. Clients can burst up to the quota, then make requests at the
+// refill rate.
+// State: a is the tokens in the bucket and b when it was last refilled.
+type tokenBucket struct {
+	limitParams
+}
+
+// name identifies the token bucket.
+func (tokenBucket) name() string {
+	return constants.RateLimitTokenBucket
+}
+
+// step refills the bucket and takes tokens from it; a new bucket is full.
+func (t tokenBucket) step(s *limitState, now float64, n int, refund bool) (bool, float64) {
+	if s[1] == 0 {
+		s[0] = t.quota
+	} else {
+		s[0] = math.Min(t.quota, s[0]+math.Max(now-s[1], 0)*t.quota/t.window)
+	}
+	s[1] = math.Max(s[1], now)
+	allowed := false
+	if refund {
+		s[0] = math.Min(t.quota, s[0]+float64(n))
+	} else if s[0] >= needed(n) {
+		s[0] -= float64(n)
+		allowed = true
+	}
+	return allowed, (t.quota - s[0]) * t.window / t.quota
+}
+
+// info reports the tokens in the bucket, when it is full again and when it holds need tokens.
+func (t tokenBucket) info(s limitState, now float64, need int) (int, float64, float64) {
+	reset := (t.quota - s[0]) * t.window / t.quota
+	retryAfter := reset
+	if float64(need) <= t.quota {
+		retryAfter = math.Max(float64(need)-s[0], 0) * t.window / t.quota
+	}
+	return floorRemaining(s[0], t.quota), reset, retryAfter
+}
+
+// script is step in Lua.
+func (tokenBucket) script() string {
+	return `
+if b == 0 then
+	a = quota
+else
+	a = math.min(quota, a + math.max(now - b, 0) * quota / window)
+end
+b = math.max(b, now)
+if refund then
+	a = math.min(quota, a + n)
+elseif a >= need then
+	a = a - n
+	allowed = 1
+end
+ttl = (quota - a) * window / quota
+`
+}
+
+// gcra is the generic cell rate algorithm: requests are spaced an emission interval of
+// window/quota apart, with a tolerance that lets clients burst up to the quota. It behaves
+// like a token bucket but keeps a single timestamp.
+// State: a is the theoretical arrival time, when the client's quota is full again.
+type gcra struct {
+	limitParams
+}
+
+// name identifies the generic cell rate algorithm.
+func (gcra) name() string {
+	return constants.RateLimitGCRA
+}
+
+// interval returns the emission interval.
+func (g gcra) interval() float64 {
+	return g.window / g.quota
+}
+
+// step moves the theoretical arrival time on by an interval per request taken.
+func (g gcra) step(s *limitState, now float64, n int, refund bool) (bool, float64) {
+	s[0] = math.Max(s[0], now)
+	allowed := false
+	if refund {
+		s[0] = math.Max(s[0]-float64(n)*g.interval(), now)
+	} else if s[0]+needed(n)*g.interval()-now <= g.window {
+		s[0] += float64(n) * g.interval()
+		allowed = true
+	}
+	return allowed, s[0] - now
+}
+
+// info reports the requests that fit in the tolerance, when the theoretical arrival time is
+// reached and when need more requests would fit.
+func (g gcra) info(s limitState, now float64, need int) (int, float64, float64) {
+	reset := s[0] - now
+	retryAfter := reset
+	if float64(need) <= g.quota {
+		retryAfter = math.Max(s[0]+float64(need)*g.interval()-g.window-now, 0)
+	}
+	return floorRemaining((g.window-reset)/g.interval(), g.quota), reset, retryAfter
+}
+
+// script is step in Lua.
+func (gcra) script() string {
+	return `
+local interval = window / quota
+a = math.max(a, now)
+if refund then
+	a = math.max(a - n * interval, now)
+elseif a + need * interval - now <= window then
+	a = a + n * interval
+	allowed = 1
+end
+ttl = a - now
+`
+}
@@ -0,0 +1,302 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// fakeClock is a clock that only moves when told to. It is safe for concurrent use.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// set moves the clock to a time.
+func (c *fakeClock) set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// testLimiterStart is the start of a minute, so sliding windows line up with the steps of a test.
+var testLimiterStart = time.Unix(1700000040, 0)
+
+// testAlgorithms are the rate limiting algorithms.
+var testAlgorithms = []string{
+	constants.RateLimitFixedWindow,
+	constants.RateLimitSlidingWindow,
+	constants.RateLimitTokenBucket,
+	constants.RateLimitGCRA,
+}
+
+// newTestLimiter creates a limiter of an algorithm keeping its state in a store, with a fake
+// clock at testLimiterStart. The Redis store uses a server started for the test.
+func newTestLimiter(t *testing.T, algorithm, store string, quota int, window time.Duration) (Limiter, *fakeClock, *miniredis.Miniredis) {
+	t.Helper()
+	var server *miniredis.Miniredis
+	if store == constants.RateLimitStoreRedis {
+		server = startTestRedis(t)
+	}
+	clock := &fakeClock{now: testLimiterStart}
+	cfg := &config.Config{
+		APIQuota:           quota,
+		RateLimit:          window,
+		RateLimitAlgorithm: algorithm,
+		RateLimitStore:     store,
+	}
+	return NewLimiter(cfg, clock), clock, server
+}
+
+// limiterStateKey returns the Redis key of a client's state.
+func limiterStateKey(algorithm, key string) string {
+	return constants.RateLimitPrefix + algorithm + ":" + key
+}
+
+func TestLimiterConcurrentAllow(t *testing.T) {
+	const quota = 10
+	for _, store := range []string{constants.RateLimitStoreMemory, constants.RateLimitStoreRedis} {
+		for _, algorithm := range testAlgorithms {
+			t.Run(store+"/"+algorithm, func(t *testing.T) {
+				limiter, _, server := newTestLimiter(t, algorithm, store, quota, time.Minute)
+
+				// The clock stands still, so no request comes back while they race
+				var wg sync.WaitGroup
+				var mu sync.Mutex
+				allowed := 0
+				for i := 0; i < 10*quota; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						info, err := limiter.Allow("203.0.113.7", 1)
+						if err != nil {
+							t.Errorf("Allow = %v", err)
+							return
+						}
+						if info.Allowed {
+							mu.Lock()
+							allowed++
+							mu.Unlock()
+						}
+					}()
+				}
+				wg.Wait()
+
+				if allowed != quota {
+					t.Errorf("%d of %d concurrent requests allowed, want %d", allowed, 10*quota, quota)
+				}
+				if server != nil {
+					db := server.DB(constants.RedisDBRateLimit)
+					if ttl := db.TTL(limiterStateKey(algorithm, "203.0.113.7")); ttl <= 0 {
+						t.Errorf("state key TTL = %v, want it to expire", ttl)
+					}
+				}
+			})
+		}
+	}
+}
+
+// limiterStep is a request to a limiter at a time after testLimiterStart and its expected outcome.
+type limiterStep struct {
+	at         time.Duration
+	n          int
+	refund     bool          // Give n requests back instead; nothing is checked
+	allowed    bool          // Whether the requests are allowed
+	remaining  int           // Requests left afterwards
+	retryAfter time.Duration // Wait before the requests would be allowed, when they are not
+}
+
+// allowSteps returns count steps each taking one request at the same time, all allowed,
+// counting the requests left down from remaining.
+func allowSteps(at time.Duration, count, remaining int) []limiterStep {
+	steps := make([]limiterStep, count)
+	for i := range steps {
+		steps[i] = limiterStep{at: at, n: 1, allowed: true, remaining: remaining - i - 1}
+	}
+	return steps
+}
+
+// steps concatenates lists of steps.
+func steps(lists ...[]limiterStep) []limiterStep {
+	var all []limiterStep
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// durationsClose reports whether two durations are within a millisecond, since limiters
+// compute times in fractional milliseconds.
+func durationsClose(a, b time.Duration) bool {
+	d := a - b
+	return d > -time.Millisecond && d < time.Millisecond
+}
+
+func TestLimiterAlgorithms(t *testing.T) {
+	// Quota 4 per minute: token buckets refill and GCRA emits a request every 15s
+	tests := []struct {
+		algorithm string
+		steps     []limiterStep
+	}{
+		{
+			// The window starts with the first request, so clients can make twice the quota
+			// across its end
+			algorithm: constants.RateLimitFixedWindow,
+			steps: steps(
+				allowSteps(0, 1, 4),
+				allowSteps(59*time.Second, 3, 3),
+				[]limiterStep{{at: 59 * time.Second, n: 1, retryAfter: time.Second}},
+				allowSteps(60*time.Second, 4, 4),
+				[]limiterStep{
+					{at: 60 * time.Second, n: 1, retryAfter: time.Minute},
+					{at: 61 * time.Second, n: 1, refund: true},
+					{at: 61 * time.Second, n: 1, allowed: true},
+					{at: 61 * time.Second, n: 2, retryAfter: 59 * time.Second},
+				},
+			),
+		},
+		{
+			// The previous window still counts at the boundary, so there is no burst across it
+			algorithm: constants.RateLimitSlidingWindow,
+			steps: steps(
+				allowSteps(0, 4, 4),
+				[]limiterStep{
+					{at: 0, n: 1, retryAfter: 75 * time.Second},
+					{at: 60 * time.Second, n: 1, retryAfter: 15 * time.Second},
+					{at: 75 * time.Second, n: 1, allowed: true},
+					{at: 75 * time.Second, n: 1, retryAfter: 15 * time.Second},
+					{at: 76 * time.Second, n: 1, refund: true},
+					{at: 76 * time.Second, n: 1, allowed: true},
+					{at: 76 * time.Second, n: 5, retryAfter: 104 * time.Second},
+				},
+			),
+		},
+		{
+			algorithm: constants.RateLimitTokenBucket,
+			steps: steps(
+				allowSteps(0, 4, 4),
+				[]limiterStep{
+					{at: 0, n: 1, retryAfter: 15 * time.Second},
+					{at: 15 * time.Second, n: 1, allowed: true},
+					{at: 20 * time.Second, n: 1, retryAfter: 10 * time.Second},
+					{at: 20 * time.Second, n: 1, refund: true},
+					{at: 20 * time.Second, n: 1, allowed: true},
+					{at: 80 * time.Second, n: 1, allowed: true, remaining: 3},
+					{at: 80 * time.Second, n: 4, remaining: 3, retryAfter: 15 * time.Second},
+				},
+			),
+		},
+		{
+			algorithm: constants.RateLimitGCRA,
+			steps: steps(
+				allowSteps(0, 4, 4),
+				[]limiterStep{
+					{at: 0, n: 1, retryAfter: 15 * time.Second},
+					{at: 15 * time.Second, n: 1, allowed: true},
+					{at: 20 * time.Second, n: 1, retryAfter: 10 * time.Second},
+					{at: 20 * time.Second, n: 1, refund: true},
+					{at: 20 * time.Second, n: 1, allowed: true},
+					{at: 80 * time.Second, n: 1, allowed: true, remaining: 3},
+					{at: 80 * time.Second, n: 4, remaining: 3, retryAfter: 15 * time.Second},
+				},
+			),
+		},
+	}
+
+	// Both stores run every table, so the Lua scripts are held to the same outcomes as Go
+	for _, store := range []string{constants.RateLimitStoreMemory, constants.RateLimitStoreRedis} {
+		for _, tt := range tests {
+			t.Run(store+"/"+tt.algorithm, func(t *testing.T) {
+				limiter, clock, server := newTestLimiter(t, tt.algorithm, store, 4, time.Minute)
+				elapsed := time.Duration(0)
+				for i, step := range tt.steps {
+					if server != nil {
+						server.FastForward(step.at - elapsed)
+					}
+					elapsed = step.at
+					clock.set(testLimiterStart.Add(step.at))
+
+					if step.refund {
+						if err := limiter.Refund("203.0.113.7", step.n); err != nil {
+							t.Fatalf("step %d: Refund = %v", i, err)
+						}
+						continue
+					}
+					info, err := limiter.Allow("203.0.113.7", step.n)
+					if err != nil {
+						t.Fatalf("step %d: Allow = %v", i, err)
+					}
+					if info.Allowed != step.allowed || info.Remaining != step.remaining {
+						t.Errorf("step %d at %v: Allow(%d) = allowed %v with %d remaining, want %v with %d",
+							i, step.at, step.n, info.Allowed, info.Remaining, step.allowed, step.remaining)
+					}
+					if !step.allowed && !durationsClose(info.RetryAfter, step.retryAfter) {
+						t.Errorf("step %d at %v: RetryAfter = %v, want %v", i, step.at, info.RetryAfter, step.retryAfter)
+					}
+					if server != nil {
+						db := server.DB(constants.RedisDBRateLimit)
+						if ttl := db.TTL(limiterStateKey(tt.algorithm, "203.0.113.7")); ttl <= 0 {
+							t.Errorf("step %d: state key TTL = %v, want it to expire", i, ttl)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLimiterScriptParity(t *testing.T) {
+	for _, algorithm := range testAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			memory, memoryClock, _ := newTestLimiter(t, algorithm, constants.RateLimitStoreMemory, 4, time.Minute)
+			redisStore, redisClock, server := newTestLimiter(t, algorithm, constants.RateLimitStoreRedis, 4, time.Minute)
+
+			// The same random requests and refunds, spread over a few windows, must get the
+			// same outcomes from the Go and the Lua version of the algorithm
+			random := rand.New(rand.NewSource(1))
+			at := time.Duration(0)
+			for i := 0; i < 500; i++ {
+				step := time.Duration(random.Intn(20000)) * time.Millisecond
+				at += step
+				server.FastForward(step)
+				memoryClock.set(testLimiterStart.Add(at))
+				redisClock.set(testLimiterStart.Add(at))
+
+				n := random.Intn(4)
+				if random.Intn(5) == 0 {
+					if err := memory.Refund("203.0.113.7", n); err != nil {
+						t.Fatalf("memory Refund = %v", err)
+					}
+					if err := redisStore.Refund("203.0.113.7", n); err != nil {
+						t.Fatalf("redis Refund = %v", err)
+					}
+					continue
+				}
+
+				want, err := memory.Allow("203.0.113.7", n)
+				if err != nil {
+					t.Fatalf("memory Allow = %v", err)
+				}
+				got, err := redisStore.Allow("203.0.113.7", n)
+				if err != nil {
+					t.Fatalf("redis Allow = %v", err)
+				}
+				if got.Allowed != want.Allowed || got.Remaining != want.Remaining ||
+					!durationsClose(got.Reset, want.Reset) || !durationsClose(got.RetryAfter, want.RetryAfter) {
+					t.Fatalf("step %d at %v: Allow(%d) in Redis = %+v, in memory = %+v", i, at, n, *got, *want)
+				}
+			}
+		})
+	}
+}
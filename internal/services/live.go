@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// ErrLiveUnavailable is returned when the maximum number of live subscribers is reached
+// or the broker is shutting down.
+var ErrLiveUnavailable = errors.New(constants.ErrorLiveUnavailable)
+
+// ErrLiveClientLimit is returned when a client already holds MaxLiveSubscribersPerClient
+// live subscriptions.
+var ErrLiveClientLimit = errors.New(constants.ErrorLiveClientLimit)
+
+// LiveSubscription receives the clicks of one link, or of all links, as they are recorded.
+type LiveSubscription struct {
+	dropped uint64 // Clicks dropped since last taken; first for 64-bit alignment
+
+	Events    <-chan *ClickRecord // Closed when the broker shuts down
+	events    chan *ClickRecord
+	client    string
+	domain    string
+	shortCode string // Empty to receive the clicks of all links
+	traffic   string
+}
+
+// TakeDropped returns the number of clicks dropped because the subscriber was too slow
+// to receive them since the last call, and resets it.
+func (sub *LiveSubscription) TakeDropped() uint64 {
+	return atomic.SwapUint64(&sub.dropped, 0)
+}
+
+// matches reports whether the subscriber wants a click.
+func (sub *LiveSubscription) matches(record *ClickRecord) bool {
+	if sub.shortCode != "" && (record.Code != sub.shortCode || record.Domain != sub.domain) {
+		return false
+	}
+	switch sub.traffic {
+	case constants.TrafficHuman:
+		return !record.Bot
+	case constants.TrafficBot:
+		return record.Bot
+	}
+	return true
+}
+
+// ClickBroker fans the clicks of the click pipeline out to live subscribers. It is a click
+// sink, so subscribers see clicks once their batch is recorded. Each subscriber has a
+// bounded buffer; clicks that do not fit are dropped for that subscriber only, so a slow
+// consumer never holds up the pipeline or the other subscribers.
+type ClickBroker struct {
+	mu          sync.Mutex
+	subscribers map[*LiveSubscription]bool
+	perClient   map[string]int // Open subscriptions of each client
+	closed      bool
+}
+
+// NewClickBroker creates a click broker without subscribers.
+func NewClickBroker() *ClickBroker {
+	return &ClickBroker{
+		subscribers: make(map[*LiveSubscription]bool),
+		perClient:   make(map[string]int),
+	}
+}
+
+// Subscribe subscribes a client to the clicks of a link, or of all links when the short code
+// is empty, of the selected traffic. Each client may hold up to MaxLiveSubscribersPerClient
+// subscriptions, so a single token cannot use up all MaxLiveSubscribers. Call Unsubscribe when done.
+func (b *ClickBroker) Subscribe(client, domain, shortCode, traffic string) (*LiveSubscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || len(b.subscribers) >= constants.MaxLiveSubscribers {
+		return nil, ErrLiveUnavailable
+	}
+	if b.perClient[client] >= constants.MaxLiveSubscribersPerClient {
+		return nil, ErrLiveClientLimit
+	}
+
+	events := make(chan *ClickRecord, constants.LiveSubscriberBuffer)
+	sub := &LiveSubscription{
+		Events:    events,
+		events:    events,
+		client:    client,
+		domain:    domain,
+		shortCode: shortCode,
+		traffic:   traffic,
+	}
+	b.subscribers[sub] = true
+	b.perClient[sub.client]++
+	return sub, nil
+}
+
+// Unsubscribe stops delivering clicks to a subscriber.
+func (b *ClickBroker) Unsubscribe(sub *LiveSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[sub] {
+		b.remove(sub)
+	}
+}
+
+// Name identifies the broker as a click sink.
+func (b *ClickBroker) Name() string {
+	return constants.ClickSinkLive
+}
+
+// Write delivers a batch of clicks to the subscribers that want them without blocking.
+func (b *ClickBroker) Write(ctx context.Context, records []*ClickRecord) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		for _, record := range records {
+			if !sub.matches(record) {
+				continue
+			}
+			select {
+			case sub.events <- record:
+			default:
+				atomic.AddUint64(&sub.dropped, 1)
+			}
+		}
+	}
+	return nil
+}
+
+// Close ends every subscription and refuses new ones, so open streams finish.
+// It is safe to call more than once.
+func (b *ClickBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+	return nil
+}
+
+// remove ends a subscription. The caller holds the mutex.
+func (b *ClickBroker) remove(sub *LiveSubscription) {
+	delete(b.subscribers, sub)
+	close(sub.events)
+	if b.perClient[sub.client]--; b.perClient[sub.client] <= 0 {
+		delete(b.perClient, sub.client)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestClickBrokerLimitsSubscriptionsPerClient(t *testing.T) {
+	broker := NewClickBroker()
+	var subs []*LiveSubscription
+	for i := 0; i < constants.MaxLiveSubscribersPerClient; i++ {
+		sub, err := broker.Subscribe("analytics:acme", "", "", constants.TrafficAll)
+		if err != nil {
+			t.Fatalf("Subscribe #%d = %v", i+1, err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if _, err := broker.Subscribe("analytics:acme", "", "", constants.TrafficAll); !errors.Is(err, ErrLiveClientLimit) {
+		t.Fatalf("Subscribe past the client limit = %v, want ErrLiveClientLimit", err)
+	}
+	// Other clients are not affected
+	if _, err := broker.Subscribe("analytics:globex", "", "", constants.TrafficAll); err != nil {
+		t.Fatalf("Subscribe of another client = %v", err)
+	}
+
+	// Ending a subscription frees a place for the client
+	broker.Unsubscribe(subs[0])
+	sub, err := broker.Subscribe("analytics:acme", "", "", constants.TrafficAll)
+	if err != nil {
+		t.Fatalf("Subscribe after Unsubscribe = %v", err)
+	}
+	if err := broker.Write(context.Background(), []*ClickRecord{{Code: "abc"}}); err != nil {
+		t.Fatalf("Write = %v", err)
+	}
+	if record := <-sub.Events; record.Code != "abc" {
+		t.Errorf("received click %q, want abc", record.Code)
+	}
+}
+
+func TestClickBrokerLimitsSubscriptions(t *testing.T) {
+	broker := NewClickBroker()
+	for i := 0; i < constants.MaxLiveSubscribers; i++ {
+		client := string(rune('a' + i/constants.MaxLiveSubscribersPerClient))
+		if _, err := broker.Subscribe(client, "", "", constants.TrafficAll); err != nil {
+			t.Fatalf("Subscribe #%d = %v", i+1, err)
+		}
+	}
+	if _, err := broker.Subscribe("new", "", "", constants.TrafficAll); !errors.Is(err, ErrLiveUnavailable) {
+		t.Fatalf("Subscribe past the limit = %v, want ErrLiveUnavailable", err)
+	}
+
+	_ = broker.Close()
+	if _, err := broker.Subscribe("new", "", "", constants.TrafficAll); !errors.Is(err, ErrLiveUnavailable) {
+		t.Fatalf("Subscribe after Close = %v, want ErrLiveUnavailable", err)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// Requests for short codes that do not map to a link (mistyped, expired or guessed codes)
+// are recorded as misses: a total and a per-day counter, a per-day HyperLogLog of the distinct
+// codes requested, where a spike suggests someone enumerating codes, and the most requested
+// codes, which are worth recreating when they belonged to expired links.
+
+// topMissIncrScript counts a request for a missed code in a sorted set bounded to ARGV[2]
+// members with the Space-Saving algorithm: when the set is full, a new code replaces the
+// least requested one and inherits its count plus one. Codes requested more often than the
+// least requested code are never evicted, at the cost of overestimating the counts of codes
+// that replaced others by at most that count.
+var topMissIncrScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) or redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[2]) then
+	return redis.call('ZINCRBY', KEYS[1], 1, ARGV[1])
+end
+local least = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+redis.call('ZREM', KEYS[1], least[1])
+return redis.call('ZADD', KEYS[1], tonumber(least[2]) + 1, ARGV[1])
+`)
+
+// MissedCode is a short code that was requested but does not map to a link.
+type MissedCode struct {
+	Domain    string `json:"domain"`
+	ShortCode string `json:"short_code"`
+	Misses    int64  `json:"misses"` // May overestimate codes that entered the top after it was full
+}
+
+// DailyMisses are the requests for unknown short codes on one day.
+type DailyMisses struct {
+	Date          string `json:"date"`
+	Misses        int64  `json:"misses"`
+	DistinctCodes int64  `json:"distinct_codes"` // Estimated
+}
+
+// MissStats are the requests for unknown short codes in total and over a window of days.
+type MissStats struct {
+	Total    int64          `json:"total"`
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Days     []*DailyMisses `json:"days"`
+	TopCodes []*MissedCode  `json:"top_codes"` // Most requested first
+}
+
+// trackMiss queues the counters of a request for an unknown short code on the pipeline.
+// Only codes that could be created are candidates for the top missed codes.
+func (s *AnalyticsService) trackMiss(pipe redis.Pipeliner, event *ClickEvent) {
+	day := summaryDay(event.Time)
+	expireAt := dayKeyExpiry(event.Time, constants.MaxMissDays)
+
+	pipe.Incr(database.Ctx, constants.MissCounter)
+	dayKey := constants.MissCounter + ":" + day
+	pipe.Incr(database.Ctx, dayKey)
+	pipe.ExpireAt(database.Ctx, dayKey, expireAt)
+	codesKey := constants.MissedCodesDayPrefix + day
+	pipe.PFAdd(database.Ctx, codesKey, event.LinkKey)
+	pipe.ExpireAt(database.Ctx, codesKey, expireAt)
+
+	if shortCodePattern.MatchString(event.ShortCode) {
+		topMissIncrScript.Eval(database.Ctx, pipe, []string{constants.MissedCodesKey}, event.LinkKey, constants.MaxMissedCodes)
+	}
+}
+
+// GetMissStats returns the requests for unknown short codes in total and on each of the last
+// days (UTC), today included, with up to limit most requested codes.
+func (s *URLService) GetMissStats(days, limit int) (*MissStats, error) {
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	now := time.Now().UTC()
+	stats := &MissStats{
+		From: now.AddDate(0, 0, 1-days).Format("2006-01-02"),
+		To:   now.Format("2006-01-02"),
+		Days: make([]*DailyMisses, days),
+	}
+
+	var total *redis.StringCmd
+	var top *redis.ZSliceCmd
+	misses := make([]*redis.StringCmd, days)
+	codes := make([]*redis.IntCmd, days)
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.Get(database.Ctx, constants.MissCounter)
+		top = pipe.ZRevRangeWithScores(database.Ctx, constants.MissedCodesKey, 0, int64(limit)-1)
+		for i := range stats.Days {
+			day := now.AddDate(0, 0, i+1-days)
+			misses[i] = pipe.Get(database.Ctx, constants.MissCounter+":"+summaryDay(day))
+			codes[i] = pipe.PFCount(database.Ctx, constants.MissedCodesDayPrefix+summaryDay(day))
+			stats.Days[i] = &DailyMisses{Date: day.Format("2006-01-02")}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	// Missing counters are zero
+	stats.Total, _ = strconv.ParseInt(total.Val(), 10, 64)
+	for i, day := range stats.Days {
+		day.Misses, _ = strconv.ParseInt(misses[i].Val(), 10, 64)
+		day.DistinctCodes = codes[i].Val()
+	}
+	stats.TopCodes = make([]*MissedCode, len(top.Val()))
+	for i, z := range top.Val() {
+		domain, shortCode := s.splitLinkKey(z.Member.(string))
+		stats.TopCodes[i] = &MissedCode{Domain: domain, ShortCode: shortCode, Misses: int64(z.Score)}
+	}
+	return stats, nil
+}
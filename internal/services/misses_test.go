@@ -0,0 +1,108 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+)
+
+func TestTopMissIncrScript(t *testing.T) {
+	startTestRedis(t)
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer database.CloseClient(r)
+
+	// With room for three codes, a new code replaces the least requested one (the first in
+	// lexical order on ties) and inherits its count
+	steps := []struct {
+		code string
+		want map[string]float64
+	}{
+		{"a", map[string]float64{"a": 1}},
+		{"a", map[string]float64{"a": 2}},
+		{"b", map[string]float64{"a": 2, "b": 1}},
+		{"c", map[string]float64{"a": 2, "b": 1, "c": 1}},
+		{"d", map[string]float64{"a": 2, "c": 1, "d": 2}},
+		{"e", map[string]float64{"a": 2, "d": 2, "e": 2}},
+		{"a", map[string]float64{"a": 3, "d": 2, "e": 2}},
+		{"f", map[string]float64{"a": 3, "e": 2, "f": 3}},
+		{"e", map[string]float64{"a": 3, "e": 3, "f": 3}},
+	}
+	for i, step := range steps {
+		if err := topMissIncrScript.Run(database.Ctx, r, []string{constants.MissedCodesKey}, step.code, 3).Err(); err != nil {
+			t.Fatalf("step %d: script = %v", i+1, err)
+		}
+		members, err := r.ZRangeWithScores(database.Ctx, constants.MissedCodesKey, 0, -1).Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]float64, len(members))
+		for _, z := range members {
+			got[z.Member.(string)] = z.Score
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: after a miss of %q the top is %v, want %v", i+1, step.code, got, step.want)
+		}
+	}
+}
+
+func TestGetMissStats(t *testing.T) {
+	startTestRedis(t)
+	cfg := &config.Config{Domain: "https://sho.rt", Domains: []string{"https://sho.rt", "https://go.acme.com"}}
+	analytics := NewAnalyticsService(cfg)
+	urlService := NewURLService(cfg)
+
+	now := time.Now().UTC()
+	miss := func(linkKey, code string, at time.Time) *ClickEvent {
+		return &ClickEvent{LinkKey: linkKey, ShortCode: code, Time: at, Miss: true}
+	}
+	err := analytics.TrackClicks([]*ClickEvent{
+		miss("old-promo", "old-promo", now),
+		miss("old-promo", "old-promo", now),
+		miss("go.acme.com/sale", "sale", now),
+		// Codes that could never be created are counted, but are not candidates for the top
+		miss("wp-login.php?x=1", "wp-login.php?x=1", now),
+		miss("old-promo", "old-promo", now.AddDate(0, 0, -1)),
+	})
+	if err != nil {
+		t.Fatalf("TrackClicks = %v", err)
+	}
+
+	stats, err := urlService.GetMissStats(3, 10)
+	if err != nil {
+		t.Fatalf("GetMissStats = %v", err)
+	}
+	if stats.Total != 5 || stats.To != now.Format("2006-01-02") || stats.From != now.AddDate(0, 0, -2).Format("2006-01-02") {
+		t.Errorf("stats = %d misses from %s to %s, want 5 over the last 3 days", stats.Total, stats.From, stats.To)
+	}
+	wantDays := []DailyMisses{
+		{Date: now.AddDate(0, 0, -2).Format("2006-01-02")},
+		{Date: now.AddDate(0, 0, -1).Format("2006-01-02"), Misses: 1, DistinctCodes: 1},
+		{Date: now.Format("2006-01-02"), Misses: 4, DistinctCodes: 3},
+	}
+	for i, day := range stats.Days {
+		if *day != wantDays[i] {
+			t.Errorf("day %d = %+v, want %+v", i, day, wantDays[i])
+		}
+	}
+	wantTop := []MissedCode{
+		{Domain: "https://sho.rt", ShortCode: "old-promo", Misses: 3},
+		{Domain: "https://go.acme.com", ShortCode: "sale", Misses: 1},
+	}
+	if len(stats.TopCodes) != len(wantTop) {
+		t.Fatalf("top codes = %d, want %d", len(stats.TopCodes), len(wantTop))
+	}
+	for i, code := range stats.TopCodes {
+		if *code != wantTop[i] {
+			t.Errorf("top code %d = %+v, want %+v", i, code, wantTop[i])
+		}
+	}
+
+	// Misses are not clicks on a link
+	if count, err := analytics.GetShortURLAccessCount("old-promo", constants.TrafficAll); err != nil || count != 0 {
+		t.Errorf("GetShortURLAccessCount = %d, %v, want 0", count, err)
+	}
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrInvalidReport is returned when an abuse report has an unknown reason or is too long.
+var ErrInvalidReport = errors.New(constants.ErrorInvalidReport)
+
+// reportReasons are the reasons an abuse report may give.
+var reportReasons = map[string]bool{
+	"phishing": true,
+	"malware":  true,
+	"spam":     true,
+	"scam":     true,
+	"illegal":  true,
+	"other":    true,
+}
+
+// AbuseReportRequest represents the request body of an abuse report.
+type AbuseReportRequest struct {
+	Reason  string `json:"reason"`  // One of phishing, malware, spam, scam, illegal or other
+	Details string `json:"details"` // Optional free-form description
+}
+
+// AbuseReport is a stored abuse report. Reporters are identified by a keyed hash of their
+// IP address so repeated reports can be recognized without keeping the address.
+type AbuseReport struct {
+	ReportedAt time.Time `json:"reported_at"`
+	Reason     string    `json:"reason"`
+	Details    string    `json:"details,omitempty"`
+	Reporter   string    `json:"reporter"`
+}
+
+// ReportOutcome is the result of filing an abuse report.
+type ReportOutcome struct {
+	Reports     int64 // Number of distinct reporters of the link
+	Duplicate   bool  // Whether the reporter had already reported the link
+	Quarantined bool  // Whether this report put the link in quarantine
+}
+
+// AuditEntry records a change of a link's status and who made it.
+type AuditEntry struct {
+	At     time.Time `json:"at"`
+	Actor  string    `json:"actor"`  // Admin name, or AuditActorReports/AuditActorBlocklist for automatic changes
+	Action string    `json:"action"` // AuditActionQuarantine or AuditActionRestore
+	Status string    `json:"status"` // Status of the link after the change
+	Reason string    `json:"reason,omitempty"`
+}
+
+// ReviewItem is a reported link in the admin review queue.
+type ReviewItem struct {
+	Domain         string         `json:"domain"`
+	ShortCode      string         `json:"short"`
+	ShortURL       string         `json:"short_url"`
+	URL            string         `json:"url"`
+	Status         string         `json:"status"`
+	StatusReason   string         `json:"status_reason,omitempty"`
+	Reports        int64          `json:"reports"`
+	LastReportedAt time.Time      `json:"last_reported_at"`
+	RecentReports  []*AbuseReport `json:"recent_reports"`
+}
+
+// reporterKey returns the secret keying reporter identifiers, creating it on the first report.
+// The secret is shared through the analytics database so that every server instance identifies
+// reporters alike, and kept out of the links database, where it could be resolved as a link.
+func (s *URLService) reporterKey() ([]byte, error) {
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
+	if s.reporterSecret != nil {
+		return s.reporterSecret, nil
+	}
+
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	legacy, err := s.legacyReporterSecret()
+	if err != nil {
+		return nil, err
+	}
+	secret := legacy
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	if err := r.SetNX(database.Ctx, constants.ReporterSecretKey, secret, 0).Err(); err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	secret, err = r.Get(database.Ctx, constants.ReporterSecretKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	key, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reporter secret: %v", err)
+	}
+
+	// The secret has moved, so the old key no longer needs to be kept among the links
+	if legacy != "" {
+		s.deleteLegacyReporterSecret(legacy)
+	}
+
+	s.reporterSecret = key
+	return key, nil
+}
+
+// MigrateReporterSecret moves the reporter secret of earlier versions out of the links database,
+// where it could be resolved, exported and counted as a link. Reports do so too, but running it
+// at startup leaves no secret among the links on instances without reports.
+func (s *URLService) MigrateReporterSecret() error {
+	_, err := s.reporterKey()
+	return err
+}
+
+// legacyReporterSecret returns the reporter secret kept among the links by earlier versions,
+// so reporters keep their identifiers once it moves, or an empty string if there is none.
+// A link created with the short code of the old key is not a secret and is left alone.
+func (s *URLService) legacyReporterSecret() (string, error) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	value, err := r.Get(database.Ctx, constants.LegacyReporterSecretKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != 32 {
+		return "", nil
+	}
+	return value, nil
+}
+
+// deleteLegacyReporterSecret removes the old reporter secret from the links database, unless
+// it was replaced in the meantime.
+func (s *URLService) deleteLegacyReporterSecret(secret string) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	if value, err := r.Get(database.Ctx, constants.LegacyReporterSecretKey).Result(); err == nil && value == secret {
+		if err := r.Del(database.Ctx, constants.LegacyReporterSecretKey).Err(); err != nil {
+			log.Printf("Failed to remove the old reporter secret: %v", err)
+		}
+	}
+}
+
+// reporterID returns the identifier of an abuse reporter: an HMAC of their IP address keyed
+// with a random secret, so identifiers cannot be reversed by hashing every IPv4 address. With
+// IP anonymization the address is truncated first, and reporters on a network count once.
+func (s *URLService) reporterID(ip string) (string, error) {
+	key, err := s.reporterKey()
+	if err != nil {
+		return "", err
+	}
+	if s.config.AnonymizeIP {
+		ip = anonymizeIP(ip)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:8]), nil
+}
+
+// ReportLink files an abuse report against a link and adds the link to the review queue.
+// Each reporter (identified by IP address) counts once per link; further reports from
+// the same reporter are accepted but ignored. When the number of distinct reporters
+// reaches the configured threshold, an active link is quarantined.
+func (s *URLService) ReportLink(domain, shortCode string, req *AbuseReportRequest, reporterIP string) (*ReportOutcome, error) {
+	reason := strings.ToLower(strings.TrimSpace(req.Reason))
+	if !reportReasons[reason] || len(req.Details) > constants.MaxReportDetails {
+		return nil, fmt.Errorf("invalid report: %w", ErrInvalidReport)
+	}
+
+	link, err := s.GetLink(domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	key := s.LinkKey(domain, shortCode)
+	ttl, err := r.PTTL(database.Ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	reporter, err := s.reporterID(reporterIP)
+	if err != nil {
+		return nil, err
+	}
+	report := &AbuseReport{
+		ReportedAt: time.Now().UTC(),
+		Reason:     reason,
+		Details:    strings.TrimSpace(req.Details),
+		Reporter:   reporter,
+	}
+	entry, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	reportersKey := constants.LinkReportersPrefix + key
+	added, err := r.SAdd(database.Ctx, reportersKey, report.Reporter).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	if added == 0 {
+		return &ReportOutcome{Reports: link.ReportCount, Duplicate: true}, nil
+	}
+
+	reportsKey := constants.LinkReportsPrefix + key
+	metaKey := constants.LinkMetaPrefix + key
+	var count *redis.IntCmd
+	_, err = r.TxPipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(database.Ctx, reportsKey, entry)
+		pipe.LTrim(database.Ctx, reportsKey, 0, constants.MaxReportsPerLink-1)
+		count = pipe.HIncrBy(database.Ctx, metaKey, "reports", 1)
+		pipe.ZAdd(database.Ctx, constants.ReviewQueueKey, &redis.Z{Score: float64(report.ReportedAt.Unix()), Member: key})
+		// Reports never outlive the link; links without expiry have a negative TTL
+		if ttl > 0 {
+			pipe.PExpire(database.Ctx, reportersKey, ttl)
+			pipe.PExpire(database.Ctx, reportsKey, ttl)
+			pipe.PExpire(database.Ctx, metaKey, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	outcome := &ReportOutcome{Reports: count.Val()}
+	threshold := int64(s.config.ReportQuarantineThreshold)
+	if threshold > 0 && outcome.Reports >= threshold && link.Status != constants.LinkStatusQuarantined {
+		reason := fmt.Sprintf("reports: %d reporters", outcome.Reports)
+		if err := s.SetLinkStatus(link, constants.LinkStatusQuarantined, reason, constants.AuditActorReports); err != nil {
+			return nil, err
+		}
+		outcome.Quarantined = true
+	}
+	return outcome, nil
+}
+
+// QuarantineLink quarantines a link on behalf of an admin and removes it from the review queue.
+func (s *URLService) QuarantineLink(domain, shortCode, actor, reason string) (*Link, error) {
+	link, err := s.GetLink(domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = "admin: " + actor
+	}
+	if err := s.SetLinkStatus(link, constants.LinkStatusQuarantined, reason, actor); err != nil {
+		return nil, err
+	}
+	if err := s.removeFromReviewQueue(s.LinkKey(domain, shortCode), false); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// RestoreLink makes a link active again on behalf of an admin. Its reports are dismissed
+// so they do not put it straight back into quarantine, and it leaves the review queue.
+// Restoring an active link dismisses its reports.
+func (s *URLService) RestoreLink(domain, shortCode, actor, reason string) (*Link, error) {
+	link, err := s.GetLink(domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetLinkStatus(link, constants.LinkStatusActive, reason, actor); err != nil {
+		return nil, err
+	}
+	if err := s.removeFromReviewQueue(s.LinkKey(domain, shortCode), true); err != nil {
+		return nil, err
+	}
+	link.ReportCount = 0
+	return link, nil
+}
+
+// removeFromReviewQueue takes a link out of the review queue, optionally dismissing its reports.
+func (s *URLService) removeFromReviewQueue(key string, dismissReports bool) error {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	_, err := r.TxPipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(database.Ctx, constants.ReviewQueueKey, key)
+		if dismissReports {
+			pipe.Del(database.Ctx, constants.LinkReportsPrefix+key, constants.LinkReportersPrefix+key)
+			pipe.HDel(database.Ctx, constants.LinkMetaPrefix+key, "reports")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	return nil
+}
+
+// ReviewQueue returns up to limit reported links awaiting review, most recently reported first,
+// each with its most recent reports. Links that expired since they were reported are dropped.
+func (s *URLService) ReviewQueue(limit int) ([]*ReviewItem, error) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	queued, err := r.ZRevRangeWithScores(database.Ctx, constants.ReviewQueueKey, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	gets := make([]*redis.StringCmd, len(queued))
+	metas := make([]*redis.StringStringMapCmd, len(queued))
+	reports := make([]*redis.StringSliceCmd, len(queued))
+	_, err = r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for i, z := range queued {
+			key := z.Member.(string)
+			gets[i] = pipe.Get(database.Ctx, key)
+			metas[i] = pipe.HGetAll(database.Ctx, constants.LinkMetaPrefix+key)
+			reports[i] = pipe.LRange(database.Ctx, constants.LinkReportsPrefix+key, 0, constants.ReviewRecentReports-1)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	items := make([]*ReviewItem, 0, len(queued))
+	var expired []interface{}
+	for i, z := range queued {
+		key := z.Member.(string)
+		if gets[i].Err() != nil {
+			expired = append(expired, key)
+			continue
+		}
+
+		domain, shortCode := s.splitLinkKey(key)
+		link := &Link{Domain: domain, ShortCode: shortCode, URL: gets[i].Val()}
+		parseLinkMeta(link, metas[i].Val())
+
+		item := &ReviewItem{
+			Domain:         domain,
+			ShortCode:      shortCode,
+			ShortURL:       s.ShortURL(domain, shortCode),
+			URL:            link.URL,
+			Status:         link.Status,
+			StatusReason:   link.StatusReason,
+			Reports:        link.ReportCount,
+			LastReportedAt: time.Unix(int64(z.Score), 0).UTC(),
+			RecentReports:  make([]*AbuseReport, 0, len(reports[i].Val())),
+		}
+		for _, entry := range reports[i].Val() {
+			report := &AbuseReport{}
+			if err := json.Unmarshal([]byte(entry), report); err == nil {
+				item.RecentReports = append(item.RecentReports, report)
+			}
+		}
+		items = append(items, item)
+	}
+
+	if len(expired) > 0 {
+		r.ZRem(database.Ctx, constants.ReviewQueueKey, expired...)
+	}
+	return items, nil
+}
+
+// GetAuditTrail returns the status changes of a link, newest first.
+func (s *URLService) GetAuditTrail(domain, shortCode string) ([]*AuditEntry, error) {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	entries, err := r.LRange(database.Ctx, constants.LinkAuditPrefix+s.LinkKey(domain, shortCode), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	trail := make([]*AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		audit := &AuditEntry{}
+		if err := json.Unmarshal([]byte(entry), audit); err != nil {
+			continue
+		}
+		trail = append(trail, audit)
+	}
+	return trail, nil
+}
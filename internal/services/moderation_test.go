@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestReporterSecretIsKeptApartFromLinks(t *testing.T) {
+	tests := []struct {
+		name       string
+		legacy     string // Value of the old key among the links, if any
+		keepLegacy bool   // Whether it is a link that must stay
+	}{
+		{name: "new secret"},
+		{name: "secret of an earlier version", legacy: strings.Repeat("ab", 32)},
+		{name: "link with the old key as its short code", legacy: "https://example.com/", keepLegacy: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startTestRedis(t)
+			if tt.legacy != "" {
+				_ = server.Set(constants.LegacyReporterSecretKey, tt.legacy)
+			}
+			urlService := NewURLService(&config.Config{Domain: "https://sho.rt", Domains: []string{"https://sho.rt"}})
+
+			if err := urlService.MigrateReporterSecret(); err != nil {
+				t.Fatalf("MigrateReporterSecret = %v", err)
+			}
+			secret, err := server.DB(constants.RedisDBRateLimit).Get(constants.ReporterSecretKey)
+			if err != nil {
+				t.Fatalf("no secret in the analytics database: %v", err)
+			}
+			if key, err := hex.DecodeString(secret); err != nil || len(key) != 32 {
+				t.Errorf("secret = %q, want 32 bytes in hex", secret)
+			}
+			if tt.legacy != "" && !tt.keepLegacy && secret != tt.legacy {
+				t.Errorf("secret = %q, want the earlier one %q", secret, tt.legacy)
+			}
+
+			value, err := server.Get(constants.LegacyReporterSecretKey)
+			if tt.keepLegacy && value != tt.legacy {
+				t.Errorf("link at the old key = %q, %v, want %q", value, err, tt.legacy)
+			}
+			if !tt.keepLegacy && err == nil {
+				t.Errorf("old key still holds %q among the links", value)
+			}
+
+			// Identifiers are stable and do not reveal the address
+			first, err := urlService.reporterID("203.0.113.7")
+			second, _ := NewURLService(urlService.config).reporterID("203.0.113.7")
+			if err != nil || first != second || strings.Contains(first, "203") {
+				t.Errorf("reporterID = %q and %q, %v, want the same opaque identifier", first, second, err)
+			}
+		})
+	}
+}
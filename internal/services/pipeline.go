@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// ClickPipeline records clicks in the background so redirects never wait for analytics.
+//
+// Redirects enqueue their click on a bounded queue; a fixed pool of workers takes clicks
+// off the queue and records them in batches, one pipelined round trip per batch, when a
+// batch is full or the flush interval has passed. When the queue is full, clicks are
+// dropped and counted rather than slowing down redirects or piling up goroutines.
+// After recording, each batch is handed to every click sink. Every sink has its own bounded
+// queue of batches and goroutine delivering them, retrying failed batches a few times, so a
+// slow or failing sink never holds up recording; when a sink's queue is full, batches are
+// dropped for that sink only. Requests for unknown short
+// codes go through the pipeline as misses, which are recorded but not delivered, and neither
+// are clicks of visitors who asked not to be tracked.
+// Closing the pipeline stops accepting clicks and waits for the queued ones to be recorded
+// and delivered.
+type ClickPipeline struct {
+	// Counters first so they are 64-bit aligned for atomic access on 32-bit platforms
+	enqueued uint64
+	dropped  uint64
+	recorded uint64
+	failed   uint64
+
+	analytics     *AnalyticsService
+	queue         chan *ClickEvent
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+	sinks         []*sinkState
+
+	mu      sync.RWMutex // Guards closed so no click is sent on the closed queue
+	closed  bool
+	wg      sync.WaitGroup // Workers
+	sinksWG sync.WaitGroup // Sink goroutines
+}
+
+// ClickPipelineStats are the counters of a click pipeline since it was created.
+type ClickPipelineStats struct {
+	Queued   int    `json:"queued"`   // Clicks waiting in the queue
+	Capacity int    `json:"capacity"` // Size of the queue
+	Enqueued uint64 `json:"enqueued"` // Clicks accepted
+	Dropped  uint64 `json:"dropped"`  // Clicks dropped because the queue was full or closed
+	Recorded uint64 `json:"recorded"` // Clicks recorded
+	Failed   uint64 `json:"failed"`   // Clicks in batches that could not be fully recorded
+
+	Sinks map[string]*ClickSinkStats `json:"sinks"`
+}
+
+// ClickSinkStats are the counters of a click sink.
+type ClickSinkStats struct {
+	Queued  int    `json:"queued"`  // Batches waiting for the sink
+	Written uint64 `json:"written"` // Clicks delivered to the sink
+	Failed  uint64 `json:"failed"`  // Clicks in batches the sink failed to take after every attempt
+	Dropped uint64 `json:"dropped"` // Clicks in batches dropped because the sink's queue was full
+}
+
+// sinkState is a click sink with its queue of batches and counters.
+type sinkState struct {
+	written uint64
+	failed  uint64
+	dropped uint64
+	sink    ClickSink
+	queue   chan []*ClickRecord
+}
+
+// NewClickPipeline creates a click pipeline recording clicks with the analytics service.
+// Call Start to start its workers.
+func NewClickPipeline(cfg *config.Config, analytics *AnalyticsService) *ClickPipeline {
+	return &ClickPipeline{
+		analytics:     analytics,
+		queue:         make(chan *ClickEvent, cfg.ClickQueueSize),
+		workers:       cfg.ClickWorkers,
+		batchSize:     cfg.ClickBatchSize,
+		flushInterval: cfg.ClickFlushInterval,
+	}
+}
+
+// AddSink adds a sink every recorded batch of clicks is delivered to. Sinks must be added before Start.
+func (p *ClickPipeline) AddSink(sink ClickSink) {
+	p.sinks = append(p.sinks, &sinkState{sink: sink, queue: make(chan []*ClickRecord, constants.ClickSinkQueueSize)})
+}
+
+// Start starts the workers of the pipeline and the goroutines delivering to its sinks.
+func (p *ClickPipeline) Start() {
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	for _, state := range p.sinks {
+		p.sinksWG.Add(1)
+		go p.deliver(state)
+	}
+}
+
+// Enqueue queues a click for recording without blocking. It returns false if the click
+// was dropped because the queue is full or the pipeline is closed.
+func (p *ClickPipeline) Enqueue(event *ClickEvent) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		atomic.AddUint64(&p.dropped, 1)
+		return false
+	}
+
+	select {
+	case p.queue <- event:
+		atomic.AddUint64(&p.enqueued, 1)
+		return true
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		return false
+	}
+}
+
+// Stats returns the current counters of the pipeline.
+func (p *ClickPipeline) Stats() *ClickPipelineStats {
+	stats := &ClickPipelineStats{
+		Queued:   len(p.queue),
+		Capacity: cap(p.queue),
+		Enqueued: atomic.LoadUint64(&p.enqueued),
+		Dropped:  atomic.LoadUint64(&p.dropped),
+		Recorded: atomic.LoadUint64(&p.recorded),
+		Failed:   atomic.LoadUint64(&p.failed),
+		Sinks:    make(map[string]*ClickSinkStats, len(p.sinks)),
+	}
+	for _, state := range p.sinks {
+		stats.Sinks[state.sink.Name()] = &ClickSinkStats{
+			Queued:  len(state.queue),
+			Written: atomic.LoadUint64(&state.written),
+			Failed:  atomic.LoadUint64(&state.failed),
+			Dropped: atomic.LoadUint64(&state.dropped),
+		}
+	}
+	return stats
+}
+
+// Close stops accepting clicks and waits until the queued clicks are recorded and delivered
+// to the sinks or the context is done, in which case the clicks still queued are lost. The
+// sinks are closed once their queues are drained.
+func (p *ClickPipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	alreadyClosed := p.closed
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		if !alreadyClosed {
+			close(p.queue)
+			// Workers hand their last batches to the sinks before the sink queues are closed
+			p.wg.Wait()
+			for _, state := range p.sinks {
+				close(state.queue)
+			}
+		}
+		p.sinksWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		if !alreadyClosed {
+			for _, state := range p.sinks {
+				if err := state.sink.Close(); err != nil {
+					log.Printf("Failed to close click sink %s: %v", state.sink.Name(), err)
+				}
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		batches := 0
+		for _, state := range p.sinks {
+			batches += len(state.queue)
+		}
+		return fmt.Errorf("click pipeline: %d clicks not recorded and %d batches not delivered: %w", len(p.queue), batches, ctx.Err())
+	}
+}
+
+// work records clicks from the queue in batches until the queue is closed and drained.
+func (p *ClickPipeline) work() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*ClickEvent, 0, p.batchSize)
+	for {
+		select {
+		case event, ok := <-p.queue:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= p.batchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			p.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush records a batch of clicks and delivers it to the sinks.
+func (p *ClickPipeline) flush(batch []*ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := p.analytics.TrackClicks(batch); err != nil {
+		atomic.AddUint64(&p.failed, uint64(len(batch)))
+		log.Printf("Failed to record %d clicks: %v", len(batch), err)
+	} else {
+		atomic.AddUint64(&p.recorded, uint64(len(batch)))
+	}
+
+	if len(p.sinks) == 0 {
+		return
+	}
+	// Sinks only receive the clicks of existing links by visitors who did not opt out of tracking
+	records := make([]*ClickRecord, 0, len(batch))
+	for _, event := range batch {
+		if !event.Miss && !event.DoNotTrack {
+			records = append(records, newClickRecord(event))
+		}
+	}
+	if len(records) == 0 {
+		return
+	}
+	for _, state := range p.sinks {
+		select {
+		case state.queue <- records:
+		default:
+			atomic.AddUint64(&state.dropped, uint64(len(records)))
+			log.Printf("Click sink %s is falling behind, dropped %d clicks", state.sink.Name(), len(records))
+		}
+	}
+}
+
+// deliver writes the batches queued for a sink until its queue is closed and drained.
+func (p *ClickPipeline) deliver(state *sinkState) {
+	defer p.sinksWG.Done()
+	for records := range state.queue {
+		if err := p.write(state.sink, records); err != nil {
+			atomic.AddUint64(&state.failed, uint64(len(records)))
+			log.Printf("Click sink %s failed to take %d clicks after %d attempts: %v", state.sink.Name(), len(records), constants.ClickSinkAttempts, err)
+			continue
+		}
+		atomic.AddUint64(&state.written, uint64(len(records)))
+	}
+}
+
+// write writes a batch of clicks to a sink, trying up to ClickSinkAttempts times, each within
+// ClickSinkTimeout, with a growing wait between attempts.
+func (p *ClickPipeline) write(sink ClickSink, records []*ClickRecord) error {
+	backoff := constants.ClickSinkRetryBackoff
+	var err error
+	for attempt := 1; attempt <= constants.ClickSinkAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), constants.ClickSinkTimeout)
+		err = sink.Write(ctx, records)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+)
+
+// recordingSink keeps the clicks delivered to it.
+type recordingSink struct {
+	mu      sync.Mutex
+	records []*ClickRecord
+	closed  bool
+}
+
+func (s *recordingSink) Name() string {
+	return "recording"
+}
+
+func (s *recordingSink) Write(ctx context.Context, records []*ClickRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// blockingSink holds every write until it is released and fails the first failures writes.
+type blockingSink struct {
+	recordingSink
+	release  chan struct{}
+	failures int
+	attempts int
+}
+
+func (s *blockingSink) Write(ctx context.Context, records []*ClickRecord) error {
+	<-s.release
+	s.mu.Lock()
+	s.attempts++
+	failed := s.attempts <= s.failures
+	s.mu.Unlock()
+	if failed {
+		return errors.New("sink unavailable")
+	}
+	return s.recordingSink.Write(ctx, records)
+}
+
+// newTestClickPipeline creates a click pipeline with a small queue and a single worker.
+func newTestClickPipeline(queueSize int) *ClickPipeline {
+	cfg := &config.Config{
+		ClickQueueSize:     queueSize,
+		ClickWorkers:       1,
+		ClickBatchSize:     10,
+		ClickFlushInterval: time.Hour,
+	}
+	return NewClickPipeline(cfg, NewAnalyticsService(cfg))
+}
+
+// testClick returns a click on a link.
+func testClick(code string) *ClickEvent {
+	return &ClickEvent{LinkKey: code, ShortCode: code, Time: time.Now(), UserAgent: "Mozilla/5.0 Firefox/127.0"}
+}
+
+func TestClickPipelineDropsClicksPastCapacityAndDrainsOnClose(t *testing.T) {
+	startTestRedis(t)
+	pipeline := newTestClickPipeline(3)
+	sink := &recordingSink{}
+	pipeline.AddSink(sink)
+
+	// Nothing takes clicks off the queue before Start, so it fills up
+	for i := 0; i < 5; i++ {
+		accepted := pipeline.Enqueue(testClick("abc"))
+		if want := i < 3; accepted != want {
+			t.Errorf("Enqueue #%d = %v, want %v", i+1, accepted, want)
+		}
+	}
+	stats := pipeline.Stats()
+	if stats.Enqueued != 3 || stats.Dropped != 2 || stats.Queued != 3 || stats.Capacity != 3 {
+		t.Errorf("stats before Start = %+v, want 3 enqueued, 2 dropped, 3 queued of 3", stats)
+	}
+
+	// The flush interval is an hour, so only closing the pipeline records the queued clicks
+	pipeline.Start()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := pipeline.Close(ctx); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+
+	stats = pipeline.Stats()
+	if stats.Queued != 0 || stats.Recorded != 3 || stats.Failed != 0 {
+		t.Errorf("stats after Close = %+v, want 0 queued, 3 recorded, 0 failed", stats)
+	}
+	if written := stats.Sinks[sink.Name()].Written; written != 3 {
+		t.Errorf("sink written = %d, want 3", written)
+	}
+	sink.mu.Lock()
+	if len(sink.records) != 3 || !sink.closed {
+		t.Errorf("sink received %d clicks and closed = %v, want 3 clicks and closed", len(sink.records), sink.closed)
+	}
+	sink.mu.Unlock()
+
+	count, err := NewAnalyticsService(&config.Config{}).GetShortURLAccessCount("abc", "human")
+	if err != nil || count != 3 {
+		t.Errorf("access count = %d, %v, want 3", count, err)
+	}
+
+	// Clicks after Close are dropped, not sent on the closed queue
+	if pipeline.Enqueue(testClick("abc")) {
+		t.Errorf("Enqueue after Close = true, want false")
+	}
+	if stats := pipeline.Stats(); stats.Dropped != 3 {
+		t.Errorf("dropped after Close = %d, want 3", stats.Dropped)
+	}
+}
+
+func TestClickPipelineRecordsWhileASinkIsStuck(t *testing.T) {
+	startTestRedis(t)
+	pipeline := newTestClickPipeline(10)
+	pipeline.batchSize = 1
+	stuck := &blockingSink{release: make(chan struct{}), failures: 1}
+	pipeline.AddSink(stuck)
+	pipeline.Start()
+
+	for i := 0; i < 3; i++ {
+		pipeline.Enqueue(testClick("abc"))
+	}
+	// The batches are recorded although the sink has not taken any
+	deadline := time.Now().Add(5 * time.Second)
+	for pipeline.Stats().Recorded < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := pipeline.Stats(); stats.Recorded != 3 || stats.Sinks[stuck.Name()].Written != 0 {
+		t.Fatalf("stats with a stuck sink = %+v, want 3 recorded and nothing written", stats)
+	}
+
+	// Once released, the sink gets every batch, the first one after a retry
+	close(stuck.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := pipeline.Close(ctx); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	sinkStats := pipeline.Stats().Sinks[stuck.Name()]
+	if sinkStats.Written != 3 || sinkStats.Failed != 0 || sinkStats.Dropped != 0 || sinkStats.Queued != 0 {
+		t.Errorf("sink stats = %+v, want 3 written", sinkStats)
+	}
+	if stuck.attempts != 4 || !stuck.closed {
+		t.Errorf("sink got %d attempts and closed = %v, want 4 attempts and closed", stuck.attempts, stuck.closed)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// AnalyticsPurge is what was removed by purging the analytics of a link or a domain.
+type AnalyticsPurge struct {
+	Keys     int64 `json:"keys"`      // Counters, time buckets, breakdowns and visitor estimates
+	TopLinks int64 `json:"top_links"` // Entries in the daily top links
+	Events   int64 `json:"events"`    // Raw click events in the click stream
+}
+
+// VisitorIP returns the IP address of a visitor as analytics may use it: truncated to its
+// network (/24 for IPv4, /48 for IPv6) if IP anonymization is enabled. Addresses that cannot
+// be parsed are returned empty when anonymizing.
+func (s *AnalyticsService) VisitorIP(ip string) string {
+	if !s.anonymizeIP {
+		return ip
+	}
+	return anonymizeIP(ip)
+}
+
+// anonymizeIP truncates an IP address to its network, or returns it empty if it cannot be parsed.
+func anonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(constants.AnonymizedIPv4Bits, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(constants.AnonymizedIPv6Bits, 128)).String()
+}
+
+// DoNotTrack returns how the click of a request is recorded: DoNotTrackIgnore, as any
+// click, unless the visitor sends "DNT: 1" or "Sec-GPC: 1" and the configuration honors it.
+func (s *AnalyticsService) DoNotTrack(r *http.Request) string {
+	if s.doNotTrack == constants.DoNotTrackIgnore {
+		return constants.DoNotTrackIgnore
+	}
+	if strings.TrimSpace(r.Header.Get("DNT")) == "1" || strings.TrimSpace(r.Header.Get("Sec-GPC")) == "1" {
+		return s.doNotTrack
+	}
+	return constants.DoNotTrackIgnore
+}
+
+// analyticsLinkKey returns the link key of a per-link analytics key: an access counter,
+// a window of time buckets, a breakdown or a unique visitor estimate, of human or bot hits.
+func analyticsLinkKey(key string) (string, bool) {
+	key = strings.TrimPrefix(key, constants.BotKeyPrefix)
+	switch {
+	case strings.HasPrefix(key, "access:"):
+		return strings.TrimPrefix(key, "access:"), true
+	case strings.HasPrefix(key, constants.ClickBucketPrefix):
+		// clicks:<interval>:<link key>:<window>; the link key may contain ':' in a host's port
+		rest := strings.TrimPrefix(key, constants.ClickBucketPrefix)
+		i, j := strings.Index(rest, ":"), strings.LastIndex(rest, ":")
+		if i < 0 || j <= i {
+			return "", false
+		}
+		return rest[i+1 : j], true
+	case strings.HasPrefix(key, constants.ClickDimensionPrefix):
+		rest := strings.TrimPrefix(key, constants.ClickDimensionPrefix)
+		i := strings.Index(rest, ":")
+		if i < 0 {
+			return "", false
+		}
+		return rest[i+1:], true
+	case strings.HasPrefix(key, constants.VisitorsPrefix):
+		// visitors:<link key>[:<YYYYMMDD>]; link keys end with a short code, which has no ':'
+		rest := strings.TrimPrefix(key, constants.VisitorsPrefix)
+		if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i+1:], "/") {
+			rest = rest[:i]
+		}
+		return rest, true
+	}
+	return "", false
+}
+
+// PurgeAnalytics removes the analytics of a link, or of every link on a domain when the short
+// code is empty: its counters, time buckets, breakdowns, unique visitor estimates, daily top
+// link entries and raw events in the click stream. Totals across all links are kept, as they
+// cannot be attributed to a link. Events already delivered to click files or the webhook
+// must be purged where they were shipped.
+// The whole analytics database is scanned, in batches of PurgeBatchSize.
+func (s *URLService) PurgeAnalytics(domain, shortCode string) (*AnalyticsPurge, error) {
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	matches := func(linkKey string) bool {
+		linkDomain, linkCode := s.splitLinkKey(linkKey)
+		return linkDomain == domain && (shortCode == "" || linkCode == shortCode)
+	}
+
+	purge := &AnalyticsPurge{}
+	var cursor uint64
+	for {
+		keys, next, err := r.Scan(database.Ctx, cursor, "*", constants.PurgeBatchSize).Result()
+		if err != nil {
+			return purge, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		var purged []string
+		for _, key := range keys {
+			if strings.HasPrefix(key, constants.TopLinksPrefix) {
+				removed, err := s.purgeTopLinks(r, key, matches)
+				if err != nil {
+					return purge, err
+				}
+				purge.TopLinks += removed
+				continue
+			}
+			if linkKey, ok := analyticsLinkKey(key); ok && matches(linkKey) {
+				purged = append(purged, key)
+			}
+		}
+		if len(purged) > 0 {
+			deleted, err := r.Del(database.Ctx, purged...).Result()
+			if err != nil {
+				return purge, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+			}
+			purge.Keys += deleted
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// Unique visitors counted in memory are not in the analytics database
+	if s.config.VisitorStore == constants.VisitorStoreMemory {
+		purge.Keys += memoryVisitors.purge(func(key string) bool {
+			linkKey, ok := analyticsLinkKey(key)
+			return ok && matches(linkKey)
+		})
+	}
+
+	events, err := s.purgeClickEvents(r, domain, shortCode)
+	purge.Events = events
+	return purge, err
+}
+
+// purgeTopLinks removes the matching links from a day's top links and returns their number.
+func (s *URLService) purgeTopLinks(r *redis.Client, key string, matches func(string) bool) (int64, error) {
+	var removed int64
+	var cursor uint64
+	for {
+		members, next, err := r.ZScan(database.Ctx, key, cursor, "*", constants.PurgeBatchSize).Result()
+		if err != nil {
+			return removed, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		// ZSCAN returns members and scores alternately
+		var purged []interface{}
+		for i := 0; i < len(members); i += 2 {
+			if matches(members[i]) {
+				purged = append(purged, members[i])
+			}
+		}
+		if len(purged) > 0 {
+			n, err := r.ZRem(database.Ctx, key, purged...).Result()
+			if err != nil {
+				return removed, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+			}
+			removed += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// purgeClickEvents removes the matching clicks from the click stream and returns their number.
+func (s *URLService) purgeClickEvents(r *redis.Client, domain, shortCode string) (int64, error) {
+	var removed int64
+	start := "-"
+	for {
+		messages, err := r.XRangeN(database.Ctx, constants.ClickStreamKey, start, "+", constants.PurgeBatchSize).Result()
+		if err != nil {
+			return removed, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		var purged []string
+		for _, message := range messages {
+			if message.Values["domain"] == domain && (shortCode == "" || message.Values["code"] == shortCode) {
+				purged = append(purged, message.ID)
+			}
+		}
+		if len(purged) > 0 {
+			n, err := r.XDel(database.Ctx, constants.ClickStreamKey, purged...).Result()
+			if err != nil {
+				return removed, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+			}
+			removed += n
+		}
+
+		if len(messages) < constants.PurgeBatchSize {
+			return removed, nil
+		}
+		start = nextStreamID(messages[len(messages)-1].ID)
+	}
+}
+
+// nextStreamID returns the smallest stream entry ID after id ("<ms>-<seq>").
+func nextStreamID(id string) string {
+	i := strings.Index(id, "-")
+	if i < 0 {
+		return id
+	}
+	seq, _ := strconv.ParseUint(id[i+1:], 10, 64)
+	return id[:i] + "-" + strconv.FormatUint(seq+1, 10)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/google/uuid"
+)
+
+// PurgeJob is an analytics purge running in the background.
+type PurgeJob struct {
+	ID         string          `json:"id"`
+	Domain     string          `json:"domain"`
+	ShortCode  string          `json:"short_code"` // Empty when purging the whole domain
+	Admin      string          `json:"admin"`
+	Status     string          `json:"status"` // running, done or failed
+	Purged     *AnalyticsPurge `json:"purged,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// PurgeJobs runs analytics purges in the background, since a purge scans the whole analytics
+// database and can outlast an HTTP request, and keeps their status in memory: the running
+// purges and the last MaxPurgeJobs finished ones. It is safe for concurrent use.
+type PurgeJobs struct {
+	urlService *URLService
+	mu         sync.Mutex
+	jobs       map[string]*PurgeJob
+	finished   []string // IDs of finished jobs, oldest first
+}
+
+// NewPurgeJobs creates a runner of analytics purges of the URL service.
+func NewPurgeJobs(urlService *URLService) *PurgeJobs {
+	return &PurgeJobs{urlService: urlService, jobs: make(map[string]*PurgeJob)}
+}
+
+// Start starts purging the analytics of a link, or of every link on a domain when the short
+// code is empty, on behalf of an admin, and returns the job. If the same purge is already
+// running, that job is returned instead of starting another.
+func (j *PurgeJobs) Start(domain, shortCode, admin string) *PurgeJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.Status == constants.PurgeJobRunning && job.Domain == domain && job.ShortCode == shortCode {
+			copied := *job
+			return &copied
+		}
+	}
+
+	job := &PurgeJob{
+		ID:        uuid.New().String(),
+		Domain:    domain,
+		ShortCode: shortCode,
+		Admin:     admin,
+		Status:    constants.PurgeJobRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	j.jobs[job.ID] = job
+	go j.run(job)
+
+	copied := *job
+	return &copied
+}
+
+// Get returns the current state of a job.
+func (j *PurgeJobs) Get(id string) (*PurgeJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *job
+	return &copied, true
+}
+
+// run purges the analytics of a job and records the outcome.
+func (j *PurgeJobs) run(job *PurgeJob) {
+	purge, err := j.urlService.PurgeAnalytics(job.Domain, job.ShortCode)
+
+	target := job.Domain
+	if job.ShortCode != "" {
+		target = j.urlService.ShortURL(job.Domain, job.ShortCode)
+	}
+	if err != nil {
+		log.Printf("Admin %s failed to purge the analytics of %s: %v", job.Admin, target, err)
+	} else {
+		log.Printf("Admin %s purged the analytics of %s: %d keys, %d top link entries, %d events",
+			job.Admin, target, purge.Keys, purge.TopLinks, purge.Events)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	finishedAt := time.Now().UTC()
+	job.FinishedAt = &finishedAt
+	job.Purged = purge
+	job.Status = constants.PurgeJobDone
+	if err != nil {
+		job.Status = constants.PurgeJobFailed
+		job.Error = err.Error()
+	}
+
+	j.finished = append(j.finished, job.ID)
+	if len(j.finished) > constants.MaxPurgeJobs {
+		delete(j.jobs, j.finished[0])
+		j.finished = j.finished[1:]
+	}
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestPurgeJobs(t *testing.T) {
+	server := startTestRedis(t)
+	cfg := &config.Config{Domain: "https://sho.rt", Domains: []string{"https://sho.rt"}}
+	jobs := NewPurgeJobs(NewURLService(cfg))
+
+	server.Select(constants.RedisDBRateLimit)
+	_, _ = server.Incr("access:abc", 3)
+	_, _ = server.Incr("bot_access:abc", 1)
+	_, _ = server.Incr("access:other", 2)
+
+	job := jobs.Start("https://sho.rt", "abc", "alice")
+	if job.Status != constants.PurgeJobRunning || job.Admin != "alice" {
+		t.Fatalf("started job = %+v, want running for alice", job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == constants.PurgeJobRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		job, _ = jobs.Get(job.ID)
+	}
+	if job.Status != constants.PurgeJobDone || job.Purged == nil || job.Purged.Keys != 2 || job.FinishedAt == nil {
+		t.Fatalf("finished job = %+v, want done with 2 keys purged", job)
+	}
+	if server.Exists("access:abc") || server.Exists("bot_access:abc") || !server.Exists("access:other") {
+		t.Errorf("keys left = %v, want only access:other", server.Keys())
+	}
+
+	if _, ok := jobs.Get("unknown"); ok {
+		t.Errorf("Get(unknown) found a job")
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/skip2/go-qrcode"
+)
+
+// QRService renders QR codes for short links.
+// Codes are encoded and rendered in-process; no external service is involved.
+type QRService struct{}
+
+// NewQRService creates a new QR code service instance.
+func NewQRService() *QRService {
+	return &QRService{}
+}
+
+// QROptions controls how a QR code is rendered.
+type QROptions struct {
+	Format     string      // Output format: "png" or "svg"
+	Size       int         // Width and height of the image in pixels
+	Level      string      // Error correction level: L, M, Q or H
+	Margin     int         // Quiet zone around the code, in modules
+	Foreground color.NRGBA // Color of the dark modules
+	Background color.NRGBA // Color of the light modules and the quiet zone
+}
+
+// ParseQROptions validates raw option values (typically query parameters) and fills in defaults.
+// Empty values fall back to the defaults defined in the constants package.
+func ParseQROptions(format, size, level, margin, fg, bg string) (*QROptions, error) {
+	opts := &QROptions{
+		Format: constants.QRFormatPNG,
+		Size:   constants.DefaultQRSize,
+		Level:  constants.DefaultQRLevel,
+		Margin: constants.DefaultQRMargin,
+	}
+
+	if format != "" {
+		opts.Format = strings.ToLower(format)
+	}
+	if opts.Format != constants.QRFormatPNG && opts.Format != constants.QRFormatSVG {
+		return nil, fmt.Errorf("invalid format: %s", format)
+	}
+
+	if size != "" {
+		sizeInt, err := strconv.Atoi(size)
+		if err != nil || sizeInt < constants.MinQRSize || sizeInt > constants.MaxQRSize {
+			return nil, fmt.Errorf("invalid size: must be between %d and %d", constants.MinQRSize, constants.MaxQRSize)
+		}
+		opts.Size = sizeInt
+	}
+
+	if level != "" {
+		opts.Level = strings.ToUpper(level)
+	}
+	if _, err := recoveryLevel(opts.Level); err != nil {
+		return nil, err
+	}
+
+	if margin != "" {
+		marginInt, err := strconv.Atoi(margin)
+		if err != nil || marginInt < 0 || marginInt > constants.MaxQRMargin {
+			return nil, fmt.Errorf("invalid margin: must be between 0 and %d", constants.MaxQRMargin)
+		}
+		opts.Margin = marginInt
+	}
+
+	var err error
+	if opts.Foreground, err = parseHexColor(fg, color.NRGBA{A: 0xff}); err != nil {
+		return nil, fmt.Errorf("invalid foreground color: %w", err)
+	}
+	if opts.Background, err = parseHexColor(bg, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}); err != nil {
+		return nil, fmt.Errorf("invalid background color: %w", err)
+	}
+
+	return opts, nil
+}
+
+// Generate encodes content as a QR code and renders it in the requested format.
+// Returns the encoded image and its content type.
+func (s *QRService) Generate(content string, opts *QROptions) ([]byte, string, error) {
+	level, err := recoveryLevel(opts.Level)
+	if err != nil {
+		return nil, "", err
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, "", err
+	}
+	// The quiet zone is drawn by us so that the margin is configurable
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+
+	if opts.Format == constants.QRFormatSVG {
+		return renderQRSVG(bitmap, opts), "image/svg+xml", nil
+	}
+
+	data, err := renderQRPNG(bitmap, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, "image/png", nil
+}
+
+// recoveryLevel maps an error correction level name to the encoder's level.
+func recoveryLevel(level string) (qrcode.RecoveryLevel, error) {
+	switch level {
+	case "L":
+		return qrcode.Low, nil
+	case "M":
+		return qrcode.Medium, nil
+	case "Q":
+		return qrcode.High, nil
+	case "H":
+		return qrcode.Highest, nil
+	}
+	return 0, fmt.Errorf("invalid error correction level: %s (expected L, M, Q or H)", level)
+}
+
+// renderQRPNG draws the bitmap as a square PNG of exactly opts.Size pixels.
+// Modules are scaled by a whole number of pixels to keep edges sharp and the
+// leftover pixels are split evenly around the code as extra background.
+func renderQRPNG(bitmap [][]bool, opts *QROptions) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	size := opts.Size
+	if size < modules {
+		size = modules
+	}
+	scale := size / modules
+	offset := (size-scale*modules)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{opts.Background, opts.Foreground})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderQRSVG draws the bitmap as an SVG document.
+// Horizontal runs of dark modules are merged into a single path segment to keep the output small.
+func renderQRSVG(bitmap [][]bool, opts *QROptions) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+opts.Margin, y+opts.Margin, x-start, x-start)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"%s/>`, svgColor(opts.Background), svgOpacity(opts.Background))
+	fmt.Fprintf(&buf, `<path d="%s" fill="%s"%s/>`, path.String(), svgColor(opts.Foreground), svgOpacity(opts.Foreground))
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// parseHexColor parses a color in RRGGBB, RRGGBBAA or RGB form, with or without a leading '#'.
+// An empty value returns the fallback color.
+func parseHexColor(value string, fallback color.NRGBA) (color.NRGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	if value == "" {
+		return fallback, nil
+	}
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) == 6 {
+		value += "ff"
+	}
+	if len(value) != 8 {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex color", value)
+	}
+
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("%q is not a hex color", value)
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
+
+// svgColor formats a color as an SVG hex color, ignoring alpha.
+func svgColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// svgOpacity returns a fill-opacity attribute for translucent colors.
+func svgOpacity(c color.NRGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+}
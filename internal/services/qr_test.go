@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestParseQROptions(t *testing.T) {
+	tests := []struct {
+		name                        string
+		format, size, level, margin string
+		fg, bg                      string
+		want                        *QROptions
+		wantErr                     string
+	}{
+		{name: "defaults", want: &QROptions{
+			Format: constants.QRFormatPNG, Size: constants.DefaultQRSize, Level: constants.DefaultQRLevel,
+			Margin: constants.DefaultQRMargin, Foreground: color.NRGBA{A: 0xff}, Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		}},
+		{name: "every option", format: "SVG", size: "512", level: "q", margin: "0", fg: "#1a1a1a", bg: "fff", want: &QROptions{
+			Format: constants.QRFormatSVG, Size: 512, Level: "Q", Margin: 0,
+			Foreground: color.NRGBA{R: 0x1a, G: 0x1a, B: 0x1a, A: 0xff}, Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		}},
+		{name: "translucent background", bg: "ffffff00", want: &QROptions{
+			Format: constants.QRFormatPNG, Size: constants.DefaultQRSize, Level: constants.DefaultQRLevel,
+			Margin: constants.DefaultQRMargin, Foreground: color.NRGBA{A: 0xff}, Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff},
+		}},
+		{name: "unknown format", format: "gif", wantErr: "invalid format"},
+		{name: "size too small", size: "63", wantErr: "invalid size"},
+		{name: "size too large", size: "2049", wantErr: "invalid size"},
+		{name: "size not a number", size: "big", wantErr: "invalid size"},
+		{name: "unknown level", level: "X", wantErr: "invalid error correction level"},
+		{name: "negative margin", margin: "-1", wantErr: "invalid margin"},
+		{name: "margin too large", margin: "17", wantErr: "invalid margin"},
+		{name: "foreground not hex", fg: "black", wantErr: "invalid foreground color"},
+		{name: "background of the wrong length", bg: "fff0", wantErr: "invalid background color"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQROptions(tt.format, tt.size, tt.level, tt.margin, tt.fg, tt.bg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseQROptions = %+v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseQROptions = %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseQROptions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQRServiceGenerate(t *testing.T) {
+	qrService := NewQRService()
+
+	t.Run(constants.QRFormatPNG, func(t *testing.T) {
+		opts, _ := ParseQROptions("png", "300", "H", "2", "ff0000", "")
+		data, contentType, err := qrService.Generate("https://sho.rt/promo", opts)
+		if err != nil {
+			t.Fatalf("Generate = %v", err)
+		}
+		if contentType != "image/png" {
+			t.Errorf("content type = %q, want image/png", contentType)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("decoding the PNG: %v", err)
+		}
+		if bounds := img.Bounds(); bounds.Dx() != 300 || bounds.Dy() != 300 {
+			t.Errorf("image is %dx%d, want 300x300", bounds.Dx(), bounds.Dy())
+		}
+		// The corner is in the quiet zone, drawn in the background color
+		if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+			t.Errorf("corner pixel = %v, want the white background", img.At(0, 0))
+		}
+	})
+
+	t.Run(constants.QRFormatSVG, func(t *testing.T) {
+		opts, _ := ParseQROptions("svg", "128", "", "", "", "ffffff80")
+		data, contentType, err := qrService.Generate("https://sho.rt/promo", opts)
+		if err != nil {
+			t.Fatalf("Generate = %v", err)
+		}
+		svg := string(data)
+		if contentType != "image/svg+xml" || !strings.Contains(svg, `width="128" height="128"`) ||
+			!strings.Contains(svg, `fill="#ffffff" fill-opacity="0.502"`) || !strings.Contains(svg, `fill="#000000"/>`) {
+			t.Errorf("Generate = %q, %s", contentType, svg)
+		}
+	})
+}
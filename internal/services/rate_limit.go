@@ -1,112 +1,52 @@
 package services
 
 import (
-	"errors"
-	"strconv"
 	"time"
 
-	"github.com/adeesh/url-shortener/internal/constants"
-	"github.com/gofiber/fiber/v2"
-
 	"github.com/adeesh/url-shortener/internal/config"
-	"github.com/adeesh/url-shortener/internal/database"
-	"github.com/go-redis/redis/v8"
 )
 
+// RateLimitService limits every client to APIQuota requests per RateLimit window with the
+// configured algorithm.
 type RateLimitService struct {
-	config *config.Config
+	config  *config.Config
+	limiter Limiter
 }
 
-// NewRateLimitService creates a new rate limit service instance.
+// NewRateLimitService creates a new rate limit service instance using the configured limiter.
 func NewRateLimitService(cfg *config.Config) *RateLimitService {
 	return &RateLimitService{
-		config: cfg,
+		config:  cfg,
+		limiter: NewLimiter(cfg, SystemClock),
 	}
 }
 
-// RateLimitInfo contains rate limiting information.
+// RateLimitInfo is the outcome of a rate limit decision and the client's quota afterwards.
 type RateLimitInfo struct {
-	Remaining int           // Number of remaining requests allowed
-	Reset     time.Duration // Time until the rate limit window resets
-}
-
-// CheckRateLimit validates if the client has exceeded rate limits.
-func (s *RateLimitService) CheckRateLimit(clientIP string) error {
-	r2 := database.CreateClient(constants.RedisDBRateLimit)
-	defer func() {
-		if err := database.CloseClient(r2); err != nil {
-			// Log error but don't fail the main operation
-			_ = err
-		}
-	}()
-
-	val, err := database.Get(r2, clientIP)
-	if errors.Is(err, redis.Nil) {
-		// First request from this IP, set initial quota
-		quota := strconv.Itoa(s.config.APIQuota)
-		return database.Set(r2, clientIP, quota, s.config.RateLimit)
-	} else if err != nil {
-		return err
-	}
-
-	// Check remaining requests
-	valInt, _ := strconv.Atoi(val)
-	if valInt <= 0 {
-		return fiber.NewError(fiber.StatusForbidden, constants.ErrorRateLimitExceeded)
-	}
-
-	return nil
+	Allowed    bool          // Whether the requests were allowed
+	Limit      int           // Number of requests allowed per window
+	Remaining  int           // Number of remaining requests allowed
+	Reset      time.Duration // Time until the client's full quota is available again
+	RetryAfter time.Duration // Time until the requests would be allowed, when they were not
 }
 
-// DecrementRateLimit decrements the rate limit counter and returns updated values.
-func (s *RateLimitService) DecrementRateLimit(clientIP string) (*RateLimitInfo, error) {
-	r2 := database.CreateClient(constants.RedisDBRateLimit)
-	defer func() {
-		if err := database.CloseClient(r2); err != nil {
-			// Log error but don't fail the main operation
-			_ = err
-		}
-	}()
-
-	// Decrement the rate limit counter
-	if err := database.Decrement(r2, clientIP); err != nil {
-		return nil, err
-	}
-
-	// Get remaining requests
-	val, err := database.Get(r2, clientIP)
+// Allow atomically takes n requests from the client's quota if they are all allowed and
+// returns the decision with the client's quota afterwards. With n of zero nothing is taken;
+// the client is allowed if a single request would be.
+func (s *RateLimitService) Allow(clientIP string, n int) (*RateLimitInfo, error) {
+	info, err := s.limiter.Allow(clientIP, n)
 	if err != nil {
 		return nil, err
 	}
-
-	remaining, _ := strconv.Atoi(val)
-
-	// Get time until rate limit resets
-	ttl, err := database.GetTTL(r2, clientIP)
-	if err != nil {
-		return &RateLimitInfo{Remaining: remaining}, nil
-	}
-
-	return &RateLimitInfo{
-		Remaining: remaining,
-		Reset:     ttl / time.Nanosecond / time.Minute,
-	}, nil
+	info.Limit = s.config.APIQuota
+	return info, nil
 }
 
-// GetRateLimitResetTime returns the time remaining until rate limit resets.
-func (s *RateLimitService) GetRateLimitResetTime(clientIP string) (time.Duration, error) {
-	r2 := database.CreateClient(constants.RedisDBRateLimit)
-	defer func() {
-		if err := database.CloseClient(r2); err != nil {
-			// Log error but don't fail the main operation
-			_ = err
-		}
-	}()
-
-	ttl, err := database.GetTTL(r2, clientIP)
-	if err != nil {
-		return 0, err
+// Refund gives back n requests taken by Allow for operations that turned out not to count,
+// such as failed requests or batch items that were not created.
+func (s *RateLimitService) Refund(clientIP string, n int) error {
+	if n <= 0 {
+		return nil
 	}
-
-	return ttl / time.Nanosecond / time.Minute, nil
+	return s.limiter.Refund(clientIP, n)
 }
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// startTestRedis starts an in-process Redis server for the test and points the database
+// clients at it.
+func startTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	t.Setenv(constants.EnvDBAddr, server.Addr())
+	return server
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrBlockedURL is returned when a destination URL matches the reputation blocklist.
+var ErrBlockedURL = errors.New(constants.ErrorBlockedURL)
+
+// Verdict is the outcome of a reputation check.
+type Verdict struct {
+	Blocked bool   // Whether the URL matched a rule
+	Rule    string // The rule that matched, for logs and audit trails
+}
+
+// URLChecker checks destination URLs against a reputation source.
+// Implementations must be safe for concurrent use.
+type URLChecker interface {
+	Check(rawURL string) (*Verdict, error)
+}
+
+// BlocklistChecker checks URLs against a local blocklist file.
+// The file is re-read when its modification time or size changes; changes are
+// noticed on the first check after the reload interval has elapsed, so no
+// background goroutine is needed.
+//
+// One rule per line; blank lines and comments starting with '#' are ignored:
+//
+//	evil.example          the host itself
+//	*.evil.example        the domain and every subdomain
+//	https://host/path     every URL starting with this prefix (scheme and host are case-insensitive)
+//	sha256:1a2b3c4d       a hex prefix (at least 8 digits) of the SHA-256 of a canonical
+//	                      "host/path" expression, as used by hash-prefix threat feeds
+type BlocklistChecker struct {
+	path           string
+	reloadInterval time.Duration
+
+	mu        sync.RWMutex
+	rules     *blocklistRules
+	modTime   time.Time
+	size      int64
+	lastCheck time.Time
+}
+
+// blocklistRules is the parsed content of a blocklist file.
+type blocklistRules struct {
+	hosts     map[string]bool
+	wildcards map[string]bool
+	prefixes  []string
+	hashes    map[int]map[string]bool // hex hash prefixes grouped by length
+}
+
+// NewBlocklistChecker loads the blocklist at path.
+// A reload interval of zero checks the file for changes on every call.
+func NewBlocklistChecker(path string, reloadInterval time.Duration) (*BlocklistChecker, error) {
+	checker := &BlocklistChecker{path: path, reloadInterval: reloadInterval}
+	if err := checker.reload(); err != nil {
+		return nil, err
+	}
+	return checker, nil
+}
+
+// Check reports whether the URL matches a rule of the blocklist.
+func (b *BlocklistChecker) Check(rawURL string) (*Verdict, error) {
+	b.maybeReload()
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	path := parsed.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	b.mu.RLock()
+	rules := b.rules
+	b.mu.RUnlock()
+
+	if rules.hosts[host] {
+		return &Verdict{Blocked: true, Rule: host}, nil
+	}
+	for _, suffix := range hostSuffixes(host) {
+		if rules.wildcards[suffix] {
+			return &Verdict{Blocked: true, Rule: "*." + suffix}, nil
+		}
+	}
+
+	canonical := canonicalURL(parsed, host)
+	for _, prefix := range rules.prefixes {
+		if strings.HasPrefix(canonical, prefix) {
+			return &Verdict{Blocked: true, Rule: prefix}, nil
+		}
+	}
+
+	if len(rules.hashes) > 0 {
+		for _, suffix := range hostSuffixes(host) {
+			for _, expression := range []string{suffix + "/", suffix + path} {
+				sum := sha256.Sum256([]byte(expression))
+				digest := hex.EncodeToString(sum[:])
+				for length, prefixes := range rules.hashes {
+					if prefixes[digest[:length]] {
+						return &Verdict{Blocked: true, Rule: "sha256:" + digest[:length]}, nil
+					}
+				}
+			}
+		}
+	}
+
+	return &Verdict{}, nil
+}
+
+// maybeReload re-reads the blocklist if the reload interval elapsed and the file changed.
+// Reload failures keep the previous rules so a bad deploy of the file never disables checking.
+func (b *BlocklistChecker) maybeReload() {
+	b.mu.Lock()
+	if time.Since(b.lastCheck) < b.reloadInterval {
+		b.mu.Unlock()
+		return
+	}
+	b.lastCheck = time.Now()
+	info, err := os.Stat(b.path)
+	changed := err == nil && (!info.ModTime().Equal(b.modTime) || info.Size() != b.size)
+	b.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Blocklist %s unavailable, keeping previous rules: %v", b.path, err)
+		return
+	}
+	if changed {
+		if err := b.reload(); err != nil {
+			log.Printf("Failed to reload blocklist %s, keeping previous rules: %v", b.path, err)
+		}
+	}
+}
+
+// reload reads and parses the blocklist file and swaps in the new rules.
+func (b *BlocklistChecker) reload() error {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	rules, err := parseBlocklist(file)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.rules = rules
+	b.modTime = info.ModTime()
+	b.size = info.Size()
+	b.lastCheck = time.Now()
+	b.mu.Unlock()
+	return nil
+}
+
+// parseBlocklist parses blocklist rules. Malformed lines are logged and skipped.
+func parseBlocklist(r io.Reader) (*blocklistRules, error) {
+	rules := &blocklistRules{
+		hosts:     make(map[string]bool),
+		wildcards: make(map[string]bool),
+		hashes:    make(map[int]map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.Index(entry, " #"); i >= 0 {
+			entry = entry[:i]
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(entry, "sha256:"):
+			prefix := strings.ToLower(strings.TrimPrefix(entry, "sha256:"))
+			if _, err := hex.DecodeString(prefix); err != nil || len(prefix) < constants.MinBlocklistHashPrefix || len(prefix) > sha256.Size*2 {
+				log.Printf("Blocklist line %d: invalid hash prefix %q", line, entry)
+				continue
+			}
+			if rules.hashes[len(prefix)] == nil {
+				rules.hashes[len(prefix)] = make(map[string]bool)
+			}
+			rules.hashes[len(prefix)][prefix] = true
+		case strings.Contains(entry, "://"):
+			parsed, err := url.Parse(entry)
+			if err != nil || parsed.Hostname() == "" {
+				log.Printf("Blocklist line %d: invalid URL %q", line, entry)
+				continue
+			}
+			rules.prefixes = append(rules.prefixes, canonicalURL(parsed, strings.ToLower(parsed.Hostname())))
+		case strings.HasPrefix(entry, "*."):
+			rules.wildcards[strings.ToLower(strings.TrimPrefix(entry, "*."))] = true
+		default:
+			rules.hosts[strings.ToLower(strings.TrimSuffix(entry, "."))] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading blocklist: %w", err)
+	}
+	return rules, nil
+}
+
+// hostSuffixes returns the host and each of its parent domains,
+// e.g. a.example.com, example.com, com.
+func hostSuffixes(host string) []string {
+	suffixes := []string{host}
+	for {
+		i := strings.Index(host, ".")
+		if i < 0 || i == len(host)-1 {
+			return suffixes
+		}
+		host = host[i+1:]
+		suffixes = append(suffixes, host)
+	}
+}
+
+// canonicalURL returns the URL with a lowercase scheme and host and without a fragment,
+// which is the form blocklist URL prefixes are compared in.
+func canonicalURL(parsed *url.URL, host string) string {
+	canonical := *parsed
+	canonical.Scheme = strings.ToLower(parsed.Scheme)
+	canonical.Host = host
+	if port := parsed.Port(); port != "" {
+		canonical.Host += ":" + port
+	}
+	canonical.Fragment = ""
+	canonical.User = nil
+	return canonical.String()
+}
+
+// checkReputation consults the configured URL checker, if any.
+// Checker failures are logged and treated as a pass so an unavailable reputation source
+// does not take link creation or redirects down with it.
+func (s *URLService) checkReputation(rawURL string) *Verdict {
+	if s.checker == nil {
+		return &Verdict{}
+	}
+	verdict, err := s.checker.Check(rawURL)
+	if err != nil {
+		log.Printf("URL reputation check failed for %s: %v", rawURL, err)
+		return &Verdict{}
+	}
+	return verdict
+}
+
+// screenDestination checks a destination before a link is created.
+// Blocklisted destinations are rejected with ErrBlockedURL, or accepted in the quarantined
+// state when the blocklist action is "quarantine". Returns the status of the new link.
+func (s *URLService) screenDestination(rawURL string) (string, string, error) {
+	verdict := s.checkReputation(rawURL)
+	if !verdict.Blocked {
+		return constants.LinkStatusActive, "", nil
+	}
+
+	log.Printf("Blocklisted destination %s matched rule %s", rawURL, verdict.Rule)
+	if s.config.BlocklistAction == constants.BlocklistActionQuarantine {
+		return constants.LinkStatusQuarantined, "blocklist: " + verdict.Rule, nil
+	}
+	return "", "", fmt.Errorf("blocked url: %w", ErrBlockedURL)
+}
+
+// ScreenResolvedLink re-checks a link's destination when it is resolved, if enabled in the
+// configuration. This catches links created before their destination was blocklisted.
+// A match returns ErrBlockedURL, or quarantines the link when the blocklist action is
+// "quarantine"; the caller should then show a warning instead of redirecting.
+func (s *URLService) ScreenResolvedLink(link *Link) error {
+	if !s.config.BlocklistCheckOnResolve || link.Status == constants.LinkStatusQuarantined {
+		return nil
+	}
+
+	verdict := s.checkReputation(link.URL)
+	if !verdict.Blocked {
+		return nil
+	}
+
+	log.Printf("Blocklisted destination %s of %s matched rule %s", link.URL, s.LinkKey(link.Domain, link.ShortCode), verdict.Rule)
+	if s.config.BlocklistAction != constants.BlocklistActionQuarantine {
+		return fmt.Errorf("blocked url: %w", ErrBlockedURL)
+	}
+	return s.SetLinkStatus(link, constants.LinkStatusQuarantined, "blocklist: "+verdict.Rule, constants.AuditActorBlocklist)
+}
+
+// SetLinkStatus persists a new status for a link, records the change and who made it
+// in the link's audit trail, and updates the link in place. The reason is kept on
+// quarantined links and in the audit trail. The metadata and the audit trail keep the
+// expiry of the URL mapping so they never outlive the link.
+func (s *URLService) SetLinkStatus(link *Link, status, reason, actor string) error {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	key := s.LinkKey(link.Domain, link.ShortCode)
+	ttl, err := r.PTTL(database.Ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	action := constants.AuditActionRestore
+	statusReason := ""
+	if status == constants.LinkStatusQuarantined {
+		action = constants.AuditActionQuarantine
+		statusReason = reason
+	}
+	entry, err := json.Marshal(&AuditEntry{
+		At:     time.Now().UTC(),
+		Actor:  actor,
+		Action: action,
+		Status: status,
+		Reason: reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	metaKey := constants.LinkMetaPrefix + key
+	auditKey := constants.LinkAuditPrefix + key
+	_, err = r.TxPipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(database.Ctx, metaKey, map[string]interface{}{"status": status, "status_reason": statusReason})
+		pipe.LPush(database.Ctx, auditKey, entry)
+		pipe.LTrim(database.Ctx, auditKey, 0, constants.MaxAuditEntries-1)
+		// Links without expiry have a negative TTL
+		if ttl > 0 {
+			pipe.PExpire(database.Ctx, metaKey, ttl)
+			pipe.PExpire(database.Ctx, auditKey, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	link.Status = status
+	link.StatusReason = statusReason
+	return nil
+}
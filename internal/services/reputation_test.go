@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// writeBlocklist writes a blocklist file in the test's temporary directory.
+func writeBlocklist(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stubChecker returns a fixed verdict, or fails with err.
+type stubChecker struct {
+	verdict *Verdict
+	err     error
+}
+
+func (c *stubChecker) Check(rawURL string) (*Verdict, error) {
+	return c.verdict, c.err
+}
+
+func TestBlocklistChecker(t *testing.T) {
+	sum := sha256.Sum256([]byte("feed.example/login"))
+	hashRule := "sha256:" + hex.EncodeToString(sum[:])[:8]
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "# Destinations reported as phishing\n"+
+		"Evil.Example.\n"+
+		"*.phish.example  # and every subdomain\n"+
+		"HTTPS://Host.Example/bad/\n"+
+		hashRule+"\n"+
+		"sha256:1234\n"+
+		"https://\n")
+	checker, err := NewBlocklistChecker(path, 0)
+	if err != nil {
+		t.Fatalf("NewBlocklistChecker = %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		rule string // Rule that matches; empty if the URL is allowed
+	}{
+		{"https://evil.example/", "evil.example"},
+		{"http://EVIL.example./any/path?q=1", "evil.example"},
+		{"https://sub.evil.example/", ""},
+		{"https://phish.example/", "*.phish.example"},
+		{"https://a.b.phish.example/login", "*.phish.example"},
+		{"https://notphish.example/", ""},
+		{"https://host.example/bad/page#top", "https://host.example/bad/"},
+		{"http://host.example/bad/", ""},
+		{"https://host.example/good/", ""},
+		{"https://feed.example/login", hashRule},
+		{"https://www.feed.example/login?next=/", hashRule},
+		{"https://feed.example/logout", ""},
+		{"https://example.com/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			verdict, err := checker.Check(tt.url)
+			if err != nil {
+				t.Fatalf("Check = %v", err)
+			}
+			if verdict.Blocked != (tt.rule != "") || verdict.Rule != tt.rule {
+				t.Errorf("Check = %+v, want rule %q", verdict, tt.rule)
+			}
+		})
+	}
+}
+
+func TestBlocklistCheckerReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	writeBlocklist(t, path, "evil.example\n")
+	checker, err := NewBlocklistChecker(path, 0)
+	if err != nil {
+		t.Fatalf("NewBlocklistChecker = %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		change  func()
+		blocked map[string]bool
+	}{
+		{"loaded", func() {}, map[string]bool{"https://evil.example/": true, "https://phish.example/": false}},
+		{"file changed", func() { writeBlocklist(t, path, "evil.example\nphish.example\n") },
+			map[string]bool{"https://evil.example/": true, "https://phish.example/": true}},
+		// A file that disappears keeps the rules loaded last rather than disabling checks
+		{"file removed", func() { _ = os.Remove(path) },
+			map[string]bool{"https://evil.example/": true, "https://phish.example/": true}},
+		{"file restored", func() { writeBlocklist(t, path, "phish.example\n") },
+			map[string]bool{"https://evil.example/": false, "https://phish.example/": true}},
+	}
+	for _, step := range steps {
+		step.change()
+		for rawURL, blocked := range step.blocked {
+			verdict, err := checker.Check(rawURL)
+			if err != nil || verdict.Blocked != blocked {
+				t.Errorf("%s: Check(%s) = %+v, %v, want blocked %v", step.name, rawURL, verdict, err, blocked)
+			}
+		}
+	}
+
+	if _, err := NewBlocklistChecker(filepath.Join(t.TempDir(), "missing.txt"), 0); err == nil {
+		t.Error("NewBlocklistChecker of a missing file succeeded")
+	}
+}
+
+func TestScreenDestination(t *testing.T) {
+	blocked := &Verdict{Blocked: true, Rule: "evil.example"}
+	tests := []struct {
+		name    string
+		action  string
+		checker URLChecker
+		status  string
+		wantErr error
+	}{
+		{"allowed", constants.BlocklistActionReject, &stubChecker{verdict: &Verdict{}}, constants.LinkStatusActive, nil},
+		{"rejected", constants.BlocklistActionReject, &stubChecker{verdict: blocked}, "", ErrBlockedURL},
+		{"quarantined", constants.BlocklistActionQuarantine, &stubChecker{verdict: blocked}, constants.LinkStatusQuarantined, nil},
+		// An unavailable reputation source does not stop links from being created
+		{"checker failing", constants.BlocklistActionReject, &stubChecker{err: errors.New("feed unavailable")}, constants.LinkStatusActive, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startTestRedis(t)
+			urlService := NewURLService(&config.Config{
+				Domain:          "https://sho.rt",
+				Domains:         []string{"https://sho.rt"},
+				AllowedSchemes:  []string{"https"},
+				ShortenerAction: constants.ShortenerActionAllow,
+				BlocklistAction: tt.action,
+			})
+			urlService.SetURLChecker(tt.checker)
+
+			resp, err := urlService.ShortenURL(&ShortenURLRequest{URL: "https://evil.example/", CustomShort: "promo"})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ShortenURL = %v, want %v", err, tt.wantErr)
+				}
+				if server.Exists("promo") {
+					t.Error("rejected link was stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ShortenURL = %v", err)
+			}
+			if resp.Status != tt.status {
+				t.Errorf("status = %q, want %q", resp.Status, tt.status)
+			}
+			link, err := urlService.GetLink("https://sho.rt", "promo")
+			if err != nil || link.Status != tt.status {
+				t.Errorf("stored link = %+v, %v, want status %q", link, err, tt.status)
+			}
+		})
+	}
+}
+
+func TestScreenResolvedLink(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    string
+		onResolve bool
+		wantErr   error
+		status    string
+	}{
+		{"not checked on resolve", constants.BlocklistActionReject, false, nil, constants.LinkStatusActive},
+		{"rejected", constants.BlocklistActionReject, true, ErrBlockedURL, constants.LinkStatusActive},
+		{"quarantined", constants.BlocklistActionQuarantine, true, nil, constants.LinkStatusQuarantined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startTestRedis(t)
+			checker := &stubChecker{verdict: &Verdict{}}
+			urlService := NewURLService(&config.Config{
+				Domain:                  "https://sho.rt",
+				Domains:                 []string{"https://sho.rt"},
+				AllowedSchemes:          []string{"https"},
+				ShortenerAction:         constants.ShortenerActionAllow,
+				BlocklistAction:         tt.action,
+				BlocklistCheckOnResolve: tt.onResolve,
+			})
+			urlService.SetURLChecker(checker)
+			if _, err := urlService.ShortenURL(&ShortenURLRequest{URL: "https://evil.example/", CustomShort: "promo"}); err != nil {
+				t.Fatalf("ShortenURL = %v", err)
+			}
+
+			// The destination is blocklisted after the link was created
+			checker.verdict = &Verdict{Blocked: true, Rule: "evil.example"}
+			link, _ := urlService.GetLink("https://sho.rt", "promo")
+			if err := urlService.ScreenResolvedLink(link); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ScreenResolvedLink = %v, want %v", err, tt.wantErr)
+			}
+			if link.Status != tt.status {
+				t.Errorf("status = %q, want %q", link.Status, tt.status)
+			}
+			stored, _ := urlService.GetLink("https://sho.rt", "promo")
+			if stored.Status != tt.status {
+				t.Errorf("stored status = %q, want %q", stored.Status, tt.status)
+			}
+		})
+	}
+}
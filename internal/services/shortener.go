@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// ErrShortenerURL is returned when a destination is a link on another URL shortener.
+var ErrShortenerURL = errors.New(constants.ErrorShortenerURL)
+
+// HTTPDoer sends HTTP requests. *http.Client satisfies it; tests can inject a fake
+// to control the responses.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ShortenerPolicy handles destinations on known URL shorteners, which would otherwise
+// turn short links into redirect chains that hide the real destination from the
+// blocklist and from visitors. Depending on the action such destinations are rejected,
+// or unwrapped by following the shortener's redirects to the first URL that is not
+// on a known shortener.
+type ShortenerPolicy struct {
+	hosts  map[string]bool
+	action string
+	client HTTPDoer
+}
+
+// NewShortenerPolicy creates a shortener policy for the given shortener hosts.
+// action is constants.ShortenerActionBlock or constants.ShortenerActionUnwrap. The client
+// must not follow redirects itself; see NewUnwrapClient.
+func NewShortenerPolicy(hosts []string, action string, client HTTPDoer) *ShortenerPolicy {
+	policy := &ShortenerPolicy{
+		hosts:  make(map[string]bool, len(hosts)),
+		action: action,
+		client: client,
+	}
+	for _, host := range hosts {
+		policy.hosts[strings.ToLower(host)] = true
+	}
+	return policy
+}
+
+// NewUnwrapClient returns an HTTP client suitable for unwrapping shortener links:
+// it returns redirects to the caller instead of following them.
+func NewUnwrapClient() *http.Client {
+	return &http.Client{
+		Timeout: constants.ShortenerUnwrapTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// IsShortener reports whether the host, or one of its parent domains, is a known shortener.
+func (p *ShortenerPolicy) IsShortener(host string) bool {
+	for _, suffix := range hostSuffixes(strings.TrimSuffix(strings.ToLower(host), ".")) {
+		if p.hosts[suffix] {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve applies the policy to a URL on a known shortener. With the block action it
+// returns ErrShortenerURL; with the unwrap action it returns the URL the shortener
+// redirects to, following up to MaxShortenerHops shorteners. Links that do not redirect,
+// chains that are too long and links not unwrapped before ctx is done also return
+// ErrShortenerURL.
+func (p *ShortenerPolicy) Resolve(ctx context.Context, rawURL string) (string, error) {
+	if p.action != constants.ShortenerActionUnwrap {
+		return "", fmt.Errorf("shortener url: %w", ErrShortenerURL)
+	}
+
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	for hop := 0; hop < constants.MaxShortenerHops; hop++ {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("shortener url: %w: unwrapping took too long", ErrShortenerURL)
+		}
+		location, err := p.location(ctx, current.String())
+		if err != nil {
+			return "", fmt.Errorf("shortener url: %w: %v", ErrShortenerURL, err)
+		}
+		next, err := current.Parse(location)
+		if err != nil {
+			return "", fmt.Errorf("shortener url: %w: invalid redirect", ErrShortenerURL)
+		}
+		if !p.IsShortener(next.Hostname()) {
+			return next.String(), nil
+		}
+		current = next
+	}
+	return "", fmt.Errorf("shortener url: %w: too many redirects", ErrShortenerURL)
+}
+
+// location returns the redirect target of a shortener link.
+// HEAD is tried first; shorteners that do not support it are asked with GET.
+func (p *ShortenerPolicy) location(ctx context.Context, rawURL string) (string, error) {
+	var lastStatus int
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("User-Agent", constants.OutboundUserAgent)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		if location := resp.Header.Get("Location"); location != "" && resp.StatusCode >= 300 && resp.StatusCode < 400 {
+			return location, nil
+		}
+		lastStatus = resp.StatusCode
+	}
+	return "", fmt.Errorf("no redirect (status %d)", lastStatus)
+}
+
+// newUnwrapContext returns the context bounding the time one request, batches included, may
+// spend unwrapping shortener links, so a batch of shortener links cannot hold a request for
+// minutes. Links left when it is done are rejected with ErrShortenerURL.
+func newUnwrapContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), constants.ShortenerUnwrapBudget)
+}
+
+// checkShortener applies the shortener policy, if enabled, to a normalized destination.
+// Returns the destination to use, which differs from the input only for unwrapped links.
+func (s *URLService) checkShortener(ctx context.Context, rawURL string) (string, bool, error) {
+	if s.shorteners == nil {
+		return rawURL, false, nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !s.shorteners.IsShortener(parsed.Hostname()) {
+		return rawURL, false, nil
+	}
+	unwrapped, err := s.shorteners.Resolve(ctx, rawURL)
+	if err != nil {
+		return "", false, err
+	}
+	return unwrapped, true, nil
+}
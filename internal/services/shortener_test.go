@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// stubDoer redirects URLs from a table and waits for the request's context on the others.
+type stubDoer struct {
+	redirects map[string]string
+	requests  int
+}
+
+func (d *stubDoer) Do(req *http.Request) (*http.Response, error) {
+	d.requests++
+	location, ok := d.redirects[req.URL.String()]
+	if !ok {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return &http.Response{
+		StatusCode: http.StatusMovedPermanently,
+		Header:     http.Header{"Location": []string{location}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+func TestShortenerPolicyResolve(t *testing.T) {
+	doer := &stubDoer{redirects: map[string]string{
+		"https://bit.ly/abc":      "https://tinyurl.com/def",
+		"https://tinyurl.com/def": "https://example.com/page",
+	}}
+	policy := NewShortenerPolicy([]string{"bit.ly", "tinyurl.com"}, constants.ShortenerActionUnwrap, doer)
+
+	got, err := policy.Resolve(context.Background(), "https://bit.ly/abc")
+	if err != nil || got != "https://example.com/page" {
+		t.Fatalf("Resolve = %q, %v, want https://example.com/page", got, err)
+	}
+}
+
+func TestShortenerPolicyResolveStopsWhenContextIsDone(t *testing.T) {
+	doer := &stubDoer{}
+	policy := NewShortenerPolicy([]string{"bit.ly"}, constants.ShortenerActionUnwrap, doer)
+
+	// A shortener that never answers only holds the request until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := policy.Resolve(ctx, "https://bit.ly/slow")
+	if !errors.Is(err, ErrShortenerURL) {
+		t.Fatalf("Resolve = %v, want ErrShortenerURL", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Resolve took %v after the context was done", elapsed)
+	}
+
+	// Later links sharing the context are rejected without any request
+	requests := doer.requests
+	if _, err := policy.Resolve(ctx, "https://bit.ly/next"); !errors.Is(err, ErrShortenerURL) {
+		t.Fatalf("Resolve after the context was done = %v, want ErrShortenerURL", err)
+	}
+	if doer.requests != requests {
+		t.Errorf("Resolve made %d requests after the context was done", doer.requests-requests)
+	}
+}
+
+func TestShortenerPolicyBlock(t *testing.T) {
+	doer := &stubDoer{}
+	policy := NewShortenerPolicy([]string{"bit.ly"}, constants.ShortenerActionBlock, doer)
+
+	if _, err := policy.Resolve(context.Background(), "https://bit.ly/abc"); !errors.Is(err, ErrShortenerURL) {
+		t.Fatalf("Resolve = %v, want ErrShortenerURL", err)
+	}
+	if doer.requests != 0 {
+		t.Errorf("Resolve made %d requests with the block action", doer.requests)
+	}
+}
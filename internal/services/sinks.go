@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// ClickRecord is a click as shipped to click sinks, one per redirect.
+type ClickRecord struct {
+	Timestamp time.Time `json:"ts"`
+	Domain    string    `json:"domain"`
+	Code      string    `json:"code"`
+	Variant   string    `json:"variant,omitempty"` // Reserved for destination variants; links have a single destination
+	Referrer  string    `json:"referrer"`          // Referrer host, or "direct"
+	Browser   string    `json:"browser"`           // Browser, or bot name for bot hits
+	OS        string    `json:"os"`
+	Device    string    `json:"device"` // desktop, mobile, tablet or bot
+	Language  string    `json:"language"`
+	Country   string    `json:"country,omitempty"` // ISO 3166-1 alpha-2 code, when known
+	Bot       bool      `json:"bot"`
+}
+
+// ClickSink receives batches of clicks, for instance to ship them to a data warehouse.
+// Write is called from several pipeline workers at once and must be safe for concurrent use.
+type ClickSink interface {
+	// Name identifies the sink in logs and statistics.
+	Name() string
+	// Write delivers a batch of clicks.
+	Write(ctx context.Context, records []*ClickRecord) error
+	// Close flushes and releases the sink; Write is not called afterwards.
+	Close() error
+}
+
+// newClickRecord returns the record of a click.
+func newClickRecord(event *ClickEvent) *ClickRecord {
+	values := clickDimensionValues(event)
+	return &ClickRecord{
+		Timestamp: event.Time.UTC(),
+		Domain:    event.Domain,
+		Code:      event.ShortCode,
+		Referrer:  values[constants.DimensionReferrer],
+		Browser:   values[constants.DimensionBrowser],
+		OS:        values[constants.DimensionOS],
+		Device:    values[constants.DimensionDevice],
+		Language:  values[constants.DimensionLanguage],
+		Country:   event.Country,
+		Bot:       event.Bot,
+	}
+}
+
+// NewClickSinks creates the click sinks enabled in the configuration.
+func NewClickSinks(cfg *config.Config) ([]ClickSink, error) {
+	var sinks []ClickSink
+	for _, name := range cfg.ClickSinks {
+		switch name {
+		case constants.ClickSinkRedis:
+			sinks = append(sinks, NewRedisStreamSink(constants.ClickStreamKey, cfg.ClickStreamMaxLen, cfg.ClickEventRetention))
+		case constants.ClickSinkFile:
+			sink, err := NewFileSink(cfg.ClickLogDir, cfg.ClickLogMaxBytes, cfg.ClickEventRetention)
+			if err != nil {
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+		case constants.ClickSinkWebhook:
+			if cfg.ClickWebhookURL == "" {
+				return nil, fmt.Errorf("click sink %s: %s is not set", name, constants.EnvClickWebhookURL)
+			}
+			sinks = append(sinks, NewWebhookSink(cfg.ClickWebhookURL, &http.Client{Timeout: constants.ClickWebhookTimeout}))
+		default:
+			return nil, fmt.Errorf("unknown click sink: %s", name)
+		}
+	}
+	return sinks, nil
+}
+
+// RedisStreamSink appends clicks to a Redis stream, trimmed to about a maximum length and,
+// if a retention is set, to about the clicks of the retention period.
+// Consumers read the stream with XREAD or consumer groups.
+type RedisStreamSink struct {
+	key       string
+	maxLen    int64
+	retention time.Duration
+}
+
+// NewRedisStreamSink creates a sink appending to the stream at key; a maxLen and a retention
+// of zero keep every click.
+func NewRedisStreamSink(key string, maxLen int64, retention time.Duration) *RedisStreamSink {
+	return &RedisStreamSink{key: key, maxLen: maxLen, retention: retention}
+}
+
+// Name identifies the sink.
+func (s *RedisStreamSink) Name() string {
+	return constants.ClickSinkRedis
+}
+
+// Write appends the clicks to the stream in one round trip.
+func (s *RedisStreamSink) Write(ctx context.Context, records []*ClickRecord) error {
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	_, err := r.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, record := range records {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: s.key,
+				MaxLen: s.maxLen,
+				Approx: true,
+				Values: map[string]interface{}{
+					"ts":       record.Timestamp.Format(time.RFC3339Nano),
+					"domain":   record.Domain,
+					"code":     record.Code,
+					"variant":  record.Variant,
+					"referrer": record.Referrer,
+					"browser":  record.Browser,
+					"os":       record.OS,
+					"device":   record.Device,
+					"language": record.Language,
+					"country":  record.Country,
+					"bot":      record.Bot,
+				},
+			})
+		}
+		// Entry IDs start with their time in milliseconds
+		if s.retention > 0 {
+			minID := strconv.FormatInt(time.Now().Add(-s.retention).UnixNano()/int64(time.Millisecond), 10)
+			pipe.XTrimMinIDApprox(ctx, s.key, minID, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	return nil
+}
+
+// Close does nothing; the stream lives in Redis.
+func (s *RedisStreamSink) Close() error {
+	return nil
+}
+
+// FileSink writes clicks as newline-delimited JSON to files in a directory. A new file is
+// started when the current one reaches the maximum size or a new day (UTC) begins, so
+// complete files can be shipped and removed by an external job. If a retention is set, files
+// last written before the retention period are removed whenever a new file is started.
+type FileSink struct {
+	dir       string
+	maxBytes  int64
+	retention time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	day    string // Day (UTC) the current file was started
+}
+
+// NewFileSink creates a sink writing to files in dir, creating the directory if needed.
+// A retention of zero keeps every file.
+func NewFileSink(dir string, maxBytes int64, retention time.Duration) (*FileSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("click sink %s: %s is not set", constants.ClickSinkFile, constants.EnvClickLogDir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("click sink %s: %w", constants.ClickSinkFile, err)
+	}
+	return &FileSink{dir: dir, maxBytes: maxBytes, retention: retention}, nil
+}
+
+// Name identifies the sink.
+func (s *FileSink) Name() string {
+	return constants.ClickSinkFile
+}
+
+// Write appends the clicks to the current file and flushes it.
+func (s *FileSink) Write(ctx context.Context, records []*ClickRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := s.rotate(record.Timestamp); err != nil {
+			return err
+		}
+		n, err := s.writer.Write(append(line, '\n'))
+		s.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	if s.writer == nil {
+		return nil
+	}
+	return s.writer.Flush()
+}
+
+// rotate starts a new file if there is none, the current one is full, or the day changed.
+func (s *FileSink) rotate(t time.Time) error {
+	day := t.UTC().Format("20060102")
+	if s.file != nil && s.size < s.maxBytes && s.day == day {
+		return nil
+	}
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+	s.removeExpired()
+
+	name := filepath.Join(s.dir, "clicks-"+time.Now().UTC().Format("20060102T150405.000000000Z")+".ndjson")
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file, s.writer, s.size, s.day = file, bufio.NewWriter(file), 0, day
+	return nil
+}
+
+// removeExpired removes the click files last written before the retention period.
+// Failures are logged; they never stop clicks from being written.
+func (s *FileSink) removeExpired() {
+	if s.retention <= 0 {
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(s.dir, "clicks-*.ndjson"))
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-s.retention)
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			log.Printf("Failed to remove expired click file %s: %v", name, err)
+		}
+	}
+}
+
+// closeFile flushes and closes the current file, if any.
+func (s *FileSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	flushErr := s.writer.Flush()
+	closeErr := s.file.Close()
+	s.file, s.writer = nil, nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// Close flushes and closes the current file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeFile()
+}
+
+// WebhookSink posts each batch of clicks to a URL as newline-delimited JSON.
+// Any response other than 2xx fails the batch.
+type WebhookSink struct {
+	url    string
+	client HTTPDoer
+}
+
+// NewWebhookSink creates a sink posting to url with the given client, which should have a timeout.
+func NewWebhookSink(url string, client HTTPDoer) *WebhookSink {
+	return &WebhookSink{url: url, client: client}
+}
+
+// Name identifies the sink.
+func (s *WebhookSink) Name() string {
+	return constants.ClickSinkWebhook
+}
+
+// Write posts the clicks in one request.
+func (s *WebhookSink) Write(ctx context.Context, records []*ClickRecord) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("User-Agent", constants.OutboundUserAgent)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("click webhook: unexpected status %s", strings.TrimSpace(resp.Status))
+	}
+	return nil
+}
+
+// Close does nothing; every batch is posted when written.
+func (s *WebhookSink) Close() error {
+	return nil
+}
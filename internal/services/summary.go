@@ -0,0 +1,299 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// The analytics summary is kept up to date as links are created and clicked, so reading it
+// never scans the links:
+//   - top_links:<YYYYMMDD> sorted sets count each day's human clicks per link, and the top
+//     links of a window are the union of its days;
+//   - links_created counts every link created, links_created:<YYYYMMDD> each day's links;
+//   - link_expiries holds the active links scored by expiry time. Expired links are swept
+//     out of it into the links_expired counter whenever links are created or the summary is read.
+//
+// Links created before the summary was introduced are only counted after running
+// "linkctl backfill-summary" once.
+
+// sweepExpiredLinksScript removes the links that expired by ARGV[1] from the active links
+// and adds their number to the expired links counter.
+var sweepExpiredLinksScript = redis.NewScript(`
+local expired = redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if expired > 0 then
+	redis.call('INCRBY', KEYS[2], expired)
+end
+return expired
+`)
+
+// TopLink is a link with its human clicks over the window of an analytics summary.
+type TopLink struct {
+	Domain    string `json:"domain"`
+	ShortCode string `json:"short_code"`
+	ShortURL  string `json:"short_url"`
+	Clicks    int64  `json:"clicks"`
+}
+
+// DailyLinks is the number of links created on one day.
+type DailyLinks struct {
+	Date  string `json:"date"`
+	Links int64  `json:"links"`
+}
+
+// AnalyticsSummary is an overview of the links and their clicks over a window of days.
+type AnalyticsSummary struct {
+	From            string        `json:"from"`
+	To              string        `json:"to"`
+	Days            int           `json:"days"`
+	TotalRedirects  int64         `json:"total_redirects"` // Human clicks over the lifetime of the service
+	LinksCreated    int64         `json:"links_created"`   // Over the lifetime of the service
+	ActiveLinks     int64         `json:"active_links"`
+	ExpiredLinks    int64         `json:"expired_links"`
+	CreatedInWindow int64         `json:"created_in_window"`
+	CreationRate    float64       `json:"creation_rate"` // Links created per day over the window
+	CreatedPerDay   []*DailyLinks `json:"created_per_day"`
+	TopLinks        []*TopLink    `json:"top_links"` // Most human clicks over the window first
+}
+
+// summaryDay returns the day (UTC) of t as used in summary keys.
+func summaryDay(t time.Time) string {
+	return t.UTC().Format("20060102")
+}
+
+// dayKeyExpiry returns when a per-day key of the day of t expires so that it can be read in
+// windows of up to the given number of days, today included.
+func dayKeyExpiry(t time.Time, days int) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, days+1)
+}
+
+// trackTopLink queues the increment of a link's human clicks on the day of t on the pipeline.
+func (s *AnalyticsService) trackTopLink(pipe redis.Pipeliner, linkKey string, t time.Time) {
+	key := constants.TopLinksPrefix + summaryDay(t)
+	pipe.ZIncrBy(database.Ctx, key, 1, linkKey)
+	pipe.ExpireAt(database.Ctx, key, dayKeyExpiry(t, constants.MaxSummaryDays))
+}
+
+// GetTopLinks returns the link keys with the most human clicks over the last days (UTC),
+// today included, with their clicks.
+func (s *AnalyticsService) GetTopLinks(days, limit int) ([]redis.Z, error) {
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	now := time.Now().UTC()
+	keys := make([]string, days)
+	for i := range keys {
+		keys[i] = constants.TopLinksPrefix + summaryDay(now.AddDate(0, 0, -i))
+	}
+
+	// The union is stored under a key of its own, read and removed in one transaction
+	union := fmt.Sprintf("%stmp:%d", constants.TopLinksPrefix, now.UnixNano())
+	var top *redis.ZSliceCmd
+	_, err := r.TxPipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZUnionStore(database.Ctx, union, &redis.ZStore{Keys: keys})
+		top = pipe.ZRevRangeWithScores(database.Ctx, union, 0, int64(limit)-1)
+		pipe.Del(database.Ctx, union)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+	return top.Val(), nil
+}
+
+// trackLinksCreated counts created links, given with the TTL of their keys, towards the
+// analytics summary. Failures are logged; they never fail the creation of the links.
+func (s *URLService) trackLinksCreated(links map[string]time.Duration) {
+	if len(links) == 0 {
+		return
+	}
+
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	now := time.Now().UTC()
+	dayKey := constants.LinksCreatedKey + ":" + summaryDay(now)
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		// Sweep first so that a link re-created under the key of an expired one is counted
+		// as expired before its entry is replaced
+		sweepExpiredLinksScript.Eval(database.Ctx, pipe, []string{constants.LinkExpiriesKey, constants.LinksExpiredKey}, now.Unix())
+		for key, ttl := range links {
+			pipe.ZAdd(database.Ctx, constants.LinkExpiriesKey, &redis.Z{Score: linkExpiryScore(now, ttl), Member: key})
+		}
+		pipe.IncrBy(database.Ctx, constants.LinksCreatedKey, int64(len(links)))
+		pipe.IncrBy(database.Ctx, dayKey, int64(len(links)))
+		pipe.ExpireAt(database.Ctx, dayKey, dayKeyExpiry(now, constants.MaxSummaryDays))
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to count %d created links: %v", len(links), err)
+	}
+}
+
+// linkExpiryScore returns the score of a link in the active links: its expiry time, or
+// +inf if it never expires (a TTL of zero, or negative as returned by PTTL).
+func linkExpiryScore(now time.Time, ttl time.Duration) float64 {
+	if ttl <= 0 {
+		return math.Inf(1)
+	}
+	return float64(now.Add(ttl).Unix())
+}
+
+// GetSummary returns the analytics summary over the last days (UTC), today included,
+// with up to limit top links.
+func (s *URLService) GetSummary(days, limit int) (*AnalyticsSummary, error) {
+	analytics := NewAnalyticsService(s.config)
+	top, err := analytics.GetTopLinks(days, limit)
+	if err != nil {
+		return nil, err
+	}
+	redirects, err := analytics.GetRedirectCount(constants.TrafficHuman)
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	now := time.Now().UTC()
+	summary := &AnalyticsSummary{
+		From:           now.AddDate(0, 0, 1-days).Format("2006-01-02"),
+		To:             now.Format("2006-01-02"),
+		Days:           days,
+		TotalRedirects: redirects,
+		CreatedPerDay:  make([]*DailyLinks, days),
+		TopLinks:       make([]*TopLink, len(top)),
+	}
+
+	var active *redis.IntCmd
+	var created, expired *redis.StringCmd
+	perDay := make([]*redis.StringCmd, days)
+	_, err = r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		sweepExpiredLinksScript.Eval(database.Ctx, pipe, []string{constants.LinkExpiriesKey, constants.LinksExpiredKey}, now.Unix())
+		active = pipe.ZCard(database.Ctx, constants.LinkExpiriesKey)
+		created = pipe.Get(database.Ctx, constants.LinksCreatedKey)
+		expired = pipe.Get(database.Ctx, constants.LinksExpiredKey)
+		for i := range perDay {
+			day := now.AddDate(0, 0, i+1-days)
+			perDay[i] = pipe.Get(database.Ctx, constants.LinksCreatedKey+":"+summaryDay(day))
+			summary.CreatedPerDay[i] = &DailyLinks{Date: day.Format("2006-01-02")}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	// Missing counters are zero
+	summary.ActiveLinks = active.Val()
+	summary.LinksCreated, _ = strconv.ParseInt(created.Val(), 10, 64)
+	summary.ExpiredLinks, _ = strconv.ParseInt(expired.Val(), 10, 64)
+	for i, cmd := range perDay {
+		summary.CreatedPerDay[i].Links, _ = strconv.ParseInt(cmd.Val(), 10, 64)
+		summary.CreatedInWindow += summary.CreatedPerDay[i].Links
+	}
+	summary.CreationRate = float64(summary.CreatedInWindow) / float64(days)
+
+	for i, z := range top {
+		domain, shortCode := s.splitLinkKey(z.Member.(string))
+		summary.TopLinks[i] = &TopLink{
+			Domain:    domain,
+			ShortCode: shortCode,
+			ShortURL:  s.ShortURL(domain, shortCode),
+			Clicks:    int64(z.Score),
+		}
+	}
+	return summary, nil
+}
+
+// BackfillSummary adds the links that exist but are not counted in the analytics summary,
+// for instance because they were created before it was introduced, and returns their number.
+// Unlike the summary itself, it scans every link.
+func (s *URLService) BackfillSummary() (int64, error) {
+	links := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(links); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	var added int64
+	var cursor uint64
+	for {
+		keys, next, err := links.ScanType(database.Ctx, cursor, "*", constants.ExportBatchSize, "string").Result()
+		if err != nil {
+			return added, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+		keys = filterLinkKeys(keys)
+
+		ttls := make([]*redis.DurationCmd, len(keys))
+		_, err = links.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				ttls[i] = pipe.PTTL(database.Ctx, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return added, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		now := time.Now().UTC()
+		members := make([]*redis.Z, 0, len(keys))
+		for i, key := range keys {
+			// The link may have expired between SCAN and PTTL
+			ttl := ttls[i].Val()
+			if ttl == -2 {
+				continue
+			}
+			members = append(members, &redis.Z{Score: linkExpiryScore(now, ttl), Member: key})
+		}
+		if len(members) > 0 {
+			n, err := r.ZAddNX(database.Ctx, constants.LinkExpiriesKey, members...).Result()
+			if err != nil {
+				return added, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+			}
+			if n > 0 {
+				if err := r.IncrBy(database.Ctx, constants.LinksCreatedKey, n).Err(); err != nil {
+					return added, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+				}
+			}
+			added += n
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return added, nil
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// clickGranularity is a size of time bucket clicks are counted in.
+//
+// Buckets are fields of a Redis hash holding one window of buckets (a day of minutes,
+// a month of hours or a year of days), keyed clicks:<granularity>:<link key>:<window>
+// (bot_clicks:... for bot hits).
+// Each hash expires once its whole window is older than the retention, so old buckets
+// are removed without a cleanup job and a link's series uses a bounded number of keys.
+type clickGranularity struct {
+	name      string
+	retention time.Duration
+}
+
+// TimeseriesQuery selects a range of click buckets; From and To are truncated to the interval.
+type TimeseriesQuery struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+	Traffic  string // TrafficHuman, TrafficBot or TrafficAll
+}
+
+// TimeseriesPoint is the number of clicks in the bucket starting at Time.
+type TimeseriesPoint struct {
+	Time   time.Time `json:"t"`
+	Clicks int64     `json:"clicks"`
+}
+
+// Timeseries is a zero-filled series of click buckets.
+type Timeseries struct {
+	Interval string             `json:"interval"`
+	Traffic  string             `json:"traffic"`
+	From     time.Time          `json:"from"`
+	To       time.Time          `json:"to"`
+	Total    int64              `json:"total"`
+	Points   []*TimeseriesPoint `json:"points"`
+}
+
+// clickGranularities returns the granularities enabled in the configuration, finest first.
+// A retention of zero disables a granularity.
+func clickGranularities(cfg *config.Config) []*clickGranularity {
+	var granularities []*clickGranularity
+	for _, g := range []*clickGranularity{
+		{name: constants.IntervalMinute, retention: cfg.MinuteClickRetention},
+		{name: constants.IntervalHour, retention: cfg.HourClickRetention},
+		{name: constants.IntervalDay, retention: cfg.DayClickRetention},
+	} {
+		if g.retention > 0 {
+			granularities = append(granularities, g)
+		}
+	}
+	return granularities
+}
+
+// truncate returns the start of the bucket containing t.
+func (g *clickGranularity) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g.name {
+	case constants.IntervalMinute:
+		return t.Truncate(time.Minute)
+	case constants.IntervalHour:
+		return t.Truncate(time.Hour)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// next returns the start of the bucket following the one starting at t.
+func (g *clickGranularity) next(t time.Time) time.Time {
+	switch g.name {
+	case constants.IntervalMinute:
+		return t.Add(time.Minute)
+	case constants.IntervalHour:
+		return t.Add(time.Hour)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// window returns the name and end of the window (hash) holding the bucket starting at t.
+func (g *clickGranularity) window(t time.Time) (string, time.Time) {
+	switch g.name {
+	case constants.IntervalMinute:
+		start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return start.Format("20060102"), start.AddDate(0, 0, 1)
+	case constants.IntervalHour:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("200601"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006"), start.AddDate(1, 0, 0)
+}
+
+// bucketKey returns the hash key and field of the bucket starting at t, and when the hash expires.
+// The prefix selects human or bot hits.
+func (g *clickGranularity) bucketKey(prefix, linkKey string, t time.Time) (string, string, time.Time) {
+	window, end := g.window(t)
+	return prefix + constants.ClickBucketPrefix + g.name + ":" + linkKey + ":" + window, strconv.FormatInt(t.Unix(), 10), end.Add(g.retention)
+}
+
+// trackClickBuckets queues the increments of every enabled bucket containing t on the pipeline.
+func (s *AnalyticsService) trackClickBuckets(pipe redis.Pipeliner, prefix, linkKey string, t time.Time) {
+	for _, g := range s.granularities {
+		key, field, expireAt := g.bucketKey(prefix, linkKey, g.truncate(t))
+		pipe.HIncrBy(database.Ctx, key, field, 1)
+		pipe.ExpireAt(database.Ctx, key, expireAt)
+	}
+}
+
+// granularity returns the enabled granularity with the given name.
+func (s *AnalyticsService) granularity(name string) (*clickGranularity, bool) {
+	for _, g := range s.granularities {
+		if g.name == name {
+			return g, true
+		}
+	}
+	return nil, false
+}
+
+// ParseTimeseriesQuery builds a time series query from raw values (typically query parameters).
+// Times are accepted as RFC 3339 timestamps, YYYY-MM-DD dates or Unix seconds. The interval
+// defaults to hour, to defaults to now and from defaults to DefaultTimeseriesPoints intervals
+// before to. The range may contain at most MaxTimeseriesPoints buckets. Traffic defaults to human clicks.
+func (s *AnalyticsService) ParseTimeseriesQuery(from, to, interval, traffic string) (*TimeseriesQuery, error) {
+	if interval == "" {
+		interval = constants.IntervalHour
+	}
+	g, ok := s.granularity(strings.ToLower(interval))
+	if !ok {
+		return nil, fmt.Errorf("invalid interval: %s (enabled: %s)", interval, strings.Join(s.intervalNames(), ", "))
+	}
+
+	query := &TimeseriesQuery{Interval: g.name}
+	var err error
+	if query.Traffic, err = ParseTraffic(traffic); err != nil {
+		return nil, err
+	}
+	if query.To, err = parseSeriesTime(to, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid to: %w", err)
+	}
+	query.To = g.truncate(query.To)
+
+	defaultFrom := query.To
+	for i := 1; i < constants.DefaultTimeseriesPoints; i++ {
+		defaultFrom = g.truncate(defaultFrom.Add(-time.Second))
+	}
+	if query.From, err = parseSeriesTime(from, defaultFrom); err != nil {
+		return nil, fmt.Errorf("invalid from: %w", err)
+	}
+	query.From = g.truncate(query.From)
+
+	if query.From.After(query.To) {
+		return nil, errors.New("invalid range: from is after to")
+	}
+	points := 0
+	for t := query.From; !t.After(query.To); t = g.next(t) {
+		if points++; points > constants.MaxTimeseriesPoints {
+			return nil, fmt.Errorf("invalid range: more than %d %s buckets", constants.MaxTimeseriesPoints, g.name)
+		}
+	}
+	return query, nil
+}
+
+// intervalNames returns the names of the enabled granularities.
+func (s *AnalyticsService) intervalNames() []string {
+	names := make([]string, len(s.granularities))
+	for i, g := range s.granularities {
+		names[i] = g.name
+	}
+	return names
+}
+
+// parseSeriesTime parses an RFC 3339 timestamp, a YYYY-MM-DD date or Unix seconds;
+// empty values return the fallback.
+func parseSeriesTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return parseFilterTime(value)
+}
+
+// GetClickTimeseries returns the clicks of a link in every bucket of the query's range,
+// including empty buckets, so the series can be charted directly. Buckets older than the
+// retention of the interval are reported as zero.
+func (s *AnalyticsService) GetClickTimeseries(linkKey string, query *TimeseriesQuery) (*Timeseries, error) {
+	series, err := s.GetClickTimeseriesBatch([]string{linkKey}, query)
+	if err != nil {
+		return nil, err
+	}
+	return series[0], nil
+}
+
+// GetClickTimeseriesBatch returns the time series of several links, as GetClickTimeseries does,
+// in one round trip. The series are in the order of the link keys.
+func (s *AnalyticsService) GetClickTimeseriesBatch(linkKeys []string, query *TimeseriesQuery) ([]*Timeseries, error) {
+	g, ok := s.granularity(query.Interval)
+	if !ok {
+		return nil, fmt.Errorf("invalid interval: %s", query.Interval)
+	}
+
+	var starts []time.Time
+	for t := query.From; !t.After(query.To); t = g.next(t) {
+		starts = append(starts, t)
+	}
+
+	all := make([]*Timeseries, len(linkKeys))
+	hashes := make([][]string, len(linkKeys)) // Hashes to read per series, in point order
+	fields := make(map[string][]string)       // Fields to read, grouped by hash
+	for n, linkKey := range linkKeys {
+		series := &Timeseries{Interval: g.name, Traffic: query.Traffic, From: query.From, To: query.To, Points: make([]*TimeseriesPoint, len(starts))}
+		for i, t := range starts {
+			series.Points[i] = &TimeseriesPoint{Time: t}
+		}
+		all[n] = series
+
+		for _, prefix := range trafficPrefixes(query.Traffic) {
+			for _, t := range starts {
+				key, field, _ := g.bucketKey(prefix, linkKey, t)
+				if _, ok := fields[key]; !ok {
+					hashes[n] = append(hashes[n], key)
+				}
+				fields[key] = append(fields[key], field)
+			}
+		}
+	}
+
+	r := database.CreateClient(constants.RedisDBRateLimit)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	cmds := make([][]*redis.SliceCmd, len(linkKeys))
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for n := range linkKeys {
+			for _, key := range hashes[n] {
+				cmds[n] = append(cmds[n], pipe.HMGet(database.Ctx, key, fields[key]...))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	// Points are in the same order as the hashes of their series and their fields, once per traffic class
+	for n, series := range all {
+		i := 0
+		for _, cmd := range cmds[n] {
+			for _, val := range cmd.Val() {
+				if str, ok := val.(string); ok {
+					clicks, _ := strconv.ParseInt(str, 10, 64)
+					series.Points[i%len(series.Points)].Clicks += clicks
+					series.Total += clicks
+				}
+				i++
+			}
+		}
+	}
+	return all, nil
+}
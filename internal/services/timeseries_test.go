@@ -0,0 +1,158 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// newTestTimeseriesService returns an analytics service keeping minutes for a day, hours
+// for a month and days for a year, or without per-minute buckets.
+func newTestTimeseriesService(minutes bool) *AnalyticsService {
+	cfg := &config.Config{
+		Domain:             "https://sho.rt",
+		Domains:            []string{"https://sho.rt"},
+		HourClickRetention: 30 * 24 * time.Hour,
+		DayClickRetention:  365 * 24 * time.Hour,
+	}
+	if minutes {
+		cfg.MinuteClickRetention = 24 * time.Hour
+	}
+	return NewAnalyticsService(cfg)
+}
+
+func TestParseTimeseriesQuery(t *testing.T) {
+	analytics := newTestTimeseriesService(false)
+	now := time.Now().UTC().Truncate(time.Hour)
+	may := func(day, hour int) time.Time { return time.Date(2024, 5, day, hour, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name                        string
+		from, to, interval, traffic string
+		want                        *TimeseriesQuery
+		wantErr                     string
+	}{
+		{name: "defaults", want: &TimeseriesQuery{Interval: constants.IntervalHour, From: now.Add(-23 * time.Hour), To: now, Traffic: constants.TrafficHuman}},
+		{name: "dates", from: "2024-05-01", to: "2024-05-03", interval: "DAY", traffic: "all",
+			want: &TimeseriesQuery{Interval: constants.IntervalDay, From: may(1, 0), To: may(3, 0), Traffic: constants.TrafficAll}},
+		{name: "times are truncated to the interval", from: "2024-05-01T10:59:59Z", to: strconv.FormatInt(may(1, 12).Unix()+1800, 10),
+			want: &TimeseriesQuery{Interval: constants.IntervalHour, From: may(1, 10), To: may(1, 12), Traffic: constants.TrafficHuman}},
+		{name: "default start", to: "2024-05-31", interval: "day",
+			want: &TimeseriesQuery{Interval: constants.IntervalDay, From: may(8, 0), To: may(31, 0), Traffic: constants.TrafficHuman}},
+		{name: "single bucket", from: "2024-05-01", to: "2024-05-01", interval: "day",
+			want: &TimeseriesQuery{Interval: constants.IntervalDay, From: may(1, 0), To: may(1, 0), Traffic: constants.TrafficHuman}},
+		{name: "disabled interval", interval: "minute", wantErr: "invalid interval: minute (enabled: hour, day)"},
+		{name: "unknown interval", interval: "week", wantErr: "invalid interval"},
+		{name: "unknown traffic", traffic: "robots", wantErr: "invalid traffic"},
+		{name: "invalid start", from: "yesterday", wantErr: "invalid from"},
+		{name: "invalid end", to: "2024-13-01", wantErr: "invalid to"},
+		{name: "start after end", from: "2024-05-02", to: "2024-05-01", wantErr: "from is after to"},
+		{name: "too many buckets", from: "2024-01-01", to: "2024-05-01", wantErr: "more than 2000 hour buckets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := analytics.ParseTimeseriesQuery(tt.from, tt.to, tt.interval, tt.traffic)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseTimeseriesQuery = %+v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimeseriesQuery = %v", err)
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseTimeseriesQuery = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClickTimeseries(t *testing.T) {
+	server := startTestRedis(t)
+	analytics := newTestTimeseriesService(true)
+
+	// Clicks within the last day, so no bucket has expired yet
+	base := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	click := func(code string, offset time.Duration, bot bool) *ClickEvent {
+		return &ClickEvent{LinkKey: code, ShortCode: code, Time: base.Add(offset), UserAgent: "Mozilla/5.0 Firefox/127.0", VisitorIP: "203.0.113.7", Bot: bot}
+	}
+	err := analytics.TrackClicks([]*ClickEvent{
+		click("promo", time.Minute, false),
+		click("promo", time.Minute+30*time.Second, false),
+		click("promo", 3*time.Minute, false),
+		click("promo", 3*time.Minute+59*time.Second, true),
+		click("promo", time.Hour+time.Minute, false),
+		click("other", time.Minute, false),
+	})
+	if err != nil {
+		t.Fatalf("TrackClicks = %v", err)
+	}
+
+	unix := func(offset time.Duration) string { return strconv.FormatInt(base.Add(offset).Unix(), 10) }
+	tests := []struct {
+		name     string
+		interval string
+		traffic  string
+		to       time.Duration
+		points   []int64
+	}{
+		{"minutes", constants.IntervalMinute, constants.TrafficHuman, 4 * time.Minute, []int64{0, 2, 0, 1, 0}},
+		{"minutes of bots", constants.IntervalMinute, constants.TrafficBot, 4 * time.Minute, []int64{0, 0, 0, 1, 0}},
+		{"minutes of all traffic", constants.IntervalMinute, constants.TrafficAll, 4 * time.Minute, []int64{0, 2, 0, 2, 0}},
+		{"hours", constants.IntervalHour, constants.TrafficHuman, 2 * time.Hour, []int64{3, 1, 0}},
+		{"hours of all traffic", constants.IntervalHour, constants.TrafficAll, 2 * time.Hour, []int64{4, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := analytics.ParseTimeseriesQuery(unix(0), unix(tt.to), tt.interval, tt.traffic)
+			if err != nil {
+				t.Fatalf("ParseTimeseriesQuery = %v", err)
+			}
+			series, err := analytics.GetClickTimeseries("promo", query)
+			if err != nil {
+				t.Fatalf("GetClickTimeseries = %v", err)
+			}
+
+			// Every bucket of the range is reported, empty ones included
+			if len(series.Points) != len(tt.points) {
+				t.Fatalf("%d points, want %d", len(series.Points), len(tt.points))
+			}
+			var total int64
+			for i, point := range series.Points {
+				if point.Clicks != tt.points[i] {
+					t.Errorf("point %d at %s = %d clicks, want %d", i, point.Time, point.Clicks, tt.points[i])
+				}
+				total += tt.points[i]
+			}
+			if series.Total != total || series.Interval != tt.interval || series.Traffic != tt.traffic {
+				t.Errorf("series = %s %s with %d clicks, want %s %s with %d", series.Interval, series.Traffic, series.Total, tt.interval, tt.traffic, total)
+			}
+		})
+	}
+
+	// Series of several links are read together, in the order asked for
+	query, _ := analytics.ParseTimeseriesQuery(unix(0), unix(time.Hour), constants.IntervalDay, "")
+	batch, err := analytics.GetClickTimeseriesBatch([]string{"other", "missing", "promo"}, query)
+	if err != nil {
+		t.Fatalf("GetClickTimeseriesBatch = %v", err)
+	}
+	for i, want := range []int64{1, 0, 4} {
+		if batch[i].Total != want {
+			t.Errorf("series %d has %d clicks, want %d", i, batch[i].Total, want)
+		}
+	}
+
+	// A window of buckets expires once all of it is older than the retention
+	db := server.DB(constants.RedisDBRateLimit)
+	day := base.Truncate(24 * time.Hour)
+	key := constants.ClickBucketPrefix + constants.IntervalMinute + ":promo:" + day.Format("20060102")
+	want := time.Until(day.Add(48 * time.Hour))
+	if ttl := db.TTL(key); ttl < want-time.Minute || ttl > want+time.Minute {
+		t.Errorf("TTL of %s = %s, want about %s", key, ttl, want)
+	}
+}
@@ -0,0 +1,571 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"github.com/adeesh/url-shortener/internal/database"
+	"github.com/go-redis/redis/v8"
+)
+
+// ImportRow is a single link read from an import CSV file, together with its outcome.
+type ImportRow struct {
+	Line        int           `json:"line"`                // Line of the row in the CSV file
+	URL         string        `json:"url"`                 // The original URL
+	CustomShort string        `json:"short,omitempty"`     // Optional custom short code
+	Domain      string        `json:"domain,omitempty"`    // Optional short domain
+	Expiry      time.Duration `json:"expiry,omitempty"`    // Expiry time in hours
+	Tags        []string      `json:"tags,omitempty"`      // Optional tags
+	ShortURL    string        `json:"short_url,omitempty"` // The complete shortened URL once created
+	Error       string        `json:"error,omitempty"`     // Why the row was rejected
+}
+
+// ImportReport summarises an import or a dry-run validation of one.
+type ImportReport struct {
+	DryRun  bool         `json:"dry_run"` // Whether links were only validated
+	Total   int          `json:"total"`   // Number of rows read
+	Valid   int          `json:"valid"`   // Rows that passed validation
+	Invalid int          `json:"invalid"` // Rows that were rejected
+	Created int          `json:"created"` // Links created; always zero for a dry run
+	Rows    []*ImportRow `json:"rows"`    // Per-row outcome, in file order
+}
+
+// LinkFilter selects which links are exported. Zero values match every link.
+type LinkFilter struct {
+	Domain        string    // Only links on this short domain (origin)
+	Domains       []string  // Only links on one of these short domains (origins), unless nil
+	Tag           string    // Only links carrying this tag
+	Host          string    // Only links whose destination is on this host
+	CreatedAfter  time.Time // Only links created at or after this time
+	CreatedBefore time.Time // Only links created before this time
+	Health        string    // Only links with this health (LinkHealthOK or LinkHealthBroken)
+}
+
+// LinkExport is a link as written by an export, including its click count.
+type LinkExport struct {
+	Domain       string     `json:"domain"`
+	ShortCode    string     `json:"short"`
+	ShortURL     string     `json:"short_url"`
+	URL          string     `json:"url"`
+	Title        string     `json:"title,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Interstitial bool       `json:"interstitial"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Clicks       int64      `json:"clicks"`
+	Health       string     `json:"health,omitempty"`
+	CheckedAt    *time.Time `json:"health_checked_at,omitempty"`
+}
+
+// LinkExportWriter writes exported links in a streaming format.
+type LinkExportWriter interface {
+	Write(link *LinkExport) error
+	Flush() error
+}
+
+// importColumns maps the supported CSV columns to their default positions,
+// used when the file has no header row.
+var importColumns = map[string]int{"url": 0, "short": 1, "expiry": 2, "tags": 3, "domain": 4}
+
+// ParseImportCSV reads links from CSV with the columns url, short, expiry (hours), tags and domain.
+// A header row naming the columns is optional; without one the columns are read in that order.
+// Tags within a field may be separated by commas, semicolons or pipes.
+// Malformed values are reported on the row rather than failing the whole file.
+func ParseImportCSV(r io.Reader) ([]*ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	columns := importColumns
+	var rows []*ImportRow
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+
+		if first {
+			if header, ok := parseImportHeader(record); ok {
+				columns = header
+				continue
+			}
+		}
+
+		if len(rows) >= constants.MaxImportRows {
+			return nil, fmt.Errorf("too many rows: the limit is %d", constants.MaxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, parseImportRecord(record, columns, line))
+	}
+	return rows, nil
+}
+
+// parseImportHeader returns the column positions if the record is a header row.
+func parseImportHeader(record []string) (map[string]int, bool) {
+	columns := make(map[string]int, len(record))
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, known := importColumns[name]; known {
+			columns[name] = i
+		}
+	}
+	_, hasURL := columns["url"]
+	return columns, hasURL
+}
+
+// parseImportRecord converts a CSV record into an import row.
+func parseImportRecord(record []string, columns map[string]int, line int) *ImportRow {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := &ImportRow{
+		Line:        line,
+		URL:         field("url"),
+		CustomShort: field("short"),
+		Domain:      field("domain"),
+		Tags: normalizeTags(strings.FieldsFunc(field("tags"), func(r rune) bool {
+			return r == ',' || r == ';' || r == '|'
+		})),
+	}
+	if expiry := field("expiry"); expiry != "" {
+		hours, err := strconv.Atoi(expiry)
+		if err != nil || hours < 0 {
+			row.Error = fmt.Sprintf("invalid expiry: %q is not a number of hours", expiry)
+		}
+		row.Expiry = time.Duration(hours)
+	}
+	return row
+}
+
+// ImportLinks validates the rows and, unless dryRun is set, creates links for the valid ones.
+// A dry run also checks custom short codes against the database so the report predicts
+// the outcome of a real import. Links are created in pipelined batches of MaxBulkItems.
+func (s *URLService) ImportLinks(rows []*ImportRow, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Total: len(rows), Rows: rows}
+
+	valid := make([]*ImportRow, 0, len(rows))
+	seen := make(map[string]int, len(rows))
+	// All rows share one unwrap time limit
+	ctx, cancel := newUnwrapContext()
+	defer cancel()
+	for _, row := range rows {
+		if row.Error != "" {
+			continue
+		}
+		normalized, err := s.validateURL(ctx, row.URL)
+		if err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		row.URL = normalized
+		if _, _, err := s.screenDestination(row.URL); err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		domain, err := s.LookupDomain(row.Domain)
+		if err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		if err := s.checkDestination(row.URL, domain); err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		if err := validateShortCode(row.CustomShort); err != nil {
+			row.Error = err.Error()
+			continue
+		}
+		if row.CustomShort != "" {
+			key := s.LinkKey(domain, row.CustomShort)
+			if line, ok := seen[key]; ok {
+				row.Error = fmt.Sprintf("short code in use: %s (duplicate of line %d)", constants.ErrorURLShortInUse, line)
+				continue
+			}
+			seen[key] = row.Line
+		}
+		valid = append(valid, row)
+	}
+
+	if dryRun {
+		if err := s.checkImportAvailability(valid); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.createImportedLinks(valid); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range rows {
+		if row.Error != "" {
+			report.Invalid++
+			continue
+		}
+		report.Valid++
+		if row.ShortURL != "" {
+			report.Created++
+		}
+	}
+	return report, nil
+}
+
+// checkImportAvailability marks rows whose custom short code already exists.
+func (s *URLService) checkImportAvailability(rows []*ImportRow) error {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	exists := make(map[*ImportRow]*redis.IntCmd)
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for _, row := range rows {
+			if row.CustomShort != "" {
+				// Domains were already validated, so the lookup cannot fail here
+				domain, _ := s.LookupDomain(row.Domain)
+				exists[row] = pipe.Exists(database.Ctx, s.LinkKey(domain, row.CustomShort))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	for row, cmd := range exists {
+		if cmd.Val() > 0 {
+			row.Error = fmt.Sprintf("short code in use: %s", constants.ErrorURLShortInUse)
+		}
+	}
+	return nil
+}
+
+// createImportedLinks creates links for the rows in batches and records the outcome on each row.
+func (s *URLService) createImportedLinks(rows []*ImportRow) error {
+	for start := 0; start < len(rows); start += constants.MaxBulkItems {
+		end := start + constants.MaxBulkItems
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+
+		reqs := make([]*ShortenURLRequest, len(batch))
+		for i, row := range batch {
+			reqs[i] = &ShortenURLRequest{
+				URL:         row.URL,
+				CustomShort: row.CustomShort,
+				Domain:      row.Domain,
+				Expiry:      row.Expiry,
+				Tags:        row.Tags,
+			}
+		}
+
+		results, err := s.ShortenURLs(reqs)
+		if err != nil {
+			return err
+		}
+		for i, result := range results {
+			batch[i].ShortURL = result.Short
+			batch[i].Error = result.Error
+		}
+	}
+	return nil
+}
+
+// ParseLinkFilter builds a link filter from raw values (typically query parameters or flags).
+// The domain is a configured short domain, dates are accepted as RFC 3339 timestamps or as YYYY-MM-DD,
+// and health is "ok" or "broken".
+func (s *URLService) ParseLinkFilter(domain, tag, host, createdAfter, createdBefore, health string) (*LinkFilter, error) {
+	filter := &LinkFilter{
+		Tag:    strings.ToLower(strings.TrimSpace(tag)),
+		Host:   strings.ToLower(strings.TrimSpace(host)),
+		Health: strings.ToLower(strings.TrimSpace(health)),
+	}
+	if filter.Health != "" && filter.Health != constants.LinkHealthOK && filter.Health != constants.LinkHealthBroken {
+		return nil, fmt.Errorf("invalid health: %s (expected %s or %s)", health, constants.LinkHealthOK, constants.LinkHealthBroken)
+	}
+
+	var err error
+	if domain != "" {
+		if filter.Domain, err = s.LookupDomain(domain); err != nil {
+			return nil, err
+		}
+	}
+	if filter.CreatedAfter, err = parseFilterTime(createdAfter); err != nil {
+		return nil, fmt.Errorf("invalid created_after: %w", err)
+	}
+	if filter.CreatedBefore, err = parseFilterTime(createdBefore); err != nil {
+		return nil, fmt.Errorf("invalid created_before: %w", err)
+	}
+	return filter, nil
+}
+
+// parseFilterTime parses an RFC 3339 timestamp or a YYYY-MM-DD date; empty values return the zero time.
+func parseFilterTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// matches reports whether a link passes the filter.
+func (f *LinkFilter) matches(link *Link) bool {
+	if f.Domain != "" && link.Domain != f.Domain {
+		return false
+	}
+	if f.Domains != nil {
+		found := false
+		for _, domain := range f.Domains {
+			if domain == link.Domain {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Tag != "" {
+		found := false
+		for _, tag := range link.Tags {
+			if tag == f.Tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Host != "" {
+		parsed, err := url.Parse(link.URL)
+		if err != nil || strings.ToLower(parsed.Hostname()) != f.Host {
+			return false
+		}
+	}
+	if !f.CreatedAfter.IsZero() && link.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !link.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if f.Health != "" && link.Health != f.Health {
+		return false
+	}
+	return true
+}
+
+// ExportLinks streams every link matching the filter to fn, one at a time.
+// Links are read with SCAN in batches of ExportBatchSize so memory use does not grow with
+// the number of links. SCAN may return a key more than once if the keyspace is resized
+// during the export, so consumers needing strict uniqueness should de-duplicate.
+func (s *URLService) ExportLinks(filter *LinkFilter, fn func(*LinkExport) error) error {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	analytics := NewAnalyticsService(s.config)
+	var cursor uint64
+	for {
+		keys, next, err := r.ScanType(database.Ctx, cursor, "*", constants.ExportBatchSize, "string").Result()
+		if err != nil {
+			return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+		keys = filterLinkKeys(keys)
+
+		links, err := s.loadExportBatch(r, keys, filter)
+		if err != nil {
+			return err
+		}
+
+		// Clicks are tracked per link key, which includes the domain for non-default domains
+		linkKeys := make([]string, len(links))
+		for i, link := range links {
+			linkKeys[i] = s.LinkKey(link.Domain, link.ShortCode)
+		}
+		counts, err := analytics.GetShortURLAccessCounts(linkKeys)
+		if err != nil {
+			return fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+		}
+
+		for i, link := range links {
+			link.Clicks = counts[i]
+			if err := fn(link); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// filterLinkKeys keeps the keys of a scan of the links database that are link keys.
+func filterLinkKeys(keys []string) []string {
+	links := keys[:0]
+	for _, key := range keys {
+		if isLinkKey(key) {
+			links = append(links, key)
+		}
+	}
+	return links
+}
+
+// loadExportBatch reads the URL, metadata and expiry of a batch of links in one round trip.
+func (s *URLService) loadExportBatch(r *redis.Client, keys []string, filter *LinkFilter) ([]*LinkExport, error) {
+	gets := make([]*redis.StringCmd, len(keys))
+	metas := make([]*redis.StringStringMapCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	_, err := r.Pipelined(database.Ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			gets[i] = pipe.Get(database.Ctx, key)
+			metas[i] = pipe.HGetAll(database.Ctx, constants.LinkMetaPrefix+key)
+			ttls[i] = pipe.PTTL(database.Ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+	}
+
+	now := time.Now().UTC()
+	links := make([]*LinkExport, 0, len(keys))
+	for i, key := range keys {
+		// The link may have expired between SCAN and GET
+		if gets[i].Err() != nil {
+			continue
+		}
+
+		domain, shortCode := s.splitLinkKey(key)
+		link := &Link{Domain: domain, ShortCode: shortCode, URL: gets[i].Val()}
+		parseLinkMeta(link, metas[i].Val())
+		if !filter.matches(link) {
+			continue
+		}
+
+		export := &LinkExport{
+			Domain:       link.Domain,
+			ShortCode:    link.ShortCode,
+			ShortURL:     s.ShortURL(link.Domain, link.ShortCode),
+			URL:          link.URL,
+			Title:        link.Title,
+			Tags:         link.Tags,
+			Interstitial: link.Interstitial,
+		}
+		if !link.CreatedAt.IsZero() {
+			createdAt := link.CreatedAt
+			export.CreatedAt = &createdAt
+		}
+		if !link.HealthCheckedAt.IsZero() {
+			checkedAt := link.HealthCheckedAt
+			export.Health = link.Health
+			export.CheckedAt = &checkedAt
+		}
+		if ttl := ttls[i].Val(); ttl > 0 {
+			expiresAt := now.Add(ttl).Truncate(time.Second)
+			export.ExpiresAt = &expiresAt
+		}
+		links = append(links, export)
+	}
+	return links, nil
+}
+
+// NewLinkExportWriter returns a writer producing CSV or NDJSON.
+func NewLinkExportWriter(w io.Writer, format string) (LinkExportWriter, error) {
+	switch format {
+	case constants.ExportFormatCSV:
+		return newCSVLinkWriter(w)
+	case constants.ExportFormatNDJSON:
+		return &ndjsonLinkWriter{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("invalid format: %s (expected %s or %s)", format, constants.ExportFormatCSV, constants.ExportFormatNDJSON)
+}
+
+// csvLinkWriter writes links as CSV with a header row.
+type csvLinkWriter struct {
+	writer *csv.Writer
+}
+
+// newCSVLinkWriter creates a CSV writer and writes the header row.
+func newCSVLinkWriter(w io.Writer) (*csvLinkWriter, error) {
+	writer := csv.NewWriter(w)
+	header := []string{"domain", "short", "short_url", "url", "title", "tags", "interstitial", "created_at", "expires_at", "clicks", "health", "health_checked_at"}
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	return &csvLinkWriter{writer: writer}, nil
+}
+
+// Write writes a single link as a CSV record.
+func (w *csvLinkWriter) Write(link *LinkExport) error {
+	return w.writer.Write([]string{
+		link.Domain,
+		link.ShortCode,
+		link.ShortURL,
+		link.URL,
+		link.Title,
+		strings.Join(link.Tags, ","),
+		strconv.FormatBool(link.Interstitial),
+		formatExportTime(link.CreatedAt),
+		formatExportTime(link.ExpiresAt),
+		strconv.FormatInt(link.Clicks, 10),
+		link.Health,
+		formatExportTime(link.CheckedAt),
+	})
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (w *csvLinkWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonLinkWriter writes one JSON object per line.
+type ndjsonLinkWriter struct {
+	encoder *json.Encoder
+}
+
+// Write writes a single link as a JSON line.
+func (w *ndjsonLinkWriter) Write(link *LinkExport) error {
+	return w.encoder.Encode(link)
+}
+
+// Flush is a no-op; every line is written as soon as it is encoded.
+func (w *ndjsonLinkWriter) Flush() error {
+	return nil
+}
+
+// formatExportTime formats an optional time as RFC 3339, or an empty string.
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/config"
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// newTestTransferService returns a URL service serving a default and a customer domain.
+func newTestTransferService() *URLService {
+	return NewURLService(&config.Config{
+		Domain:          "https://sho.rt",
+		Domains:         []string{"https://sho.rt", "https://go.acme.com"},
+		AllowedSchemes:  []string{"http", "https"},
+		ShortenerAction: constants.ShortenerActionAllow,
+	})
+}
+
+func TestImportLinks(t *testing.T) {
+	const file = "url,short,expiry,tags,domain\n" +
+		"https://example.com/a,promo,,sale,\n" +
+		"not a url,,,,\n" +
+		"https://example.com/b,taken,,,\n" +
+		"https://example.com/c,promo,,,\n" +
+		"https://example.com/d,promo,,,go.acme.com\n" +
+		"https://example.com/e,,,,unknown.example\n" +
+		"https://example.com/f,,soon,,\n"
+
+	tests := []struct {
+		name    string
+		dryRun  bool
+		created int
+	}{
+		{name: "dry run", dryRun: true},
+		{name: "import", created: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startTestRedis(t)
+			_ = server.Set("taken", "https://example.com/existing")
+			urlService := newTestTransferService()
+
+			rows, err := ParseImportCSV(strings.NewReader(file))
+			if err != nil {
+				t.Fatalf("ParseImportCSV = %v", err)
+			}
+			report, err := urlService.ImportLinks(rows, tt.dryRun)
+			if err != nil {
+				t.Fatalf("ImportLinks = %v", err)
+			}
+
+			if report.Total != 7 || report.Valid != 2 || report.Invalid != 5 || report.Created != tt.created {
+				t.Errorf("report = %d total, %d valid, %d invalid, %d created, want 7, 2, 5, %d",
+					report.Total, report.Valid, report.Invalid, report.Created, tt.created)
+			}
+			// Rows are reported in file order, with the reason of each rejection
+			wantErrors := []string{"", "invalid url", "short code in use", "duplicate of line 2", "", "unknown domain", "invalid expiry"}
+			for i, row := range report.Rows {
+				if row.Line != i+2 {
+					t.Errorf("row %d is line %d, want %d", i, row.Line, i+2)
+				}
+				if (wantErrors[i] == "") != (row.Error == "") || !strings.Contains(row.Error, wantErrors[i]) {
+					t.Errorf("line %d error = %q, want %q", row.Line, row.Error, wantErrors[i])
+				}
+			}
+
+			for _, key := range []string{"promo", "go.acme.com/promo"} {
+				if exists := server.Exists(key); exists == tt.dryRun {
+					t.Errorf("link %s exists = %v after a dry run = %v", key, exists, tt.dryRun)
+				}
+			}
+			if got, _ := server.Get("taken"); got != "https://example.com/existing" {
+				t.Errorf("existing link = %q, want it untouched", got)
+			}
+		})
+	}
+}
+
+func TestExportLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		domain  string
+		domains []string
+		tag     string
+		want    []string // Short URLs exported, in any order
+	}{
+		{name: "every link", want: []string{"https://sho.rt/home", "https://sho.rt/promo", "https://go.acme.com/promo"}},
+		{name: "one domain", domain: "go.acme.com", want: []string{"https://go.acme.com/promo"}},
+		{name: "domains of a client", domains: []string{"https://go.acme.com"}, want: []string{"https://go.acme.com/promo"}},
+		{name: "client without domains", domains: []string{}},
+		{name: "tag", tag: "Sale", want: []string{"https://sho.rt/promo", "https://go.acme.com/promo"}},
+		{name: "tag within a client's domains", domains: []string{"https://sho.rt"}, tag: "sale", want: []string{"https://sho.rt/promo"}},
+	}
+
+	server := startTestRedis(t)
+	urlService := newTestTransferService()
+	rows, _ := ParseImportCSV(strings.NewReader("url,short,expiry,tags,domain\n" +
+		"https://example.com/,home,,,\n" +
+		"https://example.com/sale,promo,,sale,\n" +
+		"https://acme.example/sale,promo,,sale,go.acme.com\n"))
+	if report, err := urlService.ImportLinks(rows, false); err != nil || report.Created != 3 {
+		t.Fatalf("ImportLinks = %+v, %v, want 3 links created", report, err)
+	}
+	// Other string keys are not links, even if they look like URLs
+	_ = server.Set("reporter:secret", "https://example.com/")
+	_ = server.Set("Not A Host/promo", "https://example.com/")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := urlService.ParseLinkFilter(tt.domain, tt.tag, "", "", "", "")
+			if err != nil {
+				t.Fatalf("ParseLinkFilter = %v", err)
+			}
+			filter.Domains = tt.domains
+
+			var got []string
+			err = urlService.ExportLinks(filter, func(link *LinkExport) error {
+				got = append(got, link.ShortURL)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ExportLinks = %v", err)
+			}
+			if !sameStrings(got, tt.want) {
+				t.Errorf("exported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkExportWriter(t *testing.T) {
+	link := &LinkExport{
+		Domain:    "https://go.acme.com",
+		ShortCode: "promo",
+		ShortURL:  "https://go.acme.com/promo",
+		URL:       "https://acme.example/sale?a=1,2",
+		Tags:      []string{"sale", "spring"},
+		Clicks:    42,
+	}
+
+	t.Run(constants.ExportFormatCSV, func(t *testing.T) {
+		var out bytes.Buffer
+		writer, err := NewLinkExportWriter(&out, constants.ExportFormatCSV)
+		if err != nil {
+			t.Fatalf("NewLinkExportWriter = %v", err)
+		}
+		if err := writer.Write(link); err != nil {
+			t.Fatalf("Write = %v", err)
+		}
+		if err := writer.Flush(); err != nil {
+			t.Fatalf("Flush = %v", err)
+		}
+
+		records, err := csv.NewReader(&out).ReadAll()
+		if err != nil || len(records) != 2 {
+			t.Fatalf("output = %q, %v, want a header and one record", out.String(), err)
+		}
+		row := make(map[string]string)
+		for i, column := range records[0] {
+			row[column] = records[1][i]
+		}
+		if row["short_url"] != link.ShortURL || row["url"] != link.URL || row["tags"] != "sale,spring" ||
+			row["clicks"] != "42" || row["interstitial"] != "false" || row["created_at"] != "" {
+			t.Errorf("record = %v", row)
+		}
+	})
+
+	t.Run(constants.ExportFormatNDJSON, func(t *testing.T) {
+		var out bytes.Buffer
+		writer, err := NewLinkExportWriter(&out, constants.ExportFormatNDJSON)
+		if err != nil {
+			t.Fatalf("NewLinkExportWriter = %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := writer.Write(link); err != nil {
+				t.Fatalf("Write = %v", err)
+			}
+		}
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("output = %q, want one line per link", out.String())
+		}
+		var got LinkExport
+		if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+			t.Fatalf("line %q: %v", lines[0], err)
+		}
+		if got.ShortURL != link.ShortURL || got.Clicks != 42 || !sameStrings(got.Tags, link.Tags) {
+			t.Errorf("decoded %+v, want %+v", got, link)
+		}
+	})
+
+	if _, err := NewLinkExportWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Error("NewLinkExportWriter accepted an unknown format")
+	}
+}
+
+// sameStrings reports whether two slices hold the same strings, in any order.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int, len(a))
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+		if counts[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -1,8 +1,17 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/adeesh/url-shortener/internal/config"
@@ -14,23 +23,83 @@ import (
 	"github.com/google/uuid"
 )
 
+// shortCodePattern matches the custom short codes that may be requested.
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,64}$`)
+
+// reservedShortCodes are custom short codes that cannot be requested because the analytics
+// API serves a route where the link's analytics would be.
+var reservedShortCodes = map[string]bool{
+	"summary": true,
+	"export":  true,
+}
+
+// ErrLinkNotFound is returned when a short code does not map to a stored link.
+var ErrLinkNotFound = errors.New(constants.ShortUrlNotFoundOnDatabase)
+
 // URLService handles URL shortening business logic.
 type URLService struct {
-	config *config.Config // Application configuration
+	config  *config.Config     // Application configuration
+	checker URLChecker         // Destination reputation checker; nil disables checking
+	policy  *DestinationPolicy // Internal network destination policy; nil disables it
+
+	shorteners *ShortenerPolicy // Policy for destinations on other shorteners; nil allows them
+
+	secretMu       sync.Mutex // Guards the cached reporter secret
+	reporterSecret []byte
 }
 
 // NewURLService creates a new URL service instance.
+// If a blocklist file is configured it is used as the destination reputation checker.
 func NewURLService(cfg *config.Config) *URLService {
-	return &URLService{
+	s := &URLService{
 		config: cfg,
 	}
+	if cfg.BlocklistFile != "" {
+		checker, err := NewBlocklistChecker(cfg.BlocklistFile, cfg.BlocklistReload)
+		if err != nil {
+			log.Printf("Warning: destination blocklist disabled: %v", err)
+		} else {
+			s.checker = checker
+		}
+	}
+	if cfg.BlockPrivateDestinations {
+		s.policy = NewDestinationPolicy(net.DefaultResolver, constants.DestinationLookupTimeout, cfg.PrivateDestinationAllowlist)
+	}
+	if cfg.ShortenerAction != constants.ShortenerActionAllow {
+		s.shorteners = NewShortenerPolicy(cfg.KnownShorteners, cfg.ShortenerAction, NewUnwrapClient())
+	}
+	return s
+}
+
+// SetURLChecker replaces the destination reputation checker; nil disables checking.
+func (s *URLService) SetURLChecker(checker URLChecker) {
+	s.checker = checker
+}
+
+// SetShortenerPolicy replaces the policy for destinations on other shorteners; nil allows them.
+func (s *URLService) SetShortenerPolicy(policy *ShortenerPolicy) {
+	s.shorteners = policy
+}
+
+// DestinationPolicy returns the internal network destination policy; nil if it is disabled.
+func (s *URLService) DestinationPolicy() *DestinationPolicy {
+	return s.policy
+}
+
+// SetDestinationPolicy replaces the internal network destination policy; nil disables it.
+func (s *URLService) SetDestinationPolicy(policy *DestinationPolicy) {
+	s.policy = policy
 }
 
 // ShortenURLRequest represents the request for shortening a URL.
 type ShortenURLRequest struct {
-	URL         string        `json:"url"`    // The original URL to be shortened
-	CustomShort string        `json:"short"`  // Optional custom short code
-	Expiry      time.Duration `json:"expiry"` // Expiry time in hours
+	URL          string        `json:"url"`          // The original URL to be shortened
+	CustomShort  string        `json:"short"`        // Optional custom short code
+	Expiry       time.Duration `json:"expiry"`       // Expiry time in hours
+	Title        string        `json:"title"`        // Optional human readable title shown on the preview page
+	Interstitial bool          `json:"interstitial"` // Always show the preview page with a countdown before redirecting
+	Tags         []string      `json:"tags"`         // Optional tags used to organise and filter links
+	Domain       string        `json:"domain"`       // Optional short domain (e.g. "acme.link"); defaults to the primary domain
 }
 
 // ShortenURLResponse represents the response for shortening a URL.
@@ -38,28 +107,71 @@ type ShortenURLResponse struct {
 	URL             string        `json:"url"`              // The original URL
 	CustomShort     string        `json:"short"`            // The complete shortened URL
 	Expiry          time.Duration `json:"expiry"`           // Expiry time in hours
+	Title           string        `json:"title,omitempty"`  // The link title
+	Interstitial    bool          `json:"interstitial"`     // Whether the link always shows the interstitial page
+	Tags            []string      `json:"tags,omitempty"`   // The link tags
+	Status          string        `json:"status"`           // "active", or "quarantined" if the destination is blocklisted
 	XRateRemaining  int           `json:"rate_limit"`       // Remaining API requests
 	XRateLimitReset time.Duration `json:"rate_limit_reset"` // Time until rate limit resets
 }
 
+// Link represents a stored short link together with its metadata.
+type Link struct {
+	Domain       string    // The short domain the code belongs to
+	ShortCode    string    // The short code identifying the link within its domain
+	URL          string    // The original URL
+	Title        string    // Optional human readable title
+	CreatedAt    time.Time // Creation time; zero for links created before metadata was recorded
+	Interstitial bool      // Whether the link always shows the interstitial page
+	Tags         []string  // Optional tags
+	Status       string    // LinkStatusActive or LinkStatusQuarantined
+	StatusReason string    // Why the link is quarantined
+
+	Health          string    // LinkHealthOK or LinkHealthBroken; empty until the destination is probed
+	HealthCheckedAt time.Time // Time of the last probe; zero if never probed
+
+	ReportCount int64 // Number of distinct reporters of abuse since the last review
+}
+
 // ShortenURL handles the URL shortening process.
 // This is the main business logic function for URL shortening.
 // It performs validation, generates short codes, and persists the mapping.
 // Returns a response with the shortened URL or an error.
 func (s *URLService) ShortenURL(req *ShortenURLRequest) (*ShortenURLResponse, error) {
-	// Validate the provided URL
-	if err := s.validateURL(req.URL); err != nil {
+	// Validate the provided URL and normalize it for consistency
+	ctx, cancel := newUnwrapContext()
+	defer cancel()
+	normalized, err := s.validateURL(ctx, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = normalized
+
+	// Reject or quarantine blocklisted destinations
+	status, reason, err := s.screenDestination(req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the short domain the link is created on
+	domain, err := s.LookupDomain(req.Domain)
+	if err != nil {
 		return nil, err
 	}
 
-	// Enforce HTTP scheme for consistency
-	req.URL = utils.EnforceHTTP(req.URL)
+	// Reject destinations on internal networks not allowed for the domain
+	if err := s.checkDestination(req.URL, domain); err != nil {
+		return nil, err
+	}
 
 	// Generate short code (custom or random)
+	if err := validateShortCode(req.CustomShort); err != nil {
+		return nil, err
+	}
 	shortCode := s.generateShortCode(req.CustomShort)
 
-	// Check if short code is available
-	if err := s.checkShortCodeAvailability(shortCode); err != nil {
+	// Check if short code is available on the domain
+	if err := s.checkShortCodeAvailability(s.LinkKey(domain, shortCode)); err != nil {
 		return nil, err
 	}
 
@@ -67,17 +179,29 @@ func (s *URLService) ShortenURL(req *ShortenURLRequest) (*ShortenURLResponse, er
 	req.Expiry = s.setDefaultExpiry(req.Expiry)
 
 	// Save URL mapping to database
-	if err := s.saveURLMapping(shortCode, req.URL, req.Expiry); err != nil {
+	link := &Link{
+		Domain:       domain,
+		ShortCode:    shortCode,
+		URL:          req.URL,
+		Title:        req.Title,
+		CreatedAt:    time.Now().UTC(),
+		Interstitial: req.Interstitial,
+		Tags:         normalizeTags(req.Tags),
+		Status:       status,
+		StatusReason: reason,
+	}
+	if err := s.saveURLMapping(link, req.Expiry); err != nil {
 		return nil, err
 	}
 
 	// Build and return response
-	response := s.buildResponse(req, shortCode)
+	response := s.buildResponse(req, domain, shortCode)
+	response.Status = status
 	return response, nil
 }
 
-// GetOriginalURL retrieves the original URL from Redis using the short code.
-func (s *URLService) GetOriginalURL(shortCode string) (string, error) {
+// GetOriginalURL retrieves the original URL from Redis using the domain and short code.
+func (s *URLService) GetOriginalURL(domain, shortCode string) (string, error) {
 	r := database.CreateClient(constants.RedisDBURLMappings)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -86,10 +210,10 @@ func (s *URLService) GetOriginalURL(shortCode string) (string, error) {
 		}
 	}()
 
-	value, err := database.Get(r, shortCode)
+	value, err := database.Get(r, s.LinkKey(domain, shortCode))
 	if errors.Is(err, redis.Nil) {
 		// Short code not found in database
-		return "", fmt.Errorf("not found: %s", constants.ShortUrlNotFoundOnDatabase)
+		return "", fmt.Errorf("not found: %w", ErrLinkNotFound)
 	} else if err != nil {
 		// Database connection or other error
 		return "", fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
@@ -97,17 +221,68 @@ func (s *URLService) GetOriginalURL(shortCode string) (string, error) {
 	return value, nil
 }
 
-// validateURL checks if the provided URL is valid and not the application domain (prevents infinite loops)
-func (s *URLService) validateURL(url string) error {
-	if !govalidator.IsURL(url) {
-		return fmt.Errorf("invalid url: %s", constants.ErrorInvalidURL)
+// GetLink retrieves the original URL and the metadata of a short link.
+// Links created before metadata was recorded are returned with only the URL set.
+func (s *URLService) GetLink(domain, shortCode string) (*Link, error) {
+	originalURL, err := s.GetOriginalURL(domain, shortCode)
+	if err != nil {
+		return nil, err
 	}
 
-	if !utils.RemoveDomainError(url) {
-		return fmt.Errorf("domain error: %s", constants.ErrorInvalidURL)
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	link := &Link{Domain: domain, ShortCode: shortCode, URL: originalURL}
+	meta, err := database.GetHash(r, constants.LinkMetaPrefix+s.LinkKey(domain, shortCode))
+	if err != nil {
+		return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
 	}
 
-	return nil
+	parseLinkMeta(link, meta)
+	return link, nil
+}
+
+// validateURL checks if the provided URL is valid and not on one of the application's domains (prevents
+// infinite loops). Returns the URL in normalized form (see utils.NormalizeURL), unwrapped if it was a
+// link on another shortener and the shortener action is "unwrap". Unwrapping stops when ctx is done.
+func (s *URLService) validateURL(ctx context.Context, rawURL string) (string, error) {
+	normalized, err := utils.NormalizeURL(rawURL, s.config.AllowedSchemes)
+	if errors.Is(err, utils.ErrSchemeNotAllowed) {
+		return "", fmt.Errorf("invalid url: %w", err)
+	} else if err != nil {
+		return "", fmt.Errorf("invalid url: %s", constants.ErrorInvalidURL)
+	}
+
+	// Deep links only need a target; web URLs must be valid for browsers
+	parsed, _ := url.Parse(normalized)
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		if !govalidator.IsURL(normalized) {
+			return "", fmt.Errorf("invalid url: %s", constants.ErrorInvalidURL)
+		}
+	} else if parsed.Host == "" && parsed.Opaque == "" && strings.Trim(parsed.Path, "/") == "" {
+		return "", fmt.Errorf("invalid url: %s", constants.ErrorInvalidURL)
+	}
+
+	if utils.IsShortDomainURL(normalized, s.config.Domains) {
+		return "", fmt.Errorf("domain error: %s", constants.ErrorInvalidURL)
+	}
+
+	// Links to other shorteners create redirect chains; reject them or link to their destination.
+	// Unwrapped destinations are validated again, they may point back at a short domain.
+	unwrapped, changed, err := s.checkShortener(ctx, normalized)
+	if err != nil {
+		return "", err
+	}
+	if changed {
+		return s.validateURL(ctx, unwrapped)
+	}
+
+	return normalized, nil
 }
 
 // generateShortCode creates a short code for the URL.
@@ -118,8 +293,23 @@ func (s *URLService) generateShortCode(customShort string) string {
 	return customShort
 }
 
-// checkShortCodeAvailability verifies if the short code is already in use.
-func (s *URLService) checkShortCodeAvailability(shortCode string) error {
+// validateShortCode checks that a custom short code can be used in a URL path and a database key.
+// An empty code is valid; a random code is generated for it.
+func validateShortCode(customShort string) error {
+	if customShort != "" && !shortCodePattern.MatchString(customShort) {
+		return fmt.Errorf("invalid short code: %s", constants.ErrorInvalidShortCode)
+	}
+	if reservedShortCodes[customShort] {
+		return fmt.Errorf("invalid short code: %s", constants.ErrorReservedShortCode)
+	}
+	return nil
+}
+
+// ReservedLinks returns the short URLs of existing links whose short code has since been
+// reserved, such as links created before the analytics routes were added. They still
+// redirect, but the analytics API serves its own route where their analytics would be.
+// Only the reserved codes are looked up on each domain, so it is cheap enough for startup.
+func (s *URLService) ReservedLinks() ([]string, error) {
 	r := database.CreateClient(constants.RedisDBURLMappings)
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -128,7 +318,38 @@ func (s *URLService) checkShortCodeAvailability(shortCode string) error {
 		}
 	}()
 
-	val, _ := database.Get(r, shortCode)
+	codes := make([]string, 0, len(reservedShortCodes))
+	for code := range reservedShortCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	shortURLs := []string{}
+	for _, domain := range s.config.Domains {
+		for _, code := range codes {
+			n, err := r.Exists(database.Ctx, s.LinkKey(domain, code)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("database error: %s", constants.CannotConnectToTheDB)
+			}
+			if n > 0 {
+				shortURLs = append(shortURLs, s.ShortURL(domain, code))
+			}
+		}
+	}
+	return shortURLs, nil
+}
+
+// checkShortCodeAvailability verifies if the link key is already in use.
+func (s *URLService) checkShortCodeAvailability(key string) error {
+	r := database.CreateClient(constants.RedisDBURLMappings)
+	defer func() {
+		if err := database.CloseClient(r); err != nil {
+			// Log error but don't fail the main operation
+			_ = err
+		}
+	}()
+
+	val, _ := database.Get(r, key)
 	if val != "" {
 		return fmt.Errorf("short code in use: %s", constants.ErrorURLShortInUse)
 	}
@@ -144,8 +365,9 @@ func (s *URLService) setDefaultExpiry(expiry time.Duration) time.Duration {
 	return expiry
 }
 
-// saveURLMapping stores the URL mapping in Redis.
-func (s *URLService) saveURLMapping(shortCode, originalURL string, expiry time.Duration) error {
+// saveURLMapping stores the URL mapping and the link metadata in Redis.
+// Both keys share the same expiry so metadata never outlives its link.
+func (s *URLService) saveURLMapping(link *Link, expiry time.Duration) error {
 	r := database.CreateClient(constants.RedisDBURLMappings) // Use DB 0 for URL mappings
 	defer func() {
 		if err := database.CloseClient(r); err != nil {
@@ -154,15 +376,87 @@ func (s *URLService) saveURLMapping(shortCode, originalURL string, expiry time.D
 		}
 	}()
 
-	return database.Set(r, shortCode, originalURL, expiry*3600*time.Second)
+	key := s.LinkKey(link.Domain, link.ShortCode)
+	ttl := expiry * 3600 * time.Second
+	if err := database.Set(r, key, link.URL, ttl); err != nil {
+		return err
+	}
+
+	if err := database.SetHash(r, constants.LinkMetaPrefix+key, linkMetaFields(link), ttl); err != nil {
+		return err
+	}
+
+	s.trackLinksCreated(map[string]time.Duration{key: ttl})
+	return nil
+}
+
+// linkMetaFields converts link metadata into Redis hash fields.
+func linkMetaFields(link *Link) map[string]interface{} {
+	interstitial := "0"
+	if link.Interstitial {
+		interstitial = "1"
+	}
+	return map[string]interface{}{
+		"title":         link.Title,
+		"created_at":    link.CreatedAt.Unix(),
+		"interstitial":  interstitial,
+		"tags":          strings.Join(link.Tags, ","),
+		"status":        link.Status,
+		"status_reason": link.StatusReason,
+	}
+}
+
+// parseLinkMeta fills link metadata from Redis hash fields.
+// Missing fields leave the corresponding link fields at their zero value.
+func parseLinkMeta(link *Link, meta map[string]string) {
+	link.Title = meta["title"]
+	link.Interstitial = meta["interstitial"] == "1"
+	link.Tags = normalizeTags(strings.Split(meta["tags"], ","))
+	link.Status = meta["status"]
+	link.StatusReason = meta["status_reason"]
+	if link.Status == "" {
+		link.Status = constants.LinkStatusActive
+	}
+	if createdAt, err := strconv.ParseInt(meta["created_at"], 10, 64); err == nil {
+		link.CreatedAt = time.Unix(createdAt, 0).UTC()
+	}
+	link.ReportCount, _ = strconv.ParseInt(meta["reports"], 10, 64)
+	link.Health = meta["health"]
+	if checkedAt, err := strconv.ParseInt(meta["health_checked_at"], 10, 64); err == nil {
+		link.HealthCheckedAt = time.Unix(checkedAt, 0).UTC()
+	}
+}
+
+// normalizeTags trims, lowercases and de-duplicates tags, dropping empty ones.
+// Commas are not allowed inside a tag because tags are stored comma separated.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.ReplaceAll(tag, ",", " ")))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ShortURL returns the complete short URL for a short code on a short domain.
+func (s *URLService) ShortURL(domain, shortCode string) string {
+	return domain + "/" + shortCode
 }
 
 // buildResponse creates the response object.
-func (s *URLService) buildResponse(req *ShortenURLRequest, shortCode string) *ShortenURLResponse {
+func (s *URLService) buildResponse(req *ShortenURLRequest, domain, shortCode string) *ShortenURLResponse {
 	return &ShortenURLResponse{
-		URL:         req.URL,
-		CustomShort: s.config.Domain + "/" + shortCode,
-		Expiry:      req.Expiry,
+		URL:          req.URL,
+		CustomShort:  s.ShortURL(domain, shortCode),
+		Expiry:       req.Expiry,
+		Title:        req.Title,
+		Interstitial: req.Interstitial,
+		Tags:         normalizeTags(req.Tags),
 		// Rate limit fields will be populated by the handler
 		XRateRemaining:  0,
 		XRateLimitReset: 0,
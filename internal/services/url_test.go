@@ -0,0 +1,32 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/config"
+)
+
+func TestReservedLinks(t *testing.T) {
+	server := startTestRedis(t)
+	cfg := &config.Config{
+		Domain:  "https://sho.rt",
+		Domains: []string{"https://sho.rt", "https://go.acme.com"},
+	}
+	urlService := NewURLService(cfg)
+
+	shortURLs, err := urlService.ReservedLinks()
+	if err != nil || len(shortURLs) != 0 {
+		t.Fatalf("ReservedLinks without links = %v, %v, want none", shortURLs, err)
+	}
+
+	// Links on the default domain are stored under the bare code, others under host/code
+	_ = server.Set("export", "https://example.com/a")
+	_ = server.Set("go.acme.com/summary", "https://example.com/b")
+	_ = server.Set("summary2", "https://example.com/c")
+	shortURLs, err = urlService.ReservedLinks()
+	want := []string{"https://sho.rt/export", "https://go.acme.com/summary"}
+	if err != nil || !reflect.DeepEqual(shortURLs, want) {
+		t.Fatalf("ReservedLinks = %v, %v, want %v", shortURLs, err, want)
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+// ClientInfo is the coarse classification of a visitor used in analytics breakdowns.
+// Every field takes one of a small, fixed set of values so the stored dimensions stay bounded.
+type ClientInfo struct {
+	Browser string
+	OS      string
+	Device  string // DeviceDesktop, DeviceMobile, DeviceTablet or DeviceBot
+}
+
+// uaRule maps a user agent substring to a classification; the first matching rule wins.
+type uaRule struct {
+	token string
+	name  string
+}
+
+// browserRules are ordered so that browsers built on others (Edge and Opera on Chrome,
+// Chrome on Safari) are recognized before the engine they embed.
+var browserRules = []uaRule{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex"},
+	{"ucbrowser/", "UC Browser"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+}
+
+// osRules are ordered so that more specific platforms are recognized first
+// (iOS and Android user agents also mention macOS and Linux).
+var osRules = []uaRule{
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"cros", "ChromeOS"},
+	{"windows", "Windows"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+}
+
+// languagePattern matches a primary language subtag.
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// ParseUserAgent classifies a User-Agent header into browser, OS and device class.
+// Unrecognized values are reported as DimensionOther.
+func ParseUserAgent(userAgent string) *ClientInfo {
+	ua := strings.ToLower(userAgent)
+	info := &ClientInfo{
+		Browser: matchUARule(ua, browserRules),
+		OS:      matchUARule(ua, osRules),
+		Device:  constants.DeviceDesktop,
+	}
+
+	_, bot := matchBotSignature(ua, botSignatures)
+	switch {
+	case ua == "" || bot:
+		info.Device = constants.DeviceBot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		info.Device = constants.DeviceTablet
+	case strings.Contains(ua, "mobile") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		info.Device = constants.DeviceMobile
+	}
+	return info
+}
+
+// matchUARule returns the name of the first rule whose token occurs in the lowercase user agent.
+func matchUARule(ua string, rules []uaRule) string {
+	for _, rule := range rules {
+		if strings.Contains(ua, rule.token) {
+			return rule.name
+		}
+	}
+	return constants.DimensionOther
+}
+
+// ReferrerHost returns the host a visitor came from, without "www.", for the Referer header.
+// Visits without a usable referrer are reported as DimensionDirect.
+func ReferrerHost(referrer string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return constants.DimensionDirect
+	}
+	host := strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(parsed.Hostname()), "."), "www.")
+	if len(host) > constants.MaxDimensionValueLength {
+		return constants.DimensionOther
+	}
+	return host
+}
+
+// PrimaryLanguage returns the primary subtag of the visitor's preferred language from an
+// Accept-Language header, e.g. "en" for "en-GB,en;q=0.9,fr;q=0.8". Missing headers are
+// reported as DimensionUnknown and malformed ones as DimensionOther.
+func PrimaryLanguage(acceptLanguage string) string {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if value, err := strconv.ParseFloat(q[2:], 64); err == nil {
+					quality = value
+				}
+			}
+		}
+		if quality > 0 {
+			candidates = append(candidates, candidate{tag: tag, quality: quality})
+		}
+	}
+	if len(candidates) == 0 {
+		return constants.DimensionUnknown
+	}
+
+	// Stable, so equal qualities keep the order the client listed them in
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	primary := strings.SplitN(strings.SplitN(candidates[0].tag, "-", 2)[0], "_", 2)[0]
+	if !languagePattern.MatchString(primary) {
+		return constants.DimensionOther
+	}
+	return primary
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want ClientInfo
+	}{
+		{
+			name: "chrome on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want: ClientInfo{"Chrome", "Windows", constants.DeviceDesktop},
+		},
+		{
+			name: "edge on windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.2592.87",
+			want: ClientInfo{"Edge", "Windows", constants.DeviceDesktop},
+		},
+		{
+			name: "opera on macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36 OPR/111.0.0.0",
+			want: ClientInfo{"Opera", "macOS", constants.DeviceDesktop},
+		},
+		{
+			name: "safari on macos",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			want: ClientInfo{"Safari", "macOS", constants.DeviceDesktop},
+		},
+		{
+			name: "firefox on linux",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want: ClientInfo{"Firefox", "Linux", constants.DeviceDesktop},
+		},
+		{
+			name: "chrome on chromeos",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want: ClientInfo{"Chrome", "ChromeOS", constants.DeviceDesktop},
+		},
+		{
+			name: "internet explorer",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			want: ClientInfo{"Internet Explorer", "Windows", constants.DeviceDesktop},
+		},
+		{
+			name: "safari on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want: ClientInfo{"Safari", "iOS", constants.DeviceMobile},
+		},
+		{
+			name: "chrome on iphone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0.6478.54 Mobile/15E148 Safari/604.1",
+			want: ClientInfo{"Chrome", "iOS", constants.DeviceMobile},
+		},
+		{
+			name: "firefox on ipad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) FxiOS/127.0 Mobile/15E148 Safari/605.1.15",
+			want: ClientInfo{"Firefox", "iOS", constants.DeviceTablet},
+		},
+		{
+			name: "chrome on android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.6478.71 Mobile Safari/537.36",
+			want: ClientInfo{"Chrome", "Android", constants.DeviceMobile},
+		},
+		{
+			name: "samsung internet on android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0.0.0 Safari/537.36",
+			want: ClientInfo{"Samsung Internet", "Android", constants.DeviceTablet},
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.5.0",
+			want: ClientInfo{"curl", constants.DimensionOther, constants.DeviceDesktop},
+		},
+		{
+			name: "crawler",
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: ClientInfo{constants.DimensionOther, constants.DimensionOther, constants.DeviceBot},
+		},
+		{
+			name: "link unfurler",
+			ua:   "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			want: ClientInfo{constants.DimensionOther, constants.DimensionOther, constants.DeviceBot},
+		},
+		{
+			name: "empty",
+			ua:   "",
+			want: ClientInfo{constants.DimensionOther, constants.DimensionOther, constants.DeviceBot},
+		},
+		{
+			name: "unknown",
+			ua:   "SomeApp/1.0",
+			want: ClientInfo{constants.DimensionOther, constants.DimensionOther, constants.DeviceDesktop},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.ua); *got != tt.want {
+				t.Errorf("ParseUserAgent(%q) = %+v, want %+v", tt.ua, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferrerHost(t *testing.T) {
+	tests := []struct {
+		referrer string
+		want     string
+	}{
+		{"https://www.google.com/search?q=x", "google.com"},
+		{"https://News.Ycombinator.com./item?id=1", "news.ycombinator.com"},
+		{"http://localhost:8080/page", "localhost"},
+		{"android-app://com.slack/", "com.slack"},
+		{"", constants.DimensionDirect},
+		{"not a url", constants.DimensionDirect},
+		{"/relative/path", constants.DimensionDirect},
+		{"https://" + strings.Repeat("a", constants.MaxDimensionValueLength+1) + ".com/", constants.DimensionOther},
+	}
+	for _, tt := range tests {
+		if got := ReferrerHost(tt.referrer); got != tt.want {
+			t.Errorf("ReferrerHost(%q) = %q, want %q", tt.referrer, got, tt.want)
+		}
+	}
+}
+
+func TestPrimaryLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"en-GB,en;q=0.9,fr;q=0.8", "en"},
+		{"fr-CH, fr;q=0.9, en;q=0.8, de;q=0.7, *;q=0.5", "fr"},
+		{"de;q=0.5, pt-BR", "pt"},
+		{"en;q=0.8, es;q=0.8", "en"},
+		{"zh_TW", "zh"},
+		{"*", constants.DimensionUnknown},
+		{"en;q=0", constants.DimensionUnknown},
+		{"", constants.DimensionUnknown},
+		{"1234", constants.DimensionOther},
+		{"english", constants.DimensionOther},
+	}
+	for _, tt := range tests {
+		if got := PrimaryLanguage(tt.header); got != tt.want {
+			t.Errorf("PrimaryLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adeesh/url-shortener/internal/constants"
+	"golang.org/x/net/idna"
+)
+
+// ErrSchemeNotAllowed is returned when a URL uses a scheme outside the allowlist.
+var ErrSchemeNotAllowed = errors.New(constants.ErrorSchemeNotAllowed)
+
+// ErrMalformedURL is returned when a URL cannot be parsed or has no host.
+var ErrMalformedURL = errors.New(constants.ErrorInvalidURL)
+
+// schemePattern matches an explicit RFC 3986 scheme at the start of a URL.
+var schemePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+
+// defaultPorts are the ports dropped from web URLs because they are implied by the scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL parses a destination URL and returns it in canonical form.
+//
+// URLs without a scheme get "https://". Web URLs (http and https) must have a host; their
+// scheme and host are lowercased, internationalized hosts are converted to punycode,
+// default ports are dropped and an empty path becomes "/". URLs with other schemes, such
+// as app deep links ("myapp://open/item"), only get their scheme lowercased.
+//
+// The scheme must be in allowedSchemes (lowercase), otherwise ErrSchemeNotAllowed is returned.
+func NormalizeURL(rawURL string, allowedSchemes []string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", ErrMalformedURL
+	}
+
+	// "example.com:8080/path" looks like scheme "example.com", so only "scheme://" or a
+	// scheme from the allowlist (e.g. "mailto:") counts as explicit
+	if match := schemePattern.FindStringSubmatch(rawURL); match == nil ||
+		(!strings.HasPrefix(rawURL[len(match[0]):], "//") && !containsScheme(allowedSchemes, strings.ToLower(match[1]))) {
+		rawURL = "https://" + rawURL
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", ErrMalformedURL
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if !containsScheme(allowedSchemes, parsed.Scheme) {
+		return "", ErrSchemeNotAllowed
+	}
+
+	if _, web := defaultPorts[parsed.Scheme]; !web {
+		return parsed.String(), nil
+	}
+
+	host, err := normalizeHost(parsed.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := parsed.Port(); port != "" && port != defaultPorts[parsed.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal without a port
+	}
+	parsed.Host = host
+
+	if parsed.Path == "" && parsed.RawPath == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String(), nil
+}
+
+// normalizeHost lowercases a host and converts internationalized domain names to punycode.
+// IP addresses, including numeric IPv4 forms such as "0x7f.1", are returned in their
+// canonical text form.
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", ErrMalformedURL
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if ip := ParseNumericIPv4(host); ip != nil {
+		return ip.String(), nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", ErrMalformedURL
+	}
+	return strings.ToLower(ascii), nil
+}
+
+// containsScheme reports whether scheme is in the list.
+func containsScheme(schemes []string, scheme string) bool {
+	for _, allowed := range schemes {
+		if allowed == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNumericIPv4 parses the numeric IPv4 forms inet_aton accepts and browsers and HTTP
+// clients still resolve, such as "2130706433", "127.1" and "0x7f.0.0.1": one to four
+// decimal, octal (leading 0) or hexadecimal (leading 0x) parts, the last of which fills the
+// remaining bytes. It returns nil if host is not such an address.
+func ParseNumericIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	var value uint64
+	for i, part := range parts {
+		n, ok := parseNumericIPv4Part(part)
+		if !ok {
+			return nil
+		}
+		if i < len(parts)-1 {
+			if n > 0xff {
+				return nil
+			}
+			value = value<<8 | n
+			continue
+		}
+		bits := uint(8 * (4 - i))
+		if n >= 1<<bits {
+			return nil
+		}
+		value = value<<bits | n
+	}
+	return net.IPv4(byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+// parseNumericIPv4Part parses one part of a numeric IPv4 address.
+func parseNumericIPv4Part(part string) (uint64, bool) {
+	base := 10
+	switch {
+	case len(part) > 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		base, part = 16, part[2:]
+	case len(part) > 1 && part[0] == '0':
+		base, part = 8, part[1:]
+	}
+	n, err := strconv.ParseUint(part, base, 32)
+	return n, err == nil
+}
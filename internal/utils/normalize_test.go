@@ -0,0 +1,68 @@
+package utils
+
+import "testing"
+
+func TestParseNumericIPv4(t *testing.T) {
+	tests := []struct {
+		host string
+		want string // empty when host is not a numeric IPv4 address
+	}{
+		{"2130706433", "127.0.0.1"},
+		{"127.1", "127.0.0.1"},
+		{"127.0.1", "127.0.0.1"},
+		{"0x7f.0.0.1", "127.0.0.1"},
+		{"0X7F.0.0.1", "127.0.0.1"},
+		{"0x7f000001", "127.0.0.1"},
+		{"017700000001", "127.0.0.1"},
+		{"0177.0.0.1", "127.0.0.1"},
+		{"10.0.0.1", "10.0.0.1"},
+		{"0", "0.0.0.0"},
+		{"4294967295", "255.255.255.255"},
+		{"4294967296", ""},
+		{"256.0.0.1", ""},
+		{"1.2.3.4.5", ""},
+		{"127..1", ""},
+		{"08.0.0.1", ""},
+		{"0x", ""},
+		{"1_000", ""},
+		{"+1.2.3.4", ""},
+		{"example.com", ""},
+		{"cafe.be", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		ip := ParseNumericIPv4(tt.host)
+		got := ""
+		if ip != nil {
+			got = ip.String()
+		}
+		if got != tt.want {
+			t.Errorf("ParseNumericIPv4(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	schemes := []string{"http", "https", "mailto", "myapp"}
+	tests := []struct {
+		raw  string
+		want string
+		err  error
+	}{
+		{"example.com", "https://example.com/", nil},
+		{"HTTP://Example.COM:80/Path", "http://example.com/Path", nil},
+		{"https://example.com:8443", "https://example.com:8443/", nil},
+		{"http://2130706433/admin", "http://127.0.0.1/admin", nil},
+		{"http://0x7f.1:8080/", "http://127.0.0.1:8080/", nil},
+		{"http://[::1]/", "http://[::1]/", nil},
+		{"MyApp://open/item", "myapp://open/item", nil},
+		{"ftp://example.com/file", "", ErrSchemeNotAllowed},
+		{"", "", ErrMalformedURL},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeURL(tt.raw, schemes)
+		if err != tt.err || got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, %v, want %q, %v", tt.raw, got, err, tt.want, tt.err)
+		}
+	}
+}